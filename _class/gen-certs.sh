@@ -1,8 +0,0 @@
-#!/bin/bash
-
-openssl req -x509 -newkey rsa:4096 \
-    -keyout key.pem \
-    -out cert.pem \
-    -days 365 \
-    -nodes \
-    -subj /CN=localhost
\ No newline at end of file
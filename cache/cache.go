@@ -6,6 +6,8 @@ import (
 	"time"
 
 	"github.com/go-redis/redis/v8"
+
+	"github.com/353solutions/unter/trace"
 )
 
 type Cache struct {
@@ -18,6 +20,7 @@ func Connect(ctx context.Context, addr string, ttl time.Duration) (*Cache, error
 		Addr: addr,
 	}
 	c := redis.NewClient(&opts)
+	c.AddHook(traceHook{})
 	cache := Cache{c, ttl}
 
 	if err := cache.Health(ctx); err != nil {
@@ -53,3 +56,98 @@ func (c *Cache) Get(ctx context.Context, key string) ([]byte, error) {
 func (c *Cache) Set(ctx context.Context, key string, value []byte) error {
 	return c.conn.Set(ctx, key, value, c.ttl).Err()
 }
+
+// traceHook creates a span for every redis command.
+type traceHook struct{}
+
+func (traceHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	ctx, span := trace.Start(ctx, "redis."+cmd.Name(), trace.Client)
+	span.SetAttr("db.system", "redis")
+	return ctx, nil
+}
+
+func (traceHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	if span := trace.FromContext(ctx); span != nil {
+		if err := cmd.Err(); !errors.Is(err, redis.Nil) {
+			span.SetError(err)
+		}
+		span.Finish()
+	}
+	return nil
+}
+
+func (traceHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	ctx, span := trace.Start(ctx, "redis.pipeline", trace.Client)
+	span.SetAttr("db.system", "redis")
+	return ctx, nil
+}
+
+func (traceHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	if span := trace.FromContext(ctx); span != nil {
+		span.Finish()
+	}
+	return nil
+}
+
+// Publish publishes data to a pub/sub channel.
+func (c *Cache) Publish(ctx context.Context, channel string, data []byte) error {
+	return c.conn.Publish(ctx, channel, data).Err()
+}
+
+// Subscribe returns messages published to channel. The returned channel is
+// closed when ctx is done.
+func (c *Cache) Subscribe(ctx context.Context, channel string) (<-chan []byte, error) {
+	sub := c.conn.Subscribe(ctx, channel)
+	// Wait for confirmation so no messages are lost after we return
+	if _, err := sub.Receive(ctx); err != nil {
+		sub.Close() //#nosec G104
+		return nil, err
+	}
+
+	out := make(chan []byte)
+	go func() {
+		defer close(out)
+		defer sub.Close()
+
+		ch := sub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-ch:
+				if !ok {
+					return
+				}
+				select {
+				case out <- []byte(msg.Payload):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return out, nil
+}
+
+// Incr increments a counter and returns the new value.
+func (c *Cache) Incr(ctx context.Context, key string) (int64, error) {
+	return c.conn.Incr(ctx, key).Result()
+}
+
+// Delete deletes keys.
+func (c *Cache) Delete(ctx context.Context, keys ...string) error {
+	return c.conn.Del(ctx, keys...).Err()
+}
+
+// StreamAdd appends an entry to a stream, the stream is trimmed to about
+// maxLen entries (0 means no limit).
+func (c *Cache) StreamAdd(ctx context.Context, stream string, maxLen int64, fields map[string]any) error {
+	args := redis.XAddArgs{
+		Stream: stream,
+		MaxLen: maxLen,
+		Approx: true,
+		Values: fields,
+	}
+	return c.conn.XAdd(ctx, &args).Err()
+}
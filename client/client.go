@@ -2,17 +2,105 @@ package client
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"net/http"
+	"os"
+
+	"github.com/google/uuid"
+
+	"github.com/353solutions/unter/trace"
 )
 
+// RequestIDHeader is the header used to correlate requests across services.
+const RequestIDHeader = "X-Request-ID"
+
+type keyType int
+
+const ridKey keyType = 1
+
+// WithRequestID returns a context whose requests will be sent with id as
+// request ID. Without it, every request gets a new ID.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ridKey, id)
+}
+
+func requestID(ctx context.Context) string {
+	if id, ok := ctx.Value(ridKey).(string); ok && id != "" {
+		return id
+	}
+	return uuid.NewString()
+}
+
 type Client struct {
 	BaseURL string
 	client  http.Client
 }
 
-func New(baseURL string) *Client {
-	return &Client{BaseURL: baseURL}
+// Option configures a Client.
+type Option func(*Client)
+
+func New(baseURL string, opts ...Option) *Client {
+	c := Client{BaseURL: baseURL}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return &c
+}
+
+// tlsConfig returns the TLS configuration of the client transport, creating
+// one if needed.
+func (c *Client) tlsConfig() *tls.Config {
+	t, ok := c.client.Transport.(*http.Transport)
+	if !ok {
+		t = http.DefaultTransport.(*http.Transport).Clone()
+		c.client.Transport = t
+	}
+	if t.TLSClientConfig == nil {
+		t.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	return t.TLSClientConfig
+}
+
+// WithClientCert authenticates to the server with a client certificate
+// (mutual TLS).
+func WithClientCert(cert tls.Certificate) Option {
+	return func(c *Client) {
+		cfg := c.tlsConfig()
+		cfg.Certificates = append(cfg.Certificates, cert)
+	}
+}
+
+// WithRootCAs verifies the server certificate against pool instead of the
+// system roots.
+func WithRootCAs(pool *x509.CertPool) Option {
+	return func(c *Client) {
+		c.tlsConfig().RootCAs = pool
+	}
+}
+
+// LoadClientCert returns a WithClientCert option from PEM files.
+func LoadClientCert(certFile, keyFile string) (Option, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return WithClientCert(cert), nil
+}
+
+// LoadRootCA returns a WithRootCAs option from a PEM CA bundle.
+func LoadRootCA(caFile string) (Option, error) {
+	data, err := os.ReadFile(caFile) //#nosec G304
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("%s: no certificates found", caFile)
+	}
+	return WithRootCAs(pool), nil
 }
 
 func (c *Client) Health(ctx context.Context) error {
@@ -21,14 +109,38 @@ func (c *Client) Health(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
-	resp, err := c.client.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("bad status - %s", resp.Status)
+		return fmt.Errorf("bad status - %s (request %s)", resp.Status, req.Header.Get(RequestIDHeader))
 	}
 
 	return nil
 }
+
+// do sends req with a client span and a request ID, propagating trace context.
+// It sets the request ID header on req.
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	ctx, span := trace.Start(req.Context(), fmt.Sprintf("HTTP %s", req.Method), trace.Client)
+	defer span.Finish()
+
+	req = req.Clone(ctx) // don't change the caller's headers
+	if req.Header.Get(RequestIDHeader) == "" {
+		req.Header.Set(RequestIDHeader, requestID(ctx))
+	}
+	span.SetAttr("http.url", req.URL.String())
+	span.SetAttr("request_id", req.Header.Get(RequestIDHeader))
+	trace.Inject(ctx, req.Header)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+	span.SetAttr("http.status_code", fmt.Sprint(resp.StatusCode))
+	return resp, nil
+}
@@ -2,12 +2,22 @@ package client
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"fmt"
+	"math/big"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/require"
+
+	"github.com/353solutions/unter/trace"
 )
 
 type errTripper struct{}
@@ -26,3 +36,113 @@ func TestHealth(t *testing.T) {
 	err := c.Health(ctx)
 	require.Error(t, err, "health")
 }
+
+type headerTripper struct {
+	header http.Header
+}
+
+func (h *headerTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	h.header = r.Header
+	return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+}
+
+func TestTraceparent(t *testing.T) {
+	c := New("http://example.com")
+	tripper := headerTripper{}
+	c.client.Transport = &tripper
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	err := c.Health(ctx)
+	require.NoError(t, err, "health")
+
+	_, err = trace.Parse(tripper.header.Get(trace.Header))
+	require.NoError(t, err, "traceparent")
+}
+
+func TestRequestID(t *testing.T) {
+	c := New("http://example.com")
+	tripper := headerTripper{}
+	c.client.Transport = &tripper
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	ctx = WithRequestID(ctx, "batch-7")
+	err := c.Health(ctx)
+	require.NoError(t, err, "health")
+	require.Equal(t, "batch-7", tripper.header.Get(RequestIDHeader))
+}
+
+func TestDoHeaders(t *testing.T) {
+	c := New("http://example.com")
+	tripper := headerTripper{}
+	c.client.Transport = &tripper
+
+	req, err := http.NewRequest(http.MethodGet, "http://example.com/health", nil)
+	require.NoError(t, err)
+	resp, err := c.do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	require.NotEmpty(t, tripper.header.Get(RequestIDHeader))
+	require.NotEmpty(t, tripper.header.Get(trace.Header))
+	require.Empty(t, req.Header, "caller request changed")
+}
+
+// clientCert returns a self signed client certificate.
+func clientCert(t *testing.T, cn string) (tls.Certificate, *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &tmpl, &tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, cert
+}
+
+func TestMutualTLS(t *testing.T) {
+	require := require.New(t)
+
+	cert, x509Cert := clientCert(t, "batch.unter.internal")
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(x509Cert)
+
+	var peer string
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		peer = r.TLS.VerifiedChains[0][0].Subject.CommonName
+	}))
+	srv.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCAs,
+	}
+	srv.StartTLS()
+	defer srv.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	c := New(srv.URL, WithRootCAs(roots))
+	err := c.Health(ctx)
+	require.Error(err, "no client cert")
+
+	c = New(srv.URL, WithRootCAs(roots), WithClientCert(cert))
+	err = c.Health(ctx)
+	require.NoError(err, "client cert")
+	require.Equal("batch.unter.internal", peer)
+}
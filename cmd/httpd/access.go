@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// responseWriter records status code and number of bytes written.
+type responseWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func newResponseWriter(w http.ResponseWriter) *responseWriter {
+	return &responseWriter{ResponseWriter: w}
+}
+
+func (w *responseWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *responseWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(data)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Status returns the response status code, 200 if handler didn't set one.
+func (w *responseWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+// Flush implements http.Flusher
+func (w *responseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("%T is not a http.Hijacker", w.ResponseWriter)
+	}
+	return h.Hijack()
+}
+
+// Unwrap is used by http.ResponseController
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// routeMiddleware records the matched route template in request values.
+func routeMiddleware(h http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		if v := RequestValues(r.Context()); v != nil {
+			if route := mux.CurrentRoute(r); route != nil {
+				if tmpl, err := route.GetPathTemplate(); err == nil {
+					v.Route = tmpl
+				}
+			}
+		}
+		h.ServeHTTP(w, r)
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+const (
+	jsonFormat     = "json"
+	combinedFormat = "combined"
+)
+
+// AccessEntry is a single line in the access log.
+type AccessEntry struct {
+	Time      time.Time     `json:"time"`
+	RequestID string        `json:"request_id"`
+	Remote    string        `json:"remote"`
+	User      string        `json:"user,omitempty"`
+	Method    string        `json:"method"`
+	Route     string        `json:"route"`
+	Proto     string        `json:"proto"`
+	Status    int           `json:"status"`
+	Bytes     int64         `json:"bytes"`
+	Duration  time.Duration `json:"duration_ns"`
+	Referer   string        `json:"referer,omitempty"`
+	UserAgent string        `json:"user_agent,omitempty"`
+}
+
+// AccessLog writes access log entries in JSON or Combined Log Format.
+// Successful (2xx) responses of sampled routes are logged only at SampleRate.
+type AccessLog struct {
+	Format     string
+	SampleRate float64
+	// Routes to sample, empty means all routes
+	SampledRoutes []string
+
+	mu  sync.Mutex
+	out io.Writer
+}
+
+func NewAccessLog(out io.Writer, format string, rate float64, routes []string) (*AccessLog, error) {
+	if format != jsonFormat && format != combinedFormat {
+		return nil, fmt.Errorf("unknown access log format: %q", format)
+	}
+
+	if rate < 0 || rate > 1 {
+		return nil, fmt.Errorf("sample rate %f out of range [0,1]", rate)
+	}
+
+	a := AccessLog{
+		Format:        format,
+		SampleRate:    rate,
+		SampledRoutes: routes,
+		out:           out,
+	}
+	return &a, nil
+}
+
+func (a *AccessLog) sampled(e AccessEntry) bool {
+	if e.Status < 200 || e.Status >= 300 {
+		return true
+	}
+
+	if a.SampleRate >= 1 {
+		return true
+	}
+
+	if len(a.SampledRoutes) > 0 {
+		found := false
+		for _, r := range a.SampledRoutes {
+			if r == e.Route {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return true
+		}
+	}
+
+	return rand.Float64() < a.SampleRate //#nosec G404
+}
+
+// Log writes e to the access log if it passes sampling.
+func (a *AccessLog) Log(e AccessEntry) error {
+	if !a.sampled(e) {
+		return nil
+	}
+
+	var data []byte
+	switch a.Format {
+	case jsonFormat:
+		var err error
+		data, err = json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		data = append(data, '\n')
+	case combinedFormat:
+		data = []byte(combinedLine(e))
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	_, err := a.out.Write(data)
+	return err
+}
+
+// combinedLine returns e in Apache Combined Log Format with request ID and
+// duration (in µs) appended.
+func combinedLine(e AccessEntry) string {
+	host, _, err := net.SplitHostPort(e.Remote)
+	if err != nil {
+		host = e.Remote
+	}
+
+	return fmt.Sprintf(
+		"%s - %s [%s] \"%s %s %s\" %d %d %q %q %s %d\n",
+		orDash(host),
+		orDash(e.User),
+		e.Time.Format("02/Jan/2006:15:04:05 -0700"),
+		e.Method, orDash(e.Route), e.Proto,
+		e.Status,
+		e.Bytes,
+		orDash(e.Referer),
+		orDash(e.UserAgent),
+		e.RequestID,
+		e.Duration.Microseconds(),
+	)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
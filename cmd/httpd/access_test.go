@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccessLog(t *testing.T) {
+	require := require.New(t)
+
+	var buf bytes.Buffer
+	access, err := NewAccessLog(&buf, jsonFormat, 1, nil)
+	require.NoError(err, "new access log")
+
+	r := mux.NewRouter()
+	r.HandleFunc("/rides/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("tea")) //#nosec G104
+	})
+	r.Use(routeMiddleware)
+	h := topMiddleware(log.New(io.Discard, "", 0), staticSettings(&Settings{Access: access}), nil, r)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/rides/007", nil)
+	h.ServeHTTP(w, req)
+
+	var e AccessEntry
+	err = json.Unmarshal(buf.Bytes(), &e)
+	require.NoError(err, "decode entry")
+	require.Equal("/rides/{id}", e.Route)
+	require.Equal(http.StatusTeapot, e.Status)
+	require.Equal(int64(3), e.Bytes)
+	require.NotEmpty(e.RequestID)
+}
+
+func TestAccessLogSampling(t *testing.T) {
+	require := require.New(t)
+
+	var buf bytes.Buffer
+	access, err := NewAccessLog(&buf, combinedFormat, 0, []string{"/health"})
+	require.NoError(err, "new access log")
+
+	err = access.Log(AccessEntry{Route: "/health", Status: http.StatusOK})
+	require.NoError(err)
+	require.Equal(0, buf.Len(), "sampled 2xx")
+
+	err = access.Log(AccessEntry{Route: "/health", Status: http.StatusInternalServerError})
+	require.NoError(err)
+	err = access.Log(AccessEntry{Route: "/rides/{id}", Status: http.StatusOK})
+	require.NoError(err)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(lines, 2)
+}
+
+func TestResponseWriterFlusher(t *testing.T) {
+	w := newResponseWriter(httptest.NewRecorder())
+	var rw http.ResponseWriter = w
+	_, ok := rw.(http.Flusher)
+	require.True(t, ok)
+	_, ok = rw.(http.Hijacker)
+	require.True(t, ok)
+}
+
+func TestRequestIDHeader(t *testing.T) {
+	require := require.New(t)
+
+	h := topMiddleware(log.New(io.Discard, "", 0), staticSettings(&Settings{}), nil, http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			httpError(w, r, "oops", http.StatusBadRequest)
+		}))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(requestIDHeader, "batch-7")
+	h.ServeHTTP(w, r)
+	require.Equal("batch-7", w.Header().Get(requestIDHeader))
+	require.Contains(w.Body.String(), "(batch-7)")
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(requestIDHeader, "<script>")
+	h.ServeHTTP(w, r)
+	rid := w.Header().Get(requestIDHeader)
+	require.NotEqual("<script>", rid)
+	require.True(validRequestID(rid))
+}
+
+func staticSettings(s *Settings) func() *Settings {
+	if s.MaxBodySize == 0 {
+		s.MaxBodySize = defaultMaxBodySize
+	}
+	return func() *Settings { return s }
+}
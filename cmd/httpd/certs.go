@@ -0,0 +1,281 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+/* certs subcommand, replaces openssl scripts for local development
+
+$ httpd certs -hosts localhost,127.0.0.1
+$ httpd certs -client batch.unter.internal
+
+Creates (or reuses) a local CA in ca.pem/ca-key.pem and issues a server
+certificate to cert.pem/key.pem. With -client it issues a client certificate
+(for mutual TLS) to client-<name>.pem/client-<name>-key.pem instead.
+*/
+
+const day = 24 * time.Hour
+
+// clientNameRe is the allowed -client name, it's also a file name.
+var clientNameRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+type certsOptions struct {
+	dir     string
+	hosts   []string
+	client  string
+	caTTL   time.Duration
+	certTTL time.Duration
+}
+
+func certsCmd(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("certs", flag.ContinueOnError)
+	fs.SetOutput(out)
+	var opts certsOptions
+	var hosts string
+	fs.StringVar(&opts.dir, "dir", ".", "output directory")
+	fs.StringVar(&hosts, "hosts", "localhost,127.0.0.1,::1", "comma separated DNS names and IPs (server certificate)")
+	fs.StringVar(&opts.client, "client", "", "issue a client certificate for this name instead of a server one")
+	fs.DurationVar(&opts.caTTL, "ca-ttl", 10*365*day, "CA lifetime (when creating a new CA)")
+	fs.DurationVar(&opts.certTTL, "ttl", 90*day, "certificate lifetime")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	for _, h := range strings.Split(hosts, ",") {
+		if h = strings.TrimSpace(h); h != "" {
+			opts.hosts = append(opts.hosts, h)
+		}
+	}
+
+	return genCerts(opts, out)
+}
+
+func genCerts(opts certsOptions, out io.Writer) error {
+	if opts.certTTL <= 0 || opts.caTTL <= 0 {
+		return fmt.Errorf("lifetimes must be positive")
+	}
+	if opts.client != "" && !clientNameRe.MatchString(opts.client) {
+		return fmt.Errorf("bad client name: %q", opts.client)
+	}
+
+	ca, caKey, err := loadOrCreateCA(opts.dir, opts.caTTL, out)
+	if err != nil {
+		return err
+	}
+
+	name, tmpl := "cert", serverTemplate(opts.hosts)
+	if opts.client != "" {
+		name, tmpl = "client-"+opts.client, clientTemplate(opts.client)
+	}
+	if tmpl.Subject.CommonName == "" {
+		return fmt.Errorf("no hosts")
+	}
+
+	tmpl.SerialNumber, err = newSerial()
+	if err != nil {
+		return err
+	}
+
+	notAfter := time.Now().Add(opts.certTTL)
+	if notAfter.After(ca.NotAfter) {
+		return fmt.Errorf("certificate would outlive CA (expires %s)", ca.NotAfter.Format(time.RFC3339))
+	}
+	tmpl.NotAfter = notAfter
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &key.PublicKey, caKey)
+	if err != nil {
+		return err
+	}
+
+	certFile := filepath.Join(opts.dir, name+".pem")
+	keyFile := filepath.Join(opts.dir, "key.pem")
+	if opts.client != "" {
+		keyFile = filepath.Join(opts.dir, name+"-key.pem")
+	}
+	if err := writeCertFiles(certFile, keyFile, der, key); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "%s: %s (expires %s)\n", certFile, tmpl.Subject.CommonName, notAfter.Format(time.RFC3339))
+	return nil
+}
+
+func newSerial() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
+
+func serverTemplate(hosts []string) *x509.Certificate {
+	var tmpl x509.Certificate
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, h)
+		}
+	}
+	if len(hosts) > 0 {
+		tmpl.Subject = pkix.Name{CommonName: hosts[0]}
+	}
+	tmpl.KeyUsage = x509.KeyUsageDigitalSignature
+	tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	tmpl.NotBefore = time.Now().Add(-time.Hour) // clock skew
+	return &tmpl
+}
+
+func clientTemplate(name string) *x509.Certificate {
+	tmpl := x509.Certificate{
+		Subject:     pkix.Name{CommonName: name},
+		DNSNames:    []string{name},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		NotBefore:   time.Now().Add(-time.Hour),
+	}
+	return &tmpl
+}
+
+func loadOrCreateCA(dir string, ttl time.Duration, out io.Writer) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	certFile, keyFile := filepath.Join(dir, "ca.pem"), filepath.Join(dir, "ca-key.pem")
+
+	certPEM, err := os.ReadFile(certFile) //#nosec G304
+	switch {
+	case err == nil:
+		return loadCA(certPEM, keyFile)
+	case !errors.Is(err, os.ErrNotExist):
+		return nil, nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := newSerial()
+	if err != nil {
+		return nil, nil, err
+	}
+	tmpl := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "unter local CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(ttl),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &tmpl, &tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := writeCertFiles(certFile, keyFile, der, key); err != nil {
+		return nil, nil, err
+	}
+	fmt.Fprintf(out, "%s: new CA (expires %s)\n", certFile, tmpl.NotAfter.Format(time.RFC3339))
+
+	ca, err := x509.ParseCertificate(der)
+	return ca, key, err
+}
+
+func loadCA(certPEM []byte, keyFile string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return nil, nil, fmt.Errorf("bad CA certificate")
+	}
+	ca, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	if time.Now().After(ca.NotAfter) {
+		return nil, nil, fmt.Errorf("CA expired at %s", ca.NotAfter.Format(time.RFC3339))
+	}
+
+	keyPEM, err := os.ReadFile(keyFile) //#nosec G304
+	if err != nil {
+		return nil, nil, err
+	}
+	block, _ = pem.Decode(keyPEM)
+	if block == nil {
+		return nil, nil, fmt.Errorf("bad CA key")
+	}
+	key, err := x509.ParseECPrivateKey(block.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return ca, key, nil
+}
+
+func writeCertFiles(certFile, keyFile string, der []byte, key *ecdsa.PrivateKey) error {
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if err := os.WriteFile(certFile, certPEM, 0644); err != nil { //#nosec G306 - public
+		return err
+	}
+
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return os.WriteFile(keyFile, keyPEM, 0600)
+}
+
+// Leaf returns the current certificate.
+func (cr *certReloader) Leaf() (*x509.Certificate, error) {
+	c, err := cr.GetCertificate(nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.Leaf != nil {
+		return c.Leaf, nil
+	}
+	return x509.ParseCertificate(c.Certificate[0])
+}
+
+var errCertExpiring = errors.New("certificate expiring")
+
+// checkExpiry returns an error if the certificate expires within warn.
+func (cr *certReloader) checkExpiry(warn time.Duration) error {
+	leaf, err := cr.Leaf()
+	if err != nil {
+		return err
+	}
+
+	left := time.Until(leaf.NotAfter)
+	if left < warn {
+		return fmt.Errorf("%w: %q expires in %v (%s)", errCertExpiring, leaf.Subject.CommonName, left.Round(time.Minute), leaf.NotAfter.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// certExpiryCheck is a degradable readiness check for the server certificate.
+func certExpiryCheck(cr *certReloader, warn time.Duration) Check {
+	return Check{
+		Name:     "tls_cert",
+		Critical: false,
+		Timeout:  time.Second,
+		Fn: func(context.Context) error {
+			return cr.checkExpiry(warn)
+		},
+	}
+}
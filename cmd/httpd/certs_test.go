@@ -0,0 +1,121 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func loadCert(t *testing.T, certFile, keyFile string) *x509.Certificate {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+	return leaf
+}
+
+func TestCertsCmd(t *testing.T) {
+	require := require.New(t)
+	dir := t.TempDir()
+
+	err := certsCmd([]string{"-dir", dir, "-hosts", "unter.local,10.0.0.1", "-ttl", "48h"}, io.Discard)
+	require.NoError(err, "server")
+	caData, err := os.ReadFile(filepath.Join(dir, "ca.pem"))
+	require.NoError(err)
+
+	// Second run reuses the CA
+	err = certsCmd([]string{"-dir", dir, "-client", "batch.unter.internal"}, io.Discard)
+	require.NoError(err, "client")
+	caData2, err := os.ReadFile(filepath.Join(dir, "ca.pem"))
+	require.NoError(err)
+	require.Equal(caData, caData2, "CA reused")
+
+	pool, err := loadCertPool(filepath.Join(dir, "ca.pem"))
+	require.NoError(err)
+
+	server := loadCert(t, filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"))
+	_, err = server.Verify(x509.VerifyOptions{DNSName: "unter.local", Roots: pool})
+	require.NoError(err, "verify server")
+	require.Equal("10.0.0.1", server.IPAddresses[0].String())
+	require.WithinDuration(time.Now().Add(48*time.Hour), server.NotAfter, time.Minute)
+
+	client := loadCert(t, filepath.Join(dir, "client-batch.unter.internal.pem"), filepath.Join(dir, "client-batch.unter.internal-key.pem"))
+	_, err = client.Verify(x509.VerifyOptions{
+		Roots:     pool,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	require.NoError(err, "verify client")
+}
+
+var badClientNames = []string{
+	"../evil",
+	"a/b",
+	".hidden",
+	"-flag",
+	"a b",
+}
+
+func TestCertsBadClient(t *testing.T) {
+	for _, name := range badClientNames {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			err := certsCmd([]string{"-dir", dir, "-client", name}, io.Discard)
+			require.Error(t, err)
+			files, err := os.ReadDir(dir)
+			require.NoError(t, err)
+			require.Empty(t, files, "no CA created")
+		})
+	}
+}
+
+// A client named ca or cert doesn't overwrite the CA or server certificate.
+func TestCertsClientNames(t *testing.T) {
+	require := require.New(t)
+	dir := t.TempDir()
+
+	require.NoError(certsCmd([]string{"-dir", dir}, io.Discard))
+	caData, err := os.ReadFile(filepath.Join(dir, "ca-key.pem"))
+	require.NoError(err)
+	certData, err := os.ReadFile(filepath.Join(dir, "cert.pem"))
+	require.NoError(err)
+
+	for _, name := range []string{"ca", "cert"} {
+		require.NoError(certsCmd([]string{"-dir", dir, "-client", name}, io.Discard))
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "ca-key.pem"))
+	require.NoError(err)
+	require.Equal(caData, data)
+	data, err = os.ReadFile(filepath.Join(dir, "cert.pem"))
+	require.NoError(err)
+	require.Equal(certData, data)
+	_, err = os.Stat(filepath.Join(dir, "client-ca.pem"))
+	require.NoError(err)
+}
+
+func TestCertOutlivesCA(t *testing.T) {
+	opts := certsOptions{
+		dir:     t.TempDir(),
+		hosts:   []string{"localhost"},
+		caTTL:   time.Hour,
+		certTTL: day,
+	}
+	require.Error(t, genCerts(opts, io.Discard))
+}
+
+func TestCertExpiry(t *testing.T) {
+	require := require.New(t)
+
+	certFile, keyFile := writeTestCert(t, t.TempDir(), "localhost") // valid for an hour
+	cr, err := newCertReloader(certFile, keyFile)
+	require.NoError(err)
+
+	require.NoError(cr.checkExpiry(time.Minute))
+	require.ErrorIs(cr.checkExpiry(2*time.Hour), errCertExpiring)
+}
@@ -2,9 +2,13 @@ package main
 
 import (
 	"fmt"
+	"os"
 	"strings"
+	"time"
 
 	"github.com/ardanlabs/conf/v3"
+
+	"github.com/353solutions/unter"
 )
 
 // config: defaults < config file < environment < command line options
@@ -15,19 +19,240 @@ import (
 
 // outside: viper + cobra
 
+const envPrefix = "UNTER"
+
 type Config struct {
-	Addr      string `conf:"default::8080,env:ADDR"`
-	DSN       string `conf:"default:host=localhost user=postgres password=s3cr3t sslmode=disable,env:DSN"`
-	CacheAddr string `conf:"default:localhost:6379,env:CACHE"`
-	// TODO: Cache TTL
-	LogFile string `conf:"env:LOG_FILE"`
+	ConfigFile  string `conf:"env:CONFIG_FILE,help:YAML or TOML config file"`
+	PrintConfig bool   `conf:"help:print effective configuration and exit"`
+
+	Addr string `conf:"default::8080,env:ADDR"`
+	DSN  string `conf:"default:host=localhost user=postgres password=s3cr3t sslmode=disable,env:DSN,mask"`
+	// DSNFile overrides DSN with the content of a file (e.g. a mounted secret)
+	DSNFile   string        `conf:"env:DSN_FILE"`
+	CacheAddr string        `conf:"default:localhost:6379,env:CACHE"`
+	CacheTTL  time.Duration `conf:"default:1m,env:CACHE_TTL"`
+	LogFile   string        `conf:"env:LOG_FILE"`
+
+	TLS struct {
+		Cert string `conf:"default:cert.pem,env:TLS_CERT"`
+		Key  string `conf:"default:key.pem,env:TLS_KEY"`
+		// Warn (log & degraded readiness) when certificate expires sooner
+		ExpiryWarning time.Duration `conf:"default:720h,env:TLS_EXPIRY_WARNING"`
+		// Plain HTTP behind a TLS terminating proxy
+		Disable bool `conf:"env:TLS_DISABLE,help:serve plain HTTP (behind a TLS terminating proxy)"`
+
+		// Mutual TLS
+		ClientAuth string `conf:"default:none,env:TLS_CLIENT_AUTH,help:none|optional|require"`
+		ClientCA   string `conf:"env:TLS_CLIENT_CA,help:CA bundle to verify client certificates"`
+		// Client certificate identity to role, e.g. batch.unter.internal:writer
+		ClientRoles map[string]string `conf:"env:TLS_CLIENT_ROLES"`
+	}
+
+	HTTP HTTPConfig
+
+	Reload struct {
+		// Poll config and certificate files for changes, 0 means SIGHUP only
+		WatchInterval time.Duration `conf:"default:0s,env:RELOAD_WATCH_INTERVAL"`
+	}
+
+	ShutdownGrace time.Duration `conf:"default:10s,env:SHUTDOWN_GRACE,help:time to drain in-flight work"`
+	ShutdownDelay time.Duration `conf:"default:0s,env:SHUTDOWN_DELAY,help:time between failing readiness and closing listener"`
+
+	AccessLog struct {
+		Format     string  `conf:"default:json,env:ACCESS_LOG_FORMAT,help:json|combined|off"`
+		SampleRate float64 `conf:"default:1,env:ACCESS_LOG_SAMPLE_RATE,help:fraction of 2xx to log on sampled routes"`
+		// Hot routes, empty means all
+		SampledRoutes []string `conf:"default:/health;/rides/{id},env:ACCESS_LOG_SAMPLED_ROUTES"`
+	}
+
+	Probe ProbeConfig
+
+	Events struct {
+		// Recent events kept for Last-Event-ID resumption
+		History   int           `conf:"default:1000,env:EVENTS_HISTORY"`
+		Heartbeat time.Duration `conf:"default:15s,env:EVENTS_HEARTBEAT,help:keep-alive comment interval"`
+	}
+
+	Webhooks struct {
+		Timeout      time.Duration `conf:"default:5s,env:WEBHOOKS_TIMEOUT,help:delivery request timeout"`
+		MaxAttempts  int           `conf:"default:8,env:WEBHOOKS_MAX_ATTEMPTS,help:attempts before a delivery is dead"`
+		PollInterval time.Duration `conf:"default:1s,env:WEBHOOKS_POLL_INTERVAL"`
+	}
+
+	Outbox OutboxConfig
+
+	GPS GPSConfig
+
+	Drivers struct {
+		// Drivers without a heartbeat are offline
+		HeartbeatTTL time.Duration `conf:"default:2m,env:DRIVERS_HEARTBEAT_TTL"`
+	}
+
+	Ratings RatingsConfig
+
+	Fares FaresConfig
+
+	Estimates EstimatesConfig
+
+	Dispatch struct {
+		OfferTimeout time.Duration `conf:"default:15s,env:DISPATCH_OFFER_TIMEOUT,help:time a driver has to accept"`
+		Radius       float64       `conf:"default:5,env:DISPATCH_RADIUS,help:miles around pickup"`
+		MaxOffers    int           `conf:"default:5,env:DISPATCH_MAX_OFFERS,help:offers before a request is unmatched"`
+		Precision    int           `conf:"default:6,env:DISPATCH_PRECISION,help:geohash precision of the driver index"`
+	}
+
+	Zones struct {
+		// Rides must start in a zone, empty disables zones
+		File string `conf:"env:ZONES_FILE,help:GeoJSON service zones"`
+	}
+
+	Trace struct {
+		Exporter string `conf:"default:none,env:TRACE_EXPORTER,help:none|stdout|file"`
+		File     string `conf:"default:trace.jsonl,env:TRACE_FILE"`
+	}
+
+	provenance map[string]string // field path -> source
+}
+
+type HTTPConfig struct {
+	ReadTimeout       time.Duration `conf:"default:1s,env:HTTP_READ_TIMEOUT"`
+	ReadHeaderTimeout time.Duration `conf:"default:500ms,env:HTTP_READ_HEADER_TIMEOUT"`
+	WriteTimeout      time.Duration `conf:"default:2s,env:HTTP_WRITE_TIMEOUT"`
+	IdleTimeout       time.Duration `conf:"default:1m,env:HTTP_IDLE_TIMEOUT"`
+	MaxBodySize       int64         `conf:"default:3000000,env:HTTP_MAX_BODY_SIZE,help:in bytes"`
+	// IPs or CIDRs allowed to set X-Forwarded-For
+	TrustedProxies []string `conf:"env:HTTP_TRUSTED_PROXIES"`
+}
+
+func (c HTTPConfig) Validate() error {
+	timeouts := []struct {
+		name  string
+		value time.Duration
+	}{
+		{"read", c.ReadTimeout},
+		{"read header", c.ReadHeaderTimeout},
+		{"write", c.WriteTimeout},
+		{"idle", c.IdleTimeout},
+	}
+	for _, t := range timeouts {
+		if t.value <= 0 {
+			return fmt.Errorf("%s timeout must be positive (got %v)", t.name, t.value)
+		}
+	}
+
+	if c.ReadHeaderTimeout > c.ReadTimeout {
+		return fmt.Errorf("read header timeout (%v) > read timeout (%v)", c.ReadHeaderTimeout, c.ReadTimeout)
+	}
+
+	if c.MaxBodySize <= 0 {
+		return fmt.Errorf("max body size must be positive (got %d)", c.MaxBodySize)
+	}
+
+	if _, err := ParseTrustedProxies(c.TrustedProxies); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+type ProbeConfig struct {
+	TTL          time.Duration `conf:"default:2s,env:PROBE_TTL,help:readiness results cache time"`
+	DBTimeout    time.Duration `conf:"default:1s,env:PROBE_DB_TIMEOUT"`
+	CacheTimeout time.Duration `conf:"default:500ms,env:PROBE_CACHE_TIMEOUT"`
+}
+
+type OutboxConfig struct {
+	Sinks        []string      `conf:"default:events;webhook,env:OUTBOX_SINKS,help:events|webhook|stream|log"`
+	PollInterval time.Duration `conf:"default:500ms,env:OUTBOX_POLL_INTERVAL"`
+	MaxAttempts  int           `conf:"default:10,env:OUTBOX_MAX_ATTEMPTS,help:attempts before an event is dead"`
+	// Published rows are deleted after Retention
+	Retention    time.Duration `conf:"default:24h,env:OUTBOX_RETENTION"`
+	Stream       string        `conf:"default:unter:rides,env:OUTBOX_STREAM,help:redis stream for the stream sink"`
+	StreamMaxLen int64         `conf:"default:100000,env:OUTBOX_STREAM_MAX_LEN"`
+}
+
+func (c OutboxConfig) Validate() error {
+	for _, name := range c.Sinks {
+		if !contains(sinkNames, name) {
+			return fmt.Errorf("unknown sink: %q", name)
+		}
+	}
+
+	if c.PollInterval <= 0 || c.MaxAttempts <= 0 {
+		return fmt.Errorf("poll interval and max attempts must be positive")
+	}
+
+	if c.Retention < 0 || c.StreamMaxLen < 0 {
+		return fmt.Errorf("negative retention or stream max length")
+	}
+
+	return nil
+}
+
+func contains(values []string, v string) bool {
+	for _, s := range values {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+type GPSConfig struct {
+	MaxSpeed  float64 `conf:"default:120,env:GPS_MAX_SPEED,help:mph - faster moves are GPS jumps"`
+	Tolerance float64 `conf:"default:0.25,env:GPS_TOLERANCE,help:reported vs. GPS distance ratio to flag"`
+	// Locations per request
+	MaxBatch int `conf:"default:1000,env:GPS_MAX_BATCH"`
+}
+
+type FaresConfig struct {
+	BookingFee int     `conf:"default:0,env:FARES_BOOKING_FEE,help:¢ surcharge per ride"`
+	TaxRate    float64 `conf:"default:0,env:FARES_TAX_RATE,help:tax on fare and surcharges (0.17 is 17%)"`
+	MaxTip     int     `conf:"default:10000,env:FARES_MAX_TIP,help:¢ maximum tip per ride"`
+}
+
+type EstimatesConfig struct {
+	TTL time.Duration `conf:"default:15m,env:ESTIMATES_TTL,help:time to start a ride with a quote"`
+	// Similar past rides give the expected speed
+	History time.Duration `conf:"default:2160h,env:ESTIMATES_HISTORY,help:age of past rides used"`
+	Slack   float64       `conf:"default:0.25,env:ESTIMATES_SLACK,help:distance ratio of similar rides"`
+}
+
+type RatingsConfig struct {
+	Window time.Duration `conf:"default:72h,env:RATINGS_WINDOW,help:time after a ride ends to rate it"`
+	// Driver rating is the weighted average of the last ratings
+	Last       int     `conf:"default:100,env:RATINGS_LAST,help:ratings in the driver rating"`
+	Threshold  float64 `conf:"default:4.5,env:RATINGS_THRESHOLD,help:drivers rated below are flagged for review"`
+	MinRatings int     `conf:"default:20,env:RATINGS_MIN,help:ratings before a driver can be flagged"`
 }
 
 func loadConfig() (Config, error) {
+	var args []string
+	if len(os.Args) > 1 {
+		args = os.Args[1:]
+	}
+
 	var c Config
-	if _, err := conf.Parse("UNTER", &c); err != nil {
+	var parsers []conf.Parsers
+	file := &fileParser{path: configFileArg(args)}
+	if file.path != "" {
+		parsers = append(parsers, file)
+	}
+	if _, err := conf.Parse(envPrefix, &c, parsers...); err != nil {
 		return Config{}, err
 	}
+	if file.path != "" {
+		file.restore(envPrefix, &c, args)
+	}
+
+	if c.DSNFile != "" {
+		data, err := os.ReadFile(c.DSNFile)
+		if err != nil {
+			return Config{}, fmt.Errorf("DSN file: %w", err)
+		}
+		c.DSN = strings.TrimSpace(string(data))
+	}
+	c.provenance = provenance(&c, args, file.set)
 
 	if err := c.Validate(); err != nil {
 		return Config{}, err
@@ -36,6 +261,24 @@ func loadConfig() (Config, error) {
 	return c, nil
 }
 
+// configFileArg returns the config file from command line or environment.
+// It's needed before conf parses the rest of the configuration.
+func configFileArg(args []string) string {
+	for i, a := range args {
+		if a == "--" {
+			break
+		}
+		switch {
+		case a == "--config-file" && i+1 < len(args):
+			return args[i+1]
+		case strings.HasPrefix(a, "--config-file="):
+			return a[len("--config-file="):]
+		}
+	}
+
+	return os.Getenv(envPrefix + "_CONFIG_FILE")
+}
+
 func (c Config) Validate() error {
 	if err := validAddr(c.Addr); err != nil {
 		return fmt.Errorf("bad port: %s", err)
@@ -45,6 +288,105 @@ func (c Config) Validate() error {
 		return fmt.Errorf("missing DSN")
 	}
 
+	if c.CacheTTL <= 0 {
+		return fmt.Errorf("cache TTL must be positive")
+	}
+
+	if !c.TLS.Disable && (c.TLS.Cert == "" || c.TLS.Key == "") {
+		return fmt.Errorf("missing TLS cert or key (set TLS_DISABLE for plain HTTP)")
+	}
+
+	if c.Reload.WatchInterval < 0 {
+		return fmt.Errorf("negative reload watch interval")
+	}
+
+	if _, err := clientAuthType(c.TLS.ClientAuth); err != nil {
+		return err
+	}
+
+	if c.TLS.ClientAuth != "none" {
+		if c.TLS.Disable {
+			return fmt.Errorf("client certificates require TLS")
+		}
+		if c.TLS.ClientCA == "" {
+			return fmt.Errorf("missing client CA for client auth %q", c.TLS.ClientAuth)
+		}
+	}
+
+	if _, err := ParseCertRoles(c.TLS.ClientRoles); err != nil {
+		return err
+	}
+
+	if err := c.HTTP.Validate(); err != nil {
+		return fmt.Errorf("http: %w", err)
+	}
+
+	switch c.AccessLog.Format {
+	case jsonFormat, combinedFormat, "off":
+	default:
+		return fmt.Errorf("unknown access log format: %q", c.AccessLog.Format)
+	}
+
+	if c.AccessLog.SampleRate < 0 || c.AccessLog.SampleRate > 1 {
+		return fmt.Errorf("access log sample rate %f out of range [0,1]", c.AccessLog.SampleRate)
+	}
+
+	if c.ShutdownGrace <= 0 {
+		return fmt.Errorf("shutdown grace must be positive")
+	}
+
+	if c.ShutdownDelay < 0 || c.ShutdownDelay >= c.ShutdownGrace {
+		return fmt.Errorf("shutdown delay must be in [0,%v)", c.ShutdownGrace)
+	}
+
+	if c.Probe.DBTimeout <= 0 || c.Probe.CacheTimeout <= 0 {
+		return fmt.Errorf("probe timeouts must be positive")
+	}
+
+	if c.Events.History < 0 || c.Events.Heartbeat <= 0 {
+		return fmt.Errorf("events: history must be >= 0 and heartbeat positive")
+	}
+
+	if c.Webhooks.Timeout <= 0 || c.Webhooks.PollInterval <= 0 || c.Webhooks.MaxAttempts <= 0 {
+		return fmt.Errorf("webhooks: timeout, poll interval and max attempts must be positive")
+	}
+
+	if err := c.Outbox.Validate(); err != nil {
+		return fmt.Errorf("outbox: %w", err)
+	}
+
+	if c.GPS.MaxSpeed <= 0 || c.GPS.Tolerance <= 0 || c.GPS.MaxBatch <= 0 {
+		return fmt.Errorf("gps: max speed, tolerance and max batch must be positive")
+	}
+
+	if c.Fares.MaxTip < 0 {
+		return fmt.Errorf("fares: negative max tip")
+	}
+	if err := c.Fares.extras(0).Validate(); err != nil {
+		return fmt.Errorf("fares: %w", err)
+	}
+
+	if c.Estimates.TTL <= 0 || c.Estimates.History <= 0 || c.Estimates.Slack <= 0 || c.Estimates.Slack >= 1 {
+		return fmt.Errorf("estimates: ttl and history must be positive and slack in (0,1)")
+	}
+
+	if c.Ratings.Window <= 0 || c.Ratings.Last <= 0 || c.Ratings.MinRatings < 0 {
+		return fmt.Errorf("ratings: window and last must be positive")
+	}
+	if c.Ratings.Threshold < unter.MinStars || c.Ratings.Threshold > unter.MaxStars {
+		return fmt.Errorf("ratings: threshold %.2f out of range [%d,%d]", c.Ratings.Threshold, unter.MinStars, unter.MaxStars)
+	}
+
+	switch c.Trace.Exporter {
+	case "none", "stdout":
+	case "file":
+		if c.Trace.File == "" {
+			return fmt.Errorf("missing trace file")
+		}
+	default:
+		return fmt.Errorf("unknown trace exporter: %q", c.Trace.Exporter)
+	}
+
 	return nil
 }
 
@@ -0,0 +1,514 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/353solutions/unter/logger"
+)
+
+// fileParser is a conf.Parsers that loads a YAML or TOML config file.
+// Keys match field names ignoring case, "_" and "-" (e.g. cache_ttl, CacheTTL).
+// Since it runs before conf applies defaults, environment and flags override
+// values from the file. conf also sets defaults on fields that are still zero,
+// call restore after conf.Parse to keep zero values from the file.
+type fileParser struct {
+	path   string
+	set    map[string]bool          // field paths set by the file
+	values map[string]reflect.Value // field path -> value from the file
+}
+
+func (p *fileParser) Process(prefix string, cfg interface{}) error {
+	data, err := os.ReadFile(p.path)
+	if err != nil {
+		return err
+	}
+
+	m, err := parseConfigFile(p.path, data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", p.path, err)
+	}
+
+	p.set = make(map[string]bool)
+	if err := applyMap(reflect.ValueOf(cfg).Elem(), m, "", p.set); err != nil {
+		return err
+	}
+
+	p.values = make(map[string]reflect.Value)
+	for _, f := range configFields(prefix, cfg) {
+		if p.set[f.Path] {
+			v := reflect.New(f.Value.Type()).Elem()
+			v.Set(f.Value)
+			p.values[f.Path] = v
+		}
+	}
+	return nil
+}
+
+// restore sets fields from the file back in cfg, unless args or the
+// environment override them.
+func (p *fileParser) restore(prefix string, cfg any, args []string) {
+	for _, f := range configFields(prefix, cfg) {
+		v, ok := p.values[f.Path]
+		if !ok || flagSet(args, f.Flag) || os.Getenv(f.Env) != "" {
+			continue
+		}
+		f.Value.Set(v)
+	}
+}
+
+func parseConfigFile(path string, data []byte) (map[string]any, error) {
+	m := make(map[string]any)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(data, &m); err != nil {
+			return nil, err
+		}
+	case ".toml":
+		var err error
+		m, err = parseTOML(data)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown config file type (want .yaml, .yml or .toml)")
+	}
+
+	return m, nil
+}
+
+func normKey(s string) string {
+	s = strings.ToLower(s)
+	s = strings.ReplaceAll(s, "_", "")
+	return strings.ReplaceAll(s, "-", "")
+}
+
+// applyMap sets fields in v from m, recording field paths set in set.
+func applyMap(v reflect.Value, m map[string]any, prefix string, set map[string]bool) error {
+	t := v.Type()
+	fields := make(map[string]int) // normalized name -> index
+	for i := 0; i < t.NumField(); i++ {
+		if !v.Field(i).CanSet() || t.Field(i).Tag.Get("conf") == "-" {
+			continue
+		}
+		fields[normKey(t.Field(i).Name)] = i
+	}
+
+	for key, raw := range m {
+		i, ok := fields[normKey(key)]
+		if !ok {
+			return fmt.Errorf("unknown key: %q", prefix+key)
+		}
+
+		f, sf := v.Field(i), t.Field(i)
+		path := prefix + sf.Name
+		if isStruct(f) {
+			sub, ok := raw.(map[string]any)
+			if !ok {
+				return fmt.Errorf("%s: expected a table/mapping", path)
+			}
+			if err := applyMap(f, sub, path+".", set); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := setField(f, raw); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		set[path] = true
+	}
+
+	return nil
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func isStruct(v reflect.Value) bool {
+	return v.Kind() == reflect.Struct
+}
+
+func setField(f reflect.Value, raw any) error {
+	if f.Kind() == reflect.Slice {
+		items, ok := raw.([]any)
+		if !ok {
+			items = []any{raw}
+		}
+		sl := reflect.MakeSlice(f.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := setField(sl.Index(i), item); err != nil {
+				return err
+			}
+		}
+		f.Set(sl)
+		return nil
+	}
+
+	if f.Kind() == reflect.Map {
+		items, ok := raw.(map[string]any)
+		if !ok {
+			return fmt.Errorf("expected a table/mapping")
+		}
+		m := reflect.MakeMapWithSize(f.Type(), len(items))
+		for k, item := range items {
+			key := reflect.New(f.Type().Key()).Elem()
+			if err := setField(key, k); err != nil {
+				return err
+			}
+			val := reflect.New(f.Type().Elem()).Elem()
+			if err := setField(val, item); err != nil {
+				return err
+			}
+			m.SetMapIndex(key, val)
+		}
+		f.Set(m)
+		return nil
+	}
+
+	s := fmt.Sprint(raw)
+	switch {
+	case f.Type() == durationType:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		f.SetInt(int64(d))
+	case f.Kind() == reflect.String:
+		f.SetString(s)
+	case f.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		f.SetBool(b)
+	case f.Kind() >= reflect.Int && f.Kind() <= reflect.Int64:
+		n, err := strconv.ParseInt(s, 0, 64)
+		if err != nil {
+			return err
+		}
+		f.SetInt(n)
+	case f.Kind() == reflect.Float32 || f.Kind() == reflect.Float64:
+		x, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		f.SetFloat(x)
+	default:
+		return fmt.Errorf("unsupported type: %s", f.Type())
+	}
+
+	return nil
+}
+
+// parseTOML parses the subset of TOML used for configuration: [tables],
+// key = value with strings, numbers, booleans and single line arrays.
+func parseTOML(data []byte) (map[string]any, error) {
+	root := make(map[string]any)
+	table := root
+
+	s := bufio.NewScanner(bytes.NewReader(data))
+	lnum := 0
+	for s.Scan() {
+		lnum++
+		line := strings.TrimSpace(stripComment(s.Text()))
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("%d: bad table", lnum)
+			}
+			table = root
+			for _, name := range strings.Split(line[1:len(line)-1], ".") {
+				name = strings.TrimSpace(name)
+				sub, ok := table[name].(map[string]any)
+				if !ok {
+					sub = make(map[string]any)
+					table[name] = sub
+				}
+				table = sub
+			}
+			continue
+		}
+
+		i := strings.Index(line, "=")
+		if i == -1 {
+			return nil, fmt.Errorf("%d: missing '='", lnum)
+		}
+		key := strings.TrimSpace(line[:i])
+		val, err := tomlValue(strings.TrimSpace(line[i+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("%d: %w", lnum, err)
+		}
+		table[key] = val
+	}
+
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+// stripComment removes a trailing # comment that's not inside a string.
+func stripComment(line string) string {
+	var quote rune
+	for i, c := range line {
+		switch {
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case quote == 0 && c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+func tomlValue(s string) (any, error) {
+	switch {
+	case s == "":
+		return nil, fmt.Errorf("missing value")
+	case strings.HasPrefix(s, `"`):
+		return strconv.Unquote(s)
+	case strings.HasPrefix(s, "'"):
+		if len(s) < 2 || !strings.HasSuffix(s, "'") {
+			return nil, fmt.Errorf("bad string: %s", s)
+		}
+		return s[1 : len(s)-1], nil
+	case strings.HasPrefix(s, "["):
+		if !strings.HasSuffix(s, "]") {
+			return nil, fmt.Errorf("bad array: %s", s)
+		}
+		var items []any
+		for _, item := range splitArray(s[1 : len(s)-1]) {
+			v, err := tomlValue(item)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, v)
+		}
+		return items, nil
+	case s == "true" || s == "false":
+		return s == "true", nil
+	}
+
+	// Numbers, may contain _ separators
+	n := strings.ReplaceAll(s, "_", "")
+	if _, err := strconv.ParseFloat(n, 64); err != nil {
+		return nil, fmt.Errorf("bad value: %s", s)
+	}
+	return n, nil
+}
+
+func splitArray(s string) []string {
+	var items []string
+	var quote rune
+	start := 0
+	for i, c := range s {
+		switch {
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case quote == 0 && c == ',':
+			items = append(items, s[start:i])
+			start = i + 1
+		}
+	}
+	items = append(items, s[start:])
+
+	var out []string
+	for _, item := range items {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// configField is a leaf field of Config with its conf names.
+type configField struct {
+	Path  string // e.g. HTTP.ReadTimeout
+	Flag  string // e.g. http-read-timeout
+	Env   string // e.g. UNTER_HTTP_READ_TIMEOUT
+	Mask  bool
+	Value reflect.Value
+}
+
+// configFields returns the leaf fields of cfg (a pointer to struct) using the
+// same naming rules as conf.
+func configFields(prefix string, cfg any) []configField {
+	var fields []configField
+	var walk func(v reflect.Value, path, flag []string)
+	walk = func(v reflect.Value, path, flag []string) {
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f, sf := v.Field(i), t.Field(i)
+			tag := sf.Tag.Get("conf")
+			if !f.CanSet() || tag == "-" {
+				continue
+			}
+
+			p := append(append([]string{}, path...), sf.Name)
+			fk := append(append([]string{}, flag...), camelSplit(sf.Name)...)
+			if isStruct(f) {
+				walk(f, p, fk)
+				continue
+			}
+
+			cf := configField{
+				Path:  strings.Join(p, "."),
+				Flag:  strings.ToLower(strings.Join(fk, "-")),
+				Env:   strings.ToUpper(prefix + "_" + strings.Join(fk, "_")),
+				Value: f,
+			}
+			for _, opt := range strings.Split(tag, ",") {
+				switch {
+				case opt == "mask":
+					cf.Mask = true
+				case strings.HasPrefix(opt, "env:"):
+					cf.Env = strings.ToUpper(prefix + "_" + opt[len("env:"):])
+				case strings.HasPrefix(opt, "flag:"):
+					cf.Flag = opt[len("flag:"):]
+				}
+			}
+			fields = append(fields, cf)
+		}
+	}
+	walk(reflect.ValueOf(cfg).Elem(), nil, nil)
+
+	return fields
+}
+
+// camelSplit splits "CacheTTL" to ["Cache", "TTL"].
+func camelSplit(s string) []string {
+	var words []string
+	runes := []rune(s)
+	start := 0
+	for i := 1; i < len(runes); i++ {
+		prev, cur := runes[i-1], runes[i]
+		next := unicode.IsLower(cur)
+		if i+1 < len(runes) {
+			next = unicode.IsLower(runes[i+1])
+		}
+		switch {
+		case unicode.IsLower(prev) && unicode.IsUpper(cur):
+		case unicode.IsUpper(prev) && unicode.IsUpper(cur) && next:
+		default:
+			continue
+		}
+		words = append(words, string(runes[start:i]))
+		start = i
+	}
+	return append(words, string(runes[start:]))
+}
+
+// flagSet reports if the flag was given in args.
+func flagSet(args []string, name string) bool {
+	for _, a := range args {
+		if a == "--" {
+			return false
+		}
+		a = strings.TrimLeft(a, "-")
+		if a == name || strings.HasPrefix(a, name+"=") {
+			return true
+		}
+	}
+	return false
+}
+
+// provenance returns the source of every config field: default, file, env or
+// flag.
+func provenance(cfg *Config, args []string, fileKeys map[string]bool) map[string]string {
+	src := make(map[string]string)
+	for _, f := range configFields(envPrefix, cfg) {
+		s := "default"
+		switch {
+		case flagSet(args, f.Flag):
+			s = "flag --" + f.Flag
+		case os.Getenv(f.Env) != "":
+			s = "env " + f.Env
+		case fileKeys[f.Path]:
+			s = "file"
+		}
+		src[f.Path] = s
+	}
+
+	if cfg.DSNFile != "" {
+		src["DSN"] = "secret file " + cfg.DSNFile
+	}
+
+	return src
+}
+
+// Dump returns the effective configuration, one field per line, with
+// secrets masked and where each value came from.
+func (c *Config) Dump() string {
+	var lines []string
+	for _, f := range configFields(envPrefix, c) {
+		val := fmt.Sprint(f.Value.Interface())
+		if f.Value.Kind() == reflect.Slice {
+			items := make([]string, f.Value.Len())
+			for i := range items {
+				items[i] = fmt.Sprint(f.Value.Index(i).Interface())
+			}
+			val = strings.Join(items, ";") // conf slice syntax
+		}
+		if f.Mask && val != "" {
+			val = logger.Masked
+		}
+		src := c.provenance[f.Path]
+		if src == "" {
+			src = "default"
+		}
+		lines = append(lines, fmt.Sprintf("%s=%s (%s)", f.Flag, val, src))
+	}
+	sort.Strings(lines)
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// Secrets returns secret values that should never appear in logs.
+func (c *Config) Secrets() []string {
+	var secrets []string
+	if p := dsnPassword(c.DSN); p != "" {
+		secrets = append(secrets, p)
+	}
+	return secrets
+}
+
+// dsnPassword returns the password in a key=value or URL style DSN.
+func dsnPassword(dsn string) string {
+	if strings.Contains(dsn, "://") {
+		i := strings.Index(dsn, "://") + 3
+		j := strings.Index(dsn[i:], "@")
+		if j == -1 {
+			return ""
+		}
+		userInfo := dsn[i : i+j]
+		if k := strings.Index(userInfo, ":"); k != -1 {
+			return userInfo[k+1:]
+		}
+		return ""
+	}
+
+	for _, field := range strings.Fields(dsn) {
+		if strings.HasPrefix(field, "password=") {
+			return strings.Trim(field[len("password="):], "'")
+		}
+	}
+	return ""
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/353solutions/unter"
+	"github.com/353solutions/unter/db"
+	"github.com/353solutions/unter/dispatch"
+	"github.com/353solutions/unter/events"
+	"github.com/353solutions/unter/geo"
+)
+
+/* Ride requests
+
+POST /ride-requests               (rider) {"lat": 32.07, "lon": 34.78, "kind": "private"}
+GET  /ride-requests/{id}          (rider, offered driver or Admin)
+POST /ride-requests/{id}/cancel   (rider)
+GET  /drivers/me/offer            (driver) 204 if there's no offer
+POST /ride-requests/{id}/accept   (driver) starts the ride
+POST /ride-requests/{id}/decline  (driver)
+
+Online drivers are indexed by their heartbeat location, see drivers.go.
+*/
+
+type PickupResponse struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+type RideRequestResponse struct {
+	ID      string         `json:"id"`
+	Status  string         `json:"status"`
+	Kind    string         `json:"kind"`
+	Pickup  PickupResponse `json:"pickup"`
+	Driver  string         `json:"driver,omitempty"`
+	Expires *time.Time     `json:"expires,omitempty"` // offer expiry
+	RideID  string         `json:"ride_id,omitempty"`
+}
+
+func rideRequestResponse(r dispatch.Request) RideRequestResponse {
+	resp := RideRequestResponse{
+		ID:     r.ID,
+		Status: r.Status.String(),
+		Kind:   r.Kind.String(),
+		Pickup: PickupResponse{r.Pickup.Lat, r.Pickup.Lon},
+		Driver: r.Driver,
+		RideID: r.RideID,
+	}
+	if r.Status == dispatch.Offered && !r.Expires.IsZero() {
+		resp.Expires = &r.Expires
+	}
+	return resp
+}
+
+type OfferResponse struct {
+	RequestID string         `json:"request_id"`
+	Kind      string         `json:"kind"`
+	Pickup    PickupResponse `json:"pickup"`
+	Distance  float64        `json:"distance"` // miles to pickup
+	Expires   time.Time      `json:"expires"`
+}
+
+// acceptRide is the matcher OnAccept, it starts the ride for the driver that
+// accepted r. Drivers that can't start rides (e.g. went offline) fail and the
+// request is offered to the next driver.
+func (s *Server) acceptRide(ctx context.Context, r dispatch.Request) (string, error) {
+	d, err := s.driver(ctx, r.Driver)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now().UTC()
+	if err := d.CanStart(now, s.driverTTL); err != nil {
+		return "", err
+	}
+
+	car, err := s.rideVehicle(ctx, r.Driver, "", r.Kind, 1)
+	if err != nil {
+		return "", err
+	}
+
+	pos := &db.Position{Lat: r.Pickup.Lat, Lon: r.Pickup.Lon}
+	zone, err := s.startZone(pos)
+	if err != nil {
+		return "", err
+	}
+
+	rd := unter.Ride{
+		ID:     unter.NewID(),
+		Driver: r.Driver,
+		CarID:  car.ID,
+		Kind:   r.Kind,
+		Start:  now,
+		Riders: []string{r.Rider},
+	}
+	if err := rd.Validate(); err != nil {
+		return "", err
+	}
+
+	dbr := db.Ride{
+		ID:        rd.ID,
+		Driver:    rd.Driver,
+		CarID:     rd.CarID,
+		Kind:      rd.Kind.String(),
+		Start:     rd.Start,
+		StartPos:  pos,
+		StartZone: zone,
+		Riders:    rd.Riders,
+		QuoteID:   r.QuoteID, // checked on request
+	}
+	startLegs(&dbr)
+	if err := s.db.Add(ctx, dbr, rideEvent(events.RideStarted, dbr, dbr.Start)); err != nil {
+		return "", err
+	}
+	s.setAvailability(ctx, rd.Driver, unter.OnTrip)
+	ctxLogger(s.log, ctx).Printf("INFO: request %s: ride %s started by %s", r.ID, rd.ID, rd.Driver)
+	return rd.ID, nil
+}
+
+// updateMatcher adds d to matching if it can start rides at pos.
+func (s *Server) updateMatcher(d unter.Driver, pos *db.Position, now time.Time) {
+	if s.matcher == nil {
+		return
+	}
+
+	if pos == nil || d.CanStart(now, s.driverTTL) != nil {
+		s.matcher.SetUnavailable(d.Login)
+		return
+	}
+	s.matcher.SetAvailable(d.Login, geo.Point{Lat: pos.Lat, Lon: pos.Lon, Time: now})
+}
+
+// rideRequest returns the request with the id in the URL, it sends an error
+// and returns false if not found.
+func (s *Server) rideRequest(w http.ResponseWriter, r *http.Request) (dispatch.Request, bool) {
+	req, err := s.matcher.Get(mux.Vars(r)["id"])
+	if err != nil {
+		httpError(w, r, "not found", http.StatusNotFound)
+		return dispatch.Request{}, false
+	}
+	return req, true
+}
+
+func (s *Server) requestRideHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireRole(w, r, Rider) {
+		return
+	}
+
+	var req struct {
+		Kind       string
+		Lat        *float64
+		Lon        *float64
+		EstimateID string `json:"estimate_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, "bad json", http.StatusBadRequest)
+		return
+	}
+
+	k, err := kindFromString(req.Kind)
+	if err != nil {
+		httpError(w, r, "bad kind", http.StatusBadRequest)
+		return
+	}
+	pos, err := ridePosition(req.Lat, req.Lon)
+	if err == nil && pos == nil {
+		err = errMissingLocation
+	}
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, err := s.startZone(pos); err != nil {
+		httpError(w, r, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	login := RequestValues(r.Context()).User.Login
+	if err := s.checkRiders(r.Context(), []string{login}); err != nil {
+		httpError(w, r, "unknown rider", http.StatusForbidden)
+		return
+	}
+
+	now := time.Now().UTC()
+	if req.EstimateID != "" {
+		ride := unter.Ride{Kind: k, Start: now, Riders: []string{login}}
+		if _, err := s.rideQuote(r.Context(), req.EstimateID, ride); err != nil {
+			quoteError(w, r, err)
+			return
+		}
+	}
+
+	rr := dispatch.Request{
+		Rider:   login,
+		Kind:    k,
+		Pickup:  geo.Point{Lat: pos.Lat, Lon: pos.Lon, Time: now},
+		Created: now,
+		QuoteID: req.EstimateID,
+	}
+	rr, err = s.matcher.Request(rr)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ctxLogger(s.log, r.Context()).Printf("INFO: request %s by %s: %s", rr.ID, rr.Rider, rr.Status)
+
+	w.WriteHeader(http.StatusAccepted)
+	if err := sendJSON(w, rideRequestResponse(rr)); err != nil {
+		s.log.Printf("WARNING: can't send - %s", err)
+	}
+}
+
+func (s *Server) getRideRequestHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireRole(w, r, Rider, Writer, Admin) {
+		return
+	}
+	req, ok := s.rideRequest(w, r)
+	if !ok {
+		return
+	}
+
+	u := RequestValues(r.Context()).User
+	if u.Role != Admin && u.Login != req.Rider && u.Login != req.Driver {
+		httpError(w, r, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	if err := sendJSON(w, rideRequestResponse(req)); err != nil {
+		httpError(w, r, "can't marshal to JSON", http.StatusInternalServerError)
+	}
+}
+
+func (s *Server) cancelRideRequestHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireRole(w, r, Rider, Writer, Admin) {
+		return
+	}
+	req, ok := s.rideRequest(w, r)
+	if !ok {
+		return
+	}
+
+	u := RequestValues(r.Context()).User
+	if u.Role != Admin && u.Login != req.Rider {
+		httpError(w, r, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	req, err := s.matcher.Cancel(req.ID, time.Now().UTC())
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusConflict)
+		return
+	}
+
+	if err := sendJSON(w, rideRequestResponse(req)); err != nil {
+		httpError(w, r, "can't marshal to JSON", http.StatusInternalServerError)
+	}
+}
+
+func (s *Server) offerHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireRole(w, r, Writer) {
+		return
+	}
+
+	o, ok := s.matcher.Offer(RequestValues(r.Context()).User.Login)
+	if !ok || o.Expires.IsZero() {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	resp := OfferResponse{
+		RequestID: o.RequestID,
+		Kind:      o.Kind.String(),
+		Pickup:    PickupResponse{o.Pickup.Lat, o.Pickup.Lon},
+		Distance:  o.Distance,
+		Expires:   o.Expires,
+	}
+	if err := sendJSON(w, resp); err != nil {
+		httpError(w, r, "can't marshal to JSON", http.StatusInternalServerError)
+	}
+}
+
+// offerError sends the error of an accept or decline.
+func offerError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, dispatch.ErrNotFound):
+		httpError(w, r, "not found", http.StatusNotFound)
+	case errors.Is(err, dispatch.ErrNoOffer), errors.Is(err, dispatch.ErrDone), errors.Is(err, unter.ErrOffline):
+		httpError(w, r, err.Error(), http.StatusConflict)
+	case errors.Is(err, unter.ErrSuspended), errors.Is(err, unter.ErrLicenseExpired), errors.Is(err, unter.ErrOnTrip),
+		errors.Is(err, errNoVehicle), errors.Is(err, unter.ErrInspectionExpired),
+		errors.Is(err, unter.ErrCapacity), errors.Is(err, unter.ErrClass):
+		httpError(w, r, err.Error(), http.StatusForbidden)
+	default:
+		httpError(w, r, "can't start ride", http.StatusInternalServerError)
+	}
+}
+
+func (s *Server) acceptHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireRole(w, r, Writer) {
+		return
+	}
+
+	id, login := mux.Vars(r)["id"], RequestValues(r.Context()).User.Login
+	req, err := s.matcher.Accept(r.Context(), id, login, time.Now().UTC())
+	if err != nil {
+		ctxLogger(s.log, r.Context()).Printf("WARNING: request %s: %s can't accept - %s", id, login, err)
+		offerError(w, r, err)
+		return
+	}
+
+	if err := sendJSON(w, rideRequestResponse(req)); err != nil {
+		httpError(w, r, "can't marshal to JSON", http.StatusInternalServerError)
+	}
+}
+
+func (s *Server) declineHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireRole(w, r, Writer) {
+		return
+	}
+
+	id, login := mux.Vars(r)["id"], RequestValues(r.Context()).User.Login
+	if err := s.matcher.Decline(id, login, time.Now().UTC()); err != nil {
+		offerError(w, r, err)
+		return
+	}
+
+	resp := map[string]any{
+		"id":     id,
+		"action": "decline",
+	}
+	if err := sendJSON(w, resp); err != nil {
+		httpError(w, r, "can't marshal to JSON", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/353solutions/unter"
+	"github.com/353solutions/unter/db"
+	"github.com/353solutions/unter/dispatch"
+	"github.com/353solutions/unter/geo"
+)
+
+func TestRideRequestOffers(t *testing.T) {
+	require := require.New(t)
+
+	s := Server{
+		log:       log.New(io.Discard, "", 0),
+		driverTTL: time.Minute,
+	}
+	s.matcher = dispatch.NewMatcher(6, func(ctx context.Context, r dispatch.Request) (string, error) {
+		return "ride-1", nil
+	})
+
+	now := time.Now()
+	for login, lon := range map[string]float64{"bond": 34.79, "q": 34.80} {
+		d := unter.Driver{
+			Login:        login,
+			License:      unter.License{Expires: now.Add(time.Hour)},
+			State:        unter.Active,
+			Availability: unter.Online,
+			LastSeen:     now,
+		}
+		s.updateMatcher(d, &db.Position{Lat: 32.08, Lon: lon}, now)
+	}
+
+	// POST /ride-requests needs the riders table
+	rr, err := s.matcher.Request(dispatch.Request{
+		Rider:   "m",
+		Kind:    unter.Private,
+		Pickup:  geo.Point{Lat: 32.08, Lon: 34.78, Time: now},
+		Created: now,
+	})
+	require.NoError(err)
+	req := rideRequestResponse(rr)
+	require.Equal("offered", req.Status)
+	require.Equal("bond", req.Driver)
+
+	// Not offered to q
+	w := httptest.NewRecorder()
+	s.offerHandler(w, userRequest(http.MethodGet, "/drivers/me/offer", "", User{"q", Writer}, nil))
+	require.Equal(http.StatusNoContent, w.Code)
+
+	w = httptest.NewRecorder()
+	vars := map[string]string{"id": req.ID}
+	s.declineHandler(w, userRequest(http.MethodPost, "/ride-requests/x/decline", "", User{"bond", Writer}, vars))
+	require.Equal(http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	s.offerHandler(w, userRequest(http.MethodGet, "/drivers/me/offer", "", User{"q", Writer}, nil))
+	require.Equal(http.StatusOK, w.Code)
+	var offer OfferResponse
+	require.NoError(json.NewDecoder(w.Body).Decode(&offer))
+	require.Equal(req.ID, offer.RequestID)
+
+	// Only the rider (or the offered driver) can see the request
+	w = httptest.NewRecorder()
+	s.getRideRequestHandler(w, userRequest(http.MethodGet, "/ride-requests/x", "", User{"bond", Writer}, vars))
+	require.Equal(http.StatusForbidden, w.Code)
+
+	w = httptest.NewRecorder()
+	s.acceptHandler(w, userRequest(http.MethodPost, "/ride-requests/x/accept", "", User{"q", Writer}, vars))
+	require.Equal(http.StatusOK, w.Code)
+	require.NoError(json.NewDecoder(w.Body).Decode(&req))
+	require.Equal("accepted", req.Status)
+	require.Equal("ride-1", req.RideID)
+
+	// Suspended drivers are not matched
+	d := unter.Driver{Login: "bond", State: unter.Suspended, Availability: unter.Online, LastSeen: now}
+	s.updateMatcher(d, &db.Position{Lat: 32.08, Lon: 34.79}, now)
+	rr, err = s.matcher.Request(dispatch.Request{
+		Rider:   "m",
+		Kind:    unter.Shared,
+		Pickup:  geo.Point{Lat: 32.08, Lon: 34.78, Time: now},
+		Created: now,
+	})
+	require.NoError(err)
+	require.Equal(dispatch.Unmatched, rr.Status)
+
+	// Drivers can't request rides
+	w = httptest.NewRecorder()
+	s.requestRideHandler(w, userRequest(http.MethodPost, "/ride-requests", `{"kind": "shared", "lat": 32.08, "lon": 34.78}`, User{"q", Writer}, nil))
+	require.Equal(http.StatusForbidden, w.Code)
+}
+
+func TestAcceptOffline(t *testing.T) {
+	require := require.New(t)
+
+	s := Server{
+		log:       log.New(io.Discard, "", 0),
+		driverTTL: time.Minute,
+	}
+	s.matcher = dispatch.NewMatcher(6, func(ctx context.Context, r dispatch.Request) (string, error) {
+		if r.Driver == "bond" {
+			return "", unter.ErrOffline // see acceptRide
+		}
+		return "ride-1", nil
+	})
+
+	now := time.Now()
+	for login, lon := range map[string]float64{"bond": 34.79, "q": 34.80} {
+		d := unter.Driver{
+			Login:        login,
+			License:      unter.License{Expires: now.Add(time.Hour)},
+			State:        unter.Active,
+			Availability: unter.Online,
+			LastSeen:     now,
+		}
+		s.updateMatcher(d, &db.Position{Lat: 32.08, Lon: lon}, now)
+	}
+
+	rr, err := s.matcher.Request(dispatch.Request{
+		Rider:   "m",
+		Kind:    unter.Private,
+		Pickup:  geo.Point{Lat: 32.08, Lon: 34.78, Time: now},
+		Created: now,
+	})
+	require.NoError(err)
+	require.Equal("bond", rr.Driver)
+
+	w := httptest.NewRecorder()
+	vars := map[string]string{"id": rr.ID}
+	s.acceptHandler(w, userRequest(http.MethodPost, "/ride-requests/x/accept", "", User{"bond", Writer}, vars))
+	require.Equal(http.StatusConflict, w.Code)
+
+	// Offered to the next driver
+	w = httptest.NewRecorder()
+	s.offerHandler(w, userRequest(http.MethodGet, "/drivers/me/offer", "", User{"q", Writer}, nil))
+	require.Equal(http.StatusOK, w.Code)
+}
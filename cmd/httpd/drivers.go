@@ -0,0 +1,329 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/353solutions/unter"
+	"github.com/353solutions/unter/db"
+)
+
+/* Drivers
+
+POST /drivers                     (Admin) register a driver
+GET  /drivers/{login}             (Admin or the driver)
+POST /drivers/{login}/state       (Admin) {"state": "suspended"}
+POST /drivers/me/heartbeat        (driver) {"status": "online", "lat": 32.07, "lon": 34.78}
+
+Drivers send heartbeats while the app is open, a driver without a heartbeat
+in Drivers.HeartbeatTTL is offline. Online drivers with a location get ride
+requests, see dispatch.go.
+*/
+
+func driverStateFromString(s string) (unter.DriverState, error) {
+	for _, st := range []unter.DriverState{unter.Active, unter.Suspended} {
+		if s == st.String() {
+			return st, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown driver state: %s", s)
+}
+
+func availabilityFromString(s string) (unter.Availability, error) {
+	for _, a := range []unter.Availability{unter.Offline, unter.Online, unter.OnTrip} {
+		if s == a.String() {
+			return a, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown availability: %s", s)
+}
+
+func driverFromDB(d db.Driver) (unter.Driver, error) {
+	state, err := driverStateFromString(d.State)
+	if err != nil {
+		return unter.Driver{}, err
+	}
+	a, err := availabilityFromString(d.Availability)
+	if err != nil {
+		return unter.Driver{}, err
+	}
+
+	ud := unter.Driver{
+		Login:        d.Login,
+		Name:         d.Name,
+		Phone:        d.Phone,
+		License:      unter.License{Number: d.LicenseNumber, Expires: d.LicenseExpires},
+		Vehicle:      d.Vehicle,
+		State:        state,
+		Availability: a,
+		LastSeen:     d.LastSeen,
+	}
+	return ud, nil
+}
+
+// driver returns the driver with login.
+func (s *Server) driver(ctx context.Context, login string) (unter.Driver, error) {
+	d, err := s.db.Driver(ctx, login)
+	if err != nil {
+		return unter.Driver{}, err
+	}
+	return driverFromDB(d)
+}
+
+// setAvailability updates driver availability, it's best effort since the
+// next heartbeat fixes it.
+func (s *Server) setAvailability(ctx context.Context, login string, a unter.Availability) {
+	if a != unter.Online && s.matcher != nil {
+		s.matcher.SetUnavailable(login)
+	}
+	if err := s.db.SetDriverAvailability(ctx, login, a.String()); err != nil {
+		ctxLogger(s.log, ctx).Printf("WARNING: can't set %s availability to %s - %s", login, a, err)
+	}
+}
+
+type DriverResponse struct {
+	Login   string `json:"login"`
+	Name    string `json:"name"`
+	Phone   string `json:"phone,omitempty"`
+	License struct {
+		Number  string    `json:"number"`
+		Expires time.Time `json:"expires"`
+	} `json:"license"`
+	Vehicle      string     `json:"vehicle,omitempty"`
+	State        string     `json:"state"`
+	Availability string     `json:"availability"`
+	LastSeen     *time.Time `json:"last_seen,omitempty"`
+}
+
+func (s *Server) driverResponse(d unter.Driver) DriverResponse {
+	resp := DriverResponse{
+		Login:        d.Login,
+		Name:         d.Name,
+		Phone:        d.Phone,
+		Vehicle:      d.Vehicle,
+		State:        d.State.String(),
+		Availability: d.Status(time.Now(), s.driverTTL).String(),
+	}
+	resp.License.Number = d.License.Number
+	resp.License.Expires = d.License.Expires
+	if !d.LastSeen.IsZero() {
+		resp.LastSeen = &d.LastSeen
+	}
+	return resp
+}
+
+func (s *Server) addDriverHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireRole(w, r, Admin) {
+		return
+	}
+
+	var req struct {
+		Login   string
+		Name    string
+		Phone   string
+		License struct {
+			Number  string
+			Expires time.Time
+		}
+		Vehicle string
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, "bad json", http.StatusBadRequest)
+		return
+	}
+
+	d := unter.Driver{
+		Login:        strings.ToValidUTF8(req.Login, ""),
+		Name:         strings.ToValidUTF8(req.Name, ""),
+		Phone:        req.Phone,
+		License:      unter.License{Number: req.License.Number, Expires: req.License.Expires.UTC()},
+		Vehicle:      strings.ToValidUTF8(req.Vehicle, ""),
+		State:        unter.Active,
+		Availability: unter.Offline,
+	}
+	if err := d.Validate(); err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	dd := db.Driver{
+		Login:          d.Login,
+		Name:           d.Name,
+		Phone:          d.Phone,
+		LicenseNumber:  d.License.Number,
+		LicenseExpires: d.License.Expires,
+		Vehicle:        d.Vehicle,
+		State:          d.State.String(),
+		Availability:   d.Availability.String(),
+		Created:        time.Now().UTC(),
+	}
+	if err := s.db.AddDriver(r.Context(), dd); err != nil {
+		httpError(w, r, "can't insert", http.StatusInternalServerError)
+		return
+	}
+	ctxLogger(s.log, r.Context()).Printf("INFO: driver %s registered", d.Login)
+
+	w.WriteHeader(http.StatusCreated)
+	if err := sendJSON(w, s.driverResponse(d)); err != nil {
+		s.log.Printf("WARNING: can't send - %s", err)
+	}
+}
+
+func (s *Server) getDriverHandler(w http.ResponseWriter, r *http.Request) {
+	login := mux.Vars(r)["login"]
+	v := RequestValues(r.Context())
+	if v == nil || (v.User.Role != Admin && v.User.Login != login) {
+		httpError(w, r, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	d, err := s.driver(r.Context(), login)
+	switch {
+	case errors.Is(err, db.ErrNotFound):
+		httpError(w, r, "not found", http.StatusNotFound)
+		return
+	case err != nil:
+		httpError(w, r, "can't get", http.StatusInternalServerError)
+		return
+	}
+
+	if err := sendJSON(w, s.driverResponse(d)); err != nil {
+		httpError(w, r, "can't marshal to JSON", http.StatusInternalServerError)
+	}
+}
+
+func (s *Server) driverStateHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireRole(w, r, Admin) {
+		return
+	}
+
+	var req struct {
+		State string
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, "bad json", http.StatusBadRequest)
+		return
+	}
+	state, err := driverStateFromString(req.State)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	login := mux.Vars(r)["login"]
+	err = s.db.SetDriverState(r.Context(), login, state.String())
+	switch {
+	case errors.Is(err, db.ErrNotFound):
+		httpError(w, r, "not found", http.StatusNotFound)
+		return
+	case err != nil:
+		httpError(w, r, "can't update", http.StatusInternalServerError)
+		return
+	}
+	ctxLogger(s.log, r.Context()).Printf("INFO: driver %s is %s", login, state)
+	if state != unter.Active && s.matcher != nil {
+		s.matcher.SetUnavailable(login)
+	}
+
+	resp := map[string]any{
+		"login": login,
+		"state": state.String(),
+	}
+	if err := sendJSON(w, resp); err != nil {
+		httpError(w, r, "can't marshal to JSON", http.StatusInternalServerError)
+	}
+}
+
+func (s *Server) heartbeatHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireRole(w, r, Writer) {
+		return
+	}
+	login := RequestValues(r.Context()).User.Login
+
+	var req struct {
+		Status string
+		Lat    *float64
+		Lon    *float64
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, "bad json", http.StatusBadRequest)
+		return
+	}
+
+	// Drivers go online or offline, on trip is set by rides
+	a, err := availabilityFromString(req.Status)
+	if err != nil || a == unter.OnTrip {
+		httpError(w, r, "bad status", http.StatusBadRequest)
+		return
+	}
+	pos, err := ridePosition(req.Lat, req.Lon)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	d, err := s.driver(r.Context(), login)
+	switch {
+	case errors.Is(err, db.ErrNotFound):
+		httpError(w, r, "unknown driver", http.StatusForbidden)
+		return
+	case err != nil:
+		httpError(w, r, "can't get", http.StatusInternalServerError)
+		return
+	}
+	if d.Availability == unter.OnTrip && a == unter.Online {
+		a = unter.OnTrip // heartbeat during a ride
+	}
+
+	now := time.Now().UTC()
+	if err := s.db.DriverHeartbeat(r.Context(), login, a.String(), now, pos); err != nil {
+		httpError(w, r, "can't update", http.StatusInternalServerError)
+		return
+	}
+	d.Availability, d.LastSeen = a, now
+	s.updateMatcher(d, pos, now)
+
+	resp := map[string]any{
+		"login":        login,
+		"availability": a.String(),
+		"ttl":          s.driverTTL.Seconds(),
+	}
+	if err := sendJSON(w, resp); err != nil {
+		httpError(w, r, "can't marshal to JSON", http.StatusInternalServerError)
+	}
+}
+
+// canStart checks that login can start a ride, it sends an error and returns
+// false if not.
+func (s *Server) canStart(w http.ResponseWriter, r *http.Request, login string) bool {
+	d, err := s.driver(r.Context(), login)
+	switch {
+	case errors.Is(err, db.ErrNotFound):
+		httpError(w, r, "unknown driver", http.StatusForbidden)
+		return false
+	case err != nil:
+		httpError(w, r, "can't get driver", http.StatusInternalServerError)
+		return false
+	}
+
+	err = d.CanStart(time.Now(), s.driverTTL)
+	switch {
+	case errors.Is(err, unter.ErrSuspended), errors.Is(err, unter.ErrLicenseExpired):
+		httpError(w, r, err.Error(), http.StatusForbidden)
+		return false
+	case err != nil:
+		httpError(w, r, err.Error(), http.StatusConflict)
+		return false
+	}
+
+	return true
+}
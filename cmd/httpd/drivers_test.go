@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/353solutions/unter"
+	"github.com/353solutions/unter/db"
+)
+
+var driverFromDBCases = []struct {
+	name         string
+	state        string
+	availability string
+	ok           bool
+}{
+	{"online", "active", "online", true},
+	{"on trip", "active", "on_trip", true},
+	{"suspended", "suspended", "offline", true},
+	{"bad state", "banned", "online", false},
+	{"bad availability", "active", "away", false},
+}
+
+func TestDriverFromDB(t *testing.T) {
+	for _, tc := range driverFromDBCases {
+		t.Run(tc.name, func(t *testing.T) {
+			d := db.Driver{
+				Login:          "bond",
+				Name:           "James Bond",
+				LicenseNumber:  "007",
+				LicenseExpires: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC),
+				State:          tc.state,
+				Availability:   tc.availability,
+			}
+			ud, err := driverFromDB(d)
+			if !tc.ok {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.NoError(t, ud.Validate())
+			require.Equal(t, tc.state, ud.State.String())
+			require.Equal(t, tc.availability, ud.Availability.String())
+		})
+	}
+}
+
+func TestDriverResponseStale(t *testing.T) {
+	s := Server{driverTTL: time.Minute}
+	d := unter.Driver{
+		Login:        "bond",
+		State:        unter.Active,
+		Availability: unter.Online,
+		LastSeen:     time.Now().Add(-time.Hour),
+	}
+
+	resp := s.driverResponse(d)
+	require.Equal(t, "offline", resp.Availability)
+	require.NotNil(t, resp.LastSeen)
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/353solutions/unter"
+	"github.com/353solutions/unter/db"
+	"github.com/353solutions/unter/geo"
+)
+
+/* Fare estimates
+
+GET /estimate?from=32.07,34.78&to=32.11,34.80&kind=private    (rider or Admin)
+
+The estimate is priced with the fee schedule, speeds come from past rides of
+similar distance that started around the same hour (UTC). The quote is stored,
+a ride started with "estimate_id" in Estimates.TTL (POST /rides or POST
+/ride-requests) is charged at most the quote high for the quote rider.
+
+The cap applies only if the rider's pickup and drop-off are near the quoted
+points and the distance is not well over the estimate (see unter.Quote.Covers).
+A quote caps one ride, it's marked used when the ride ends.
+*/
+
+var errBadQuote = errors.New("bad estimate")
+
+// parseLatLon parses "lat,lon".
+func parseLatLon(s string) (*db.Position, error) {
+	i := strings.Index(s, ",")
+	if i == -1 {
+		return nil, errBadLocation
+	}
+
+	lat, err := strconv.ParseFloat(strings.TrimSpace(s[:i]), 64)
+	if err != nil {
+		return nil, errBadLocation
+	}
+	lon, err := strconv.ParseFloat(strings.TrimSpace(s[i+1:]), 64)
+	if err != nil {
+		return nil, errBadLocation
+	}
+	return ridePosition(&lat, &lon)
+}
+
+// rideSpeeds returns the speeds of past rides similar to a ride of distance
+// starting at now.
+func (s *Server) rideSpeeds(ctx context.Context, distance float64, now time.Time) (unter.SpeedStats, error) {
+	minDist, maxDist := distance*(1-s.estimates.Slack), distance*(1+s.estimates.Slack)
+	sp, err := s.db.RideSpeeds(ctx, minDist, maxDist, now.Add(-s.estimates.History), now.Hour())
+	if err != nil {
+		return unter.SpeedStats{}, err
+	}
+	return unter.SpeedStats{Count: sp.Count, Slow: sp.P25, Median: sp.Median, Fast: sp.P75}, nil
+}
+
+func quoteFromDB(q db.Quote) (unter.Quote, error) {
+	k, err := kindFromString(q.Kind)
+	if err != nil {
+		return unter.Quote{}, err
+	}
+
+	uq := unter.Quote{
+		ID:       q.ID,
+		Rider:    q.Rider,
+		Kind:     k,
+		From:     geo.Point{Lat: q.From.Lat, Lon: q.From.Lon},
+		To:       geo.Point{Lat: q.To.Lat, Lon: q.To.Lon},
+		Distance: q.Distance,
+		Duration: q.Duration,
+		Low:      q.Low,
+		High:     q.High,
+		Created:  q.Created,
+		Expires:  q.Expires,
+	}
+	return uq, nil
+}
+
+// rideQuote returns the quote with id if it applies to r.
+func (s *Server) rideQuote(ctx context.Context, id string, r unter.Ride) (unter.Quote, error) {
+	dq, err := s.db.Quote(ctx, id)
+	if errors.Is(err, db.ErrNotFound) {
+		return unter.Quote{}, fmt.Errorf("%w: %s not found", errBadQuote, id)
+	}
+	if err != nil {
+		return unter.Quote{}, err
+	}
+	if dq.RideID != "" {
+		return unter.Quote{}, fmt.Errorf("%w: %s already used", errBadQuote, id)
+	}
+
+	q, err := quoteFromDB(dq)
+	if err != nil {
+		return unter.Quote{}, err
+	}
+	if err := q.CanApply(r); err != nil {
+		return unter.Quote{}, fmt.Errorf("%w: %s", errBadQuote, err)
+	}
+	return q, nil
+}
+
+// positionAt returns the last location at or before t, the first one if
+// there's none.
+func positionAt(locs []db.Location, t time.Time) (geo.Point, bool) {
+	if len(locs) == 0 {
+		return geo.Point{}, false
+	}
+
+	p := locs[0]
+	for _, l := range locs {
+		if l.Time.After(t) {
+			break
+		}
+		p = l
+	}
+	return geo.Point(p), true
+}
+
+// quoteCovers returns an error if q doesn't cover the quote rider's part of
+// the ended ride rd, locs are the ride GPS locations.
+func quoteCovers(q unter.Quote, rd db.Ride, locs []db.Location) error {
+	if len(rd.Legs) == 0 {
+		if rd.StartPos == nil || rd.EndPos == nil {
+			return fmt.Errorf("%w: unknown pickup or drop-off", unter.ErrQuoteRoute)
+		}
+		pickup := geo.Point{Lat: rd.StartPos.Lat, Lon: rd.StartPos.Lon}
+		dropoff := geo.Point{Lat: rd.EndPos.Lat, Lon: rd.EndPos.Lon}
+		return q.Covers(pickup, dropoff, rd.Distance)
+	}
+
+	for _, l := range rd.Legs {
+		if l.Rider != q.Rider {
+			continue
+		}
+		pickup, ok := positionAt(locs, l.Pickup)
+		if !ok {
+			return fmt.Errorf("%w: no GPS locations", unter.ErrQuoteRoute)
+		}
+		dropoff, _ := positionAt(locs, l.Dropoff)
+		return q.Covers(pickup, dropoff, l.Distance)
+	}
+	return fmt.Errorf("%w: rider %q has no leg", unter.ErrQuoteRoute, q.Rider)
+}
+
+// fareExtras returns the extras of an ended ride, the quote (if any) caps the
+// fare if it covers the ride and no other ride used it. It doesn't mark the
+// quote used, db.EndRide does.
+func (s *Server) fareExtras(ctx context.Context, rd db.Ride, locs []db.Location, tip int) (unter.Extras, error) {
+	x := s.fares.extras(tip)
+	if rd.QuoteID == "" {
+		return x, nil
+	}
+
+	dq, err := s.db.Quote(ctx, rd.QuoteID)
+	if err != nil {
+		return unter.Extras{}, err
+	}
+	if dq.RideID != "" && dq.RideID != rd.ID {
+		ctxLogger(s.log, ctx).Printf("WARNING: ride %s: estimate %s used by another ride", rd.ID, dq.ID)
+		return x, nil
+	}
+	q, err := quoteFromDB(dq)
+	if err != nil {
+		return unter.Extras{}, err
+	}
+	if err := quoteCovers(q, rd, locs); err != nil {
+		ctxLogger(s.log, ctx).Printf("WARNING: ride %s: estimate %s not applied - %s", rd.ID, q.ID, err)
+		return x, nil
+	}
+
+	x.Cap, x.CapRider = q.High, q.Rider
+	return x, nil
+}
+
+// quoteError sends the error of rideQuote.
+func quoteError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, errBadQuote) {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	httpError(w, r, "can't get estimate", http.StatusInternalServerError)
+}
+
+type EstimateResponse struct {
+	ID       string    `json:"id"`
+	Kind     string    `json:"kind"`
+	Distance float64   `json:"distance"` // miles
+	Duration float64   `json:"duration"` // seconds
+	Low      int       `json:"low"`      // ¢
+	High     int       `json:"high"`
+	Similar  int       `json:"similar_rides"`
+	Expires  time.Time `json:"expires"`
+}
+
+func (s *Server) estimateHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireRole(w, r, Rider, Admin) {
+		return
+	}
+
+	query := r.URL.Query()
+	k, err := kindFromString(query.Get("kind"))
+	if err != nil {
+		httpError(w, r, "bad kind", http.StatusBadRequest)
+		return
+	}
+	from, err := parseLatLon(query.Get("from"))
+	if err != nil {
+		httpError(w, r, "bad from", http.StatusBadRequest)
+		return
+	}
+	to, err := parseLatLon(query.Get("to"))
+	if err != nil {
+		httpError(w, r, "bad to", http.StatusBadRequest)
+		return
+	}
+	if _, err := s.startZone(from); err != nil {
+		httpError(w, r, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	now := time.Now().UTC()
+	pickup, dropoff := geo.Point{Lat: from.Lat, Lon: from.Lon}, geo.Point{Lat: to.Lat, Lon: to.Lon}
+	straight := geo.Haversine(pickup, dropoff)
+	speeds, err := s.rideSpeeds(r.Context(), unter.DrivingDistance(straight), now)
+	if err != nil {
+		// Estimate with default speeds
+		ctxLogger(s.log, r.Context()).Printf("WARNING: can't get ride speeds - %s", err)
+	}
+
+	q := unter.Estimate(straight, k, speeds)
+	q.ID = unter.NewID()
+	q.Rider = RequestValues(r.Context()).User.Login
+	q.From, q.To = pickup, dropoff
+	q.Created, q.Expires = now, now.Add(s.estimates.TTL)
+
+	dq := db.Quote{
+		ID:       q.ID,
+		Rider:    q.Rider,
+		Kind:     q.Kind.String(),
+		From:     *from,
+		To:       *to,
+		Distance: q.Distance,
+		Duration: q.Duration,
+		Low:      q.Low,
+		High:     q.High,
+		Created:  q.Created,
+		Expires:  q.Expires,
+	}
+	if err := s.db.AddQuote(r.Context(), dq); err != nil {
+		httpError(w, r, "can't insert", http.StatusInternalServerError)
+		return
+	}
+	ctxLogger(s.log, r.Context()).Printf("INFO: estimate %s for %s: %d-%d¢ (%d similar rides)", q.ID, q.Rider, q.Low, q.High, speeds.Count)
+
+	resp := EstimateResponse{
+		ID:       q.ID,
+		Kind:     q.Kind.String(),
+		Distance: q.Distance,
+		Duration: q.Duration.Seconds(),
+		Low:      q.Low,
+		High:     q.High,
+		Similar:  speeds.Count,
+		Expires:  q.Expires,
+	}
+	if err := sendJSON(w, resp); err != nil {
+		httpError(w, r, "can't marshal to JSON", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/353solutions/unter"
+	"github.com/353solutions/unter/db"
+	"github.com/353solutions/unter/geo"
+)
+
+var parseLatLonCases = []struct {
+	s   string
+	pos *db.Position
+}{
+	{"32.07,34.78", &db.Position{Lat: 32.07, Lon: 34.78}},
+	{"32.07, 34.78", &db.Position{Lat: 32.07, Lon: 34.78}},
+	{"32.07", nil},
+	{"91,34.78", nil},
+	{"x,y", nil},
+	{"", nil},
+}
+
+func TestParseLatLon(t *testing.T) {
+	for _, tc := range parseLatLonCases {
+		t.Run(tc.s, func(t *testing.T) {
+			pos, err := parseLatLon(tc.s)
+			if tc.pos == nil {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.pos, pos)
+		})
+	}
+}
+
+func TestQuoteFromDB(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	dq := db.Quote{
+		ID:      "e1",
+		Rider:   "Moneypenny",
+		Kind:    "shared",
+		High:    900,
+		Created: now,
+		Expires: now.Add(time.Minute),
+	}
+	dq.From, dq.To = db.Position{Lat: 32.08, Lon: 34.78}, db.Position{Lat: 32.11, Lon: 34.80}
+	q, err := quoteFromDB(dq)
+	require.NoError(t, err)
+	require.Equal(t, unter.Shared, q.Kind)
+	require.Equal(t, geo.Point{Lat: 32.11, Lon: 34.80}, q.To)
+
+	r := unter.Ride{Kind: unter.Shared, Start: now, Riders: []string{"Moneypenny", "Q"}}
+	require.NoError(t, q.CanApply(r))
+
+	dq.Kind = "luxury"
+	_, err = quoteFromDB(dq)
+	require.Error(t, err)
+}
+
+var estimateBadCases = []struct {
+	name  string
+	user  User
+	query string
+	code  int
+}{
+	{"driver", User{"Bond", Writer}, "from=32.07,34.78&to=32.1,34.8&kind=private", http.StatusForbidden},
+	{"bad kind", User{"Moneypenny", Rider}, "from=32.07,34.78&to=32.1,34.8&kind=luxury", http.StatusBadRequest},
+	{"no from", User{"Moneypenny", Rider}, "to=32.1,34.8&kind=private", http.StatusBadRequest},
+	{"bad to", User{"Moneypenny", Rider}, "from=32.07,34.78&to=32.1&kind=private", http.StatusBadRequest},
+}
+
+func TestEstimateBad(t *testing.T) {
+	s := Server{log: log.New(io.Discard, "", 0)}
+	for _, tc := range estimateBadCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			s.estimateHandler(w, userRequest(http.MethodGet, "/estimate?"+tc.query, "", tc.user, nil))
+			require.Equal(t, tc.code, w.Code)
+		})
+	}
+}
+
+func TestQuoteCovers(t *testing.T) {
+	require := require.New(t)
+
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	at := func(min int) time.Time { return start.Add(time.Duration(min) * time.Minute) }
+	q := unter.Quote{
+		Rider:    "m",
+		From:     geo.Point{Lat: 32.08, Lon: 34.78},
+		To:       geo.Point{Lat: 32.11, Lon: 34.80},
+		Distance: 3,
+	}
+
+	// Private
+	rd := db.Ride{
+		StartPos: &db.Position{Lat: 32.08, Lon: 34.78},
+		EndPos:   &db.Position{Lat: 32.11, Lon: 34.80},
+		Distance: 3,
+	}
+	require.NoError(quoteCovers(q, rd, nil))
+	rd.Distance = 30
+	require.ErrorIs(quoteCovers(q, rd, nil), unter.ErrQuoteRoute)
+	rd.Distance, rd.EndPos = 3, &db.Position{Lat: 32.5, Lon: 34.80}
+	require.ErrorIs(quoteCovers(q, rd, nil), unter.ErrQuoteRoute)
+	rd.EndPos = nil
+	require.ErrorIs(quoteCovers(q, rd, nil), unter.ErrQuoteRoute)
+
+	// Shared, m's leg positions come from GPS
+	rd = db.Ride{
+		StartPos: &db.Position{Lat: 32.0, Lon: 34.7},
+		EndPos:   &db.Position{Lat: 32.2, Lon: 34.9},
+		Distance: 10,
+		Legs: []db.Leg{
+			{Rider: "q", Pickup: at(0), Dropoff: at(30), Distance: 10},
+			{Rider: "m", Pickup: at(10), Dropoff: at(20), Distance: 3},
+		},
+	}
+	locs := []db.Location{
+		{Time: at(0), Lat: 32.0, Lon: 34.7},
+		{Time: at(10), Lat: 32.08, Lon: 34.78},
+		{Time: at(20), Lat: 32.11, Lon: 34.80},
+		{Time: at(30), Lat: 32.2, Lon: 34.9},
+	}
+	require.NoError(quoteCovers(q, rd, locs))
+	require.ErrorIs(quoteCovers(q, rd, nil), unter.ErrQuoteRoute, "no GPS")
+	rd.Legs[1].Pickup = at(0)
+	require.ErrorIs(quoteCovers(q, rd, locs), unter.ErrQuoteRoute, "pickup far")
+	q.Rider = "felix"
+	require.ErrorIs(quoteCovers(q, rd, locs), unter.ErrQuoteRoute, "no leg")
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/353solutions/unter/events"
+)
+
+/* Server-Sent Events
+
+GET /rides/events
+GET /rides/{id}/events
+
+$ curl -N -u Q:s3cr3t https://localhost:8080/rides/events
+
+Clients resume with the Last-Event-ID header (EventSource does it on
+reconnect) or the last_event_id query parameter. Only recent events are kept
+(Events.History), older ones are lost.
+*/
+
+const lastEventIDHeader = "Last-Event-ID"
+
+// runEvents delivers events from all replicas to local subscribers until ctx
+// is done.
+func (s *Server) runEvents(ctx context.Context) {
+	for {
+		err := s.events.Run(ctx, func(err error) {
+			s.log.Printf("WARNING: events: %s", err)
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		s.log.Printf("ERROR: events subscription - %v, retrying", err)
+		if sleepCtx(ctx, time.Second) != nil {
+			return
+		}
+	}
+}
+
+// eventFilter returns the events u can see: viewers and admins see all rides,
+// drivers and riders only their own. rideID limits to a single ride.
+func eventFilter(u User, rideID string) func(events.Event) bool {
+	return func(e events.Event) bool {
+		if rideID != "" && e.RideID != rideID {
+			return false
+		}
+		if HasRole(u, Viewer, Admin) {
+			return true
+		}
+		if e.Driver == u.Login {
+			return true
+		}
+		for _, login := range e.Riders {
+			if login == u.Login {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func lastEventID(r *http.Request) (int64, error) {
+	s := r.Header.Get(lastEventIDHeader)
+	if s == "" {
+		s = r.URL.Query().Get("last_event_id")
+	}
+	if s == "" {
+		return 0, nil
+	}
+
+	id, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || id < 0 {
+		return 0, fmt.Errorf("bad event ID: %q", s)
+	}
+	return id, nil
+}
+
+func writeEvent(w io.Writer, e events.Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+	return err
+}
+
+func (s *Server) eventsHandler(w http.ResponseWriter, r *http.Request) {
+	v := RequestValues(r.Context())
+	if v == nil || v.User.Role == 0 {
+		httpError(w, r, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if s.events == nil {
+		httpError(w, r, "events not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	lastID, err := lastEventID(r)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	broker := s.events.Broker()
+	sub, missed := broker.Subscribe(lastID, eventFilter(v.User, mux.Vars(r)["id"]))
+	defer broker.Unsubscribe(sub)
+
+	// The stream outlives the server write timeout
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		ctxLogger(s.log, r.Context()).Printf("WARNING: can't clear write deadline - %s", err)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // nginx
+	w.WriteHeader(http.StatusOK)
+
+	for _, e := range missed {
+		if err := writeEvent(w, e); err != nil {
+			return
+		}
+	}
+	rc.Flush() //#nosec G104
+
+	heartbeat := s.heartbeat
+	if heartbeat <= 0 {
+		heartbeat = 15 * time.Second
+	}
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e, ok := <-sub.C():
+			if !ok { // shutdown or too slow
+				return
+			}
+			if err := writeEvent(w, e); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if _, err := io.WriteString(w, ": ping\n\n"); err != nil {
+				return
+			}
+		}
+		rc.Flush() //#nosec G104
+	}
+}
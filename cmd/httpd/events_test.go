@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/353solutions/unter/events"
+)
+
+// readEvents reads n event IDs from an SSE stream.
+func readEvents(t *testing.T, body io.Reader, n int) []string {
+	var ids []string
+	s := bufio.NewScanner(body)
+	for len(ids) < n && s.Scan() {
+		if id, ok := strings.CutPrefix(s.Text(), "id: "); ok {
+			ids = append(ids, id)
+		}
+	}
+	require.NoError(t, s.Err())
+	return ids
+}
+
+func TestEventsHandler(t *testing.T) {
+	require := require.New(t)
+
+	broker := events.NewBroker(10)
+	s := Server{
+		log:    log.New(io.Discard, "", 0),
+		events: events.NewBus(nil, broker),
+	}
+	srv := httptest.NewServer(buildRouter(&s))
+	defer srv.Close()
+	defer broker.Close()
+
+	broker.Deliver(events.Event{ID: 1, Type: events.RideStarted, RideID: "r1", Driver: "Bond"})
+	broker.Deliver(events.Event{ID: 2, Type: events.RideStarted, RideID: "r2", Driver: "M"})
+	broker.Deliver(events.Event{ID: 3, Type: events.RideEnded, RideID: "r1", Driver: "Bond"})
+
+	get := func(path, login, passwd, lastID string) *http.Response {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+		require.NoError(err)
+		if login != "" {
+			req.SetBasicAuth(login, passwd)
+		}
+		if lastID != "" {
+			req.Header.Set(lastEventIDHeader, lastID)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(err)
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	resp := get("/rides/events", "", "", "")
+	require.Equal(http.StatusUnauthorized, resp.StatusCode)
+
+	resp = get("/rides/events", "Q", "s3cr3t", "bad")
+	require.Equal(http.StatusBadRequest, resp.StatusCode)
+
+	// Viewer sees all rides
+	resp = get("/rides/events", "Q", "s3cr3t", "1")
+	require.Equal(http.StatusOK, resp.StatusCode)
+	require.Equal("text/event-stream", resp.Header.Get("Content-Type"))
+	require.Equal([]string{"2", "3"}, readEvents(t, resp.Body, 2))
+
+	// Driver sees only own rides, live events after replay
+	resp = get("/rides/r1/events", "Bond", "007", "1")
+	require.Equal(http.StatusOK, resp.StatusCode)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		broker.Deliver(events.Event{ID: 4, Type: events.RideStarted, RideID: "r4", Driver: "Bond"})
+		broker.Deliver(events.Event{ID: 5, Type: events.RideCancelled, RideID: "r1", Driver: "Bond"})
+	}()
+	require.Equal([]string{"3", "5"}, readEvents(t, resp.Body, 2))
+}
+
+func TestEventFilter(t *testing.T) {
+	e := events.Event{RideID: "r1", Driver: "Bond", Riders: []string{"Vesper"}}
+
+	require.True(t, eventFilter(User{"Q", Viewer}, "")(e))
+	require.True(t, eventFilter(User{"Bond", Writer}, "r1")(e))
+	require.True(t, eventFilter(User{"Vesper", Rider}, "r1")(e))
+	require.False(t, eventFilter(User{"M", Writer}, "")(e))
+	require.False(t, eventFilter(User{"Felix", Rider}, "")(e))
+	require.False(t, eventFilter(User{"Q", Admin}, "r2")(e))
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/353solutions/unter"
+	"github.com/353solutions/unter/db"
+)
+
+/* Fares
+
+Rides are priced when they end (see unter.RideFare), the total and the
+breakdown are stored with the ride and returned in GET /rides/{id}.
+
+Fares.BookingFee is a surcharge on every ride and Fares.TaxRate is applied to
+the fare and surcharges. Tips are not taxed.
+*/
+
+const bookingSurcharge = "booking"
+
+// extras returns the ride extras with tip (¢).
+func (c FaresConfig) extras(tip int) unter.Extras {
+	x := unter.Extras{
+		Tip:     tip,
+		TaxRate: c.TaxRate,
+	}
+	if c.BookingFee != 0 {
+		x.Surcharges = []unter.Surcharge{{Name: bookingSurcharge, Amount: c.BookingFee}}
+	}
+	return x
+}
+
+type SurchargeResponse struct {
+	Name   string `json:"name"`
+	Amount int    `json:"amount"`
+}
+
+// FareResponse is a fare breakdown, amounts are in ¢. It's also the stored
+// fare details.
+type FareResponse struct {
+	Minimum        int                 `json:"minimum"`
+	Distance       int                 `json:"distance"`
+	Time           int                 `json:"time"`
+	Winner         string              `json:"winner"` // the fee component
+	Fee            int                 `json:"fee"`
+	SharedDiscount int                 `json:"shared_discount,omitempty"`
+	Cap            int                 `json:"cap,omitempty"` // quoted maximum
+	CapRider       string              `json:"cap_rider,omitempty"`
+	QuoteDiscount  int                 `json:"quote_discount,omitempty"`
+	Legs           []int               `json:"legs,omitempty"`
+	Surcharges     []SurchargeResponse `json:"surcharges,omitempty"`
+	Tip            int                 `json:"tip,omitempty"`
+	TaxRate        float64             `json:"tax_rate,omitempty"`
+	Tax            int                 `json:"tax,omitempty"`
+	Total          int                 `json:"total"`
+}
+
+func fareResponse(f unter.FareBreakdown) FareResponse {
+	resp := FareResponse{
+		Minimum:        f.Minimum,
+		Distance:       f.Distance,
+		Time:           f.Time,
+		Winner:         f.Winner.String(),
+		Fee:            f.Fee,
+		SharedDiscount: f.SharedDiscount,
+		Cap:            f.Cap,
+		CapRider:       f.CapRider,
+		QuoteDiscount:  f.QuoteDiscount,
+		Legs:           f.Legs,
+		Tip:            f.Tip,
+		TaxRate:        f.TaxRate,
+		Tax:            f.Tax,
+		Total:          f.Total,
+	}
+	for _, s := range f.Surcharges {
+		resp.Surcharges = append(resp.Surcharges, SurchargeResponse(s))
+	}
+	return resp
+}
+
+// priceRide sets the fare of an ended ride, open legs must be closed first
+// (see priceLegs).
+func (s *Server) priceRide(rd *db.Ride, x unter.Extras) (FareResponse, error) {
+	r, err := rideFromDB(*rd)
+	if err != nil {
+		return FareResponse{}, err
+	}
+	if err := r.Validate(); err != nil {
+		return FareResponse{}, err
+	}
+
+	if err := x.Validate(); err != nil {
+		return FareResponse{}, err
+	}
+
+	f := unter.RideFare(r, x)
+	resp := fareResponse(f)
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return FareResponse{}, err
+	}
+	rd.Fare, rd.FareDetails = f.Total, data
+	for i, fare := range f.Legs { // quote cap
+		rd.Legs[i].Fare = fare
+	}
+	return resp, nil
+}
+
+// rideFare returns the stored fare of rd, nil if it's not priced.
+func rideFare(rd db.Ride) (*FareResponse, error) {
+	if len(rd.FareDetails) == 0 {
+		return nil, nil
+	}
+
+	var f FareResponse
+	if err := json.Unmarshal(rd.FareDetails, &f); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
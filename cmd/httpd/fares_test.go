@@ -0,0 +1,124 @@
+package main
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/353solutions/unter/db"
+)
+
+func TestPriceRide(t *testing.T) {
+	require := require.New(t)
+
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	rd := db.Ride{
+		ID:       "r1",
+		Driver:   "Bond",
+		Kind:     "private",
+		Start:    start,
+		End:      start.Add(3 * time.Minute),
+		Distance: 3,
+	}
+
+	s := Server{fares: FaresConfig{BookingFee: 100, TaxRate: 0.1}}
+	fare, err := s.priceRide(&rd, s.fares.extras(50))
+	require.NoError(err)
+	require.Equal("distance", fare.Winner)
+	require.Equal(750, fare.Fee)
+	require.Equal(85, fare.Tax)
+	require.Equal(750+100+85+50, fare.Total)
+	require.Equal(fare.Total, rd.Fare)
+
+	// Stored details
+	resp := rideResponse(rd)
+	require.NotNil(resp.Fare)
+	require.Equal(fare, *resp.Fare)
+
+	_, err = s.priceRide(&rd, s.fares.extras(-1))
+	require.Error(err)
+}
+
+func TestPriceRideLegs(t *testing.T) {
+	require := require.New(t)
+
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	at := func(min int) time.Time { return start.Add(time.Duration(min) * time.Minute) }
+	rd := db.Ride{
+		ID:       "r1",
+		Driver:   "Bond",
+		Kind:     "shared",
+		Start:    start,
+		End:      at(10),
+		Distance: 4,
+		Riders:   []string{"m", "q"},
+		Legs: []db.Leg{
+			{Rider: "m", Pickup: at(0), Dropoff: at(10), Distance: 4},
+			{Rider: "q", Pickup: at(2), Dropoff: at(4), Distance: 1},
+		},
+	}
+
+	s := Server{gps: GPSConfig{MaxSpeed: 120, Tolerance: 0.25}}
+	require.NoError(s.priceLegs(&rd, nil))
+	fare, err := s.priceRide(&rd, s.fares.extras(0))
+	require.NoError(err)
+
+	legs := 0
+	for i, l := range rd.Legs {
+		require.Equal(l.Fare, fare.Legs[i])
+		legs += l.Fare
+	}
+	require.Equal(legs, fare.Total)
+}
+
+func TestPriceRideCap(t *testing.T) {
+	require := require.New(t)
+
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	at := func(min int) time.Time { return start.Add(time.Duration(min) * time.Minute) }
+	rd := db.Ride{
+		ID:       "r1",
+		Driver:   "Bond",
+		Kind:     "shared",
+		Start:    start,
+		End:      at(10),
+		Distance: 4,
+		Riders:   []string{"m", "q"},
+		Legs: []db.Leg{
+			{Rider: "m", Pickup: at(0), Dropoff: at(10), Distance: 4},
+			{Rider: "q", Pickup: at(2), Dropoff: at(4), Distance: 1},
+		},
+		QuoteID: "e1",
+	}
+
+	s := Server{}
+	x := s.fares.extras(0)
+	x.Cap, x.CapRider = 700, "m"
+	fare, err := s.priceRide(&rd, x)
+	require.NoError(err)
+	require.Equal(100, fare.QuoteDiscount)
+	require.Equal(700, rd.Legs[0].Fare)
+	require.Equal(900, rd.Fare)
+}
+
+func TestEndAccess(t *testing.T) {
+	s := Server{log: log.New(io.Discard, "", 0), fares: FaresConfig{MaxTip: 1000}}
+	vars := map[string]string{"id": "r1"}
+
+	w := httptest.NewRecorder()
+	s.endHandler(w, userRequest(http.MethodPost, "/rides/r1/end", `{"distance": 1}`, User{}, vars))
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = httptest.NewRecorder()
+	s.endHandler(w, userRequest(http.MethodPost, "/rides/r1/end", `{"distance": 1}`, User{"m", Rider}, vars))
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = httptest.NewRecorder()
+	s.endHandler(w, userRequest(http.MethodPost, "/rides/r1/end", `{"distance": 1, "tip": 1001}`, User{"Bond", Writer}, vars))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/353solutions/unter"
+	"github.com/353solutions/unter/db"
+	"github.com/353solutions/unter/ledger"
+)
+
+/* Ledger (Admin role)
+
+GET  /admin/ledger/balance?account=driver_payable:Bond&as_of=2026-03-01T00:00:00Z
+POST /admin/rides/{id}/refund       {"reason": "..."}
+POST /admin/drivers/{login}/payout  {"amount": 1200}
+
+Ending a ride posts its fare to the ledger in the same transaction as the ride
+update: riders are charged the total (split by leg fares), the platform keeps
+unter.RideCommission and the surcharges, tax goes to the tax account and the
+rest (including the tip) is owed to the driver. Rides without riders (started
+by the driver) charge the cash receivable account instead. A refund posts the
+reversal of the ride entry.
+
+A payout pays a driver from the platform bank account, amount 0 (or missing)
+pays all the platform owes the driver.
+*/
+
+// rideShares returns the riders who pay for rd and their weights, leg fares
+// (after the quote cap) on shared rides with legs, nil splits evenly.
+func rideShares(rd db.Ride, fare FareResponse) ([]string, []int) {
+	if len(rd.Legs) == 0 {
+		return rd.Riders, nil
+	}
+
+	riders := make([]string, len(rd.Legs))
+	shares := make([]int, len(rd.Legs))
+	for i, l := range rd.Legs {
+		riders[i], shares[i] = l.Rider, l.Fare
+		if len(fare.Legs) == len(rd.Legs) {
+			shares[i] = fare.Legs[i]
+		}
+	}
+	return riders, shares
+}
+
+// rideEntry returns the ledger entry of an ended ride with fare.
+func rideEntry(rd db.Ride, fare FareResponse) (ledger.Entry, error) {
+	lr := ledger.Ride{
+		ID:     rd.ID,
+		Driver: rd.Driver,
+		Time:   rd.End,
+		Total:  fare.Total,
+		Tax:    fare.Tax,
+		Tip:    fare.Tip,
+	}
+	lr.Riders, lr.Shares = rideShares(rd, fare)
+	lr.Commission = unter.RideCommission
+	for _, s := range fare.Surcharges {
+		lr.Commission += s.Amount
+	}
+	if fee := fare.Total - fare.Tax - fare.Tip; lr.Commission > fee { // capped fares
+		lr.Commission = fee
+	}
+
+	return ledger.RideEntry(lr)
+}
+
+type PostingResponse struct {
+	Account string `json:"account"`
+	Amount  int    `json:"amount"` // ¢, debit > 0
+}
+
+type EntryResponse struct {
+	ID       string            `json:"id"`
+	Memo     string            `json:"memo"`
+	Time     time.Time         `json:"time"`
+	Reverses string            `json:"reverses,omitempty"`
+	Postings []PostingResponse `json:"postings"`
+}
+
+func entryResponse(e ledger.Entry) EntryResponse {
+	resp := EntryResponse{
+		ID:       e.ID,
+		Memo:     e.Memo,
+		Time:     e.Time,
+		Reverses: e.Reverses,
+		Postings: make([]PostingResponse, len(e.Postings)),
+	}
+	for i, p := range e.Postings {
+		resp.Postings[i] = PostingResponse{string(p.Account), p.Amount}
+	}
+	return resp
+}
+
+type BalanceResponse struct {
+	Account string    `json:"account"`
+	AsOf    time.Time `json:"as_of"`
+	Balance int       `json:"balance"` // ¢, debit > 0
+}
+
+func (s *Server) balanceHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireRole(w, r, Admin) {
+		return
+	}
+
+	query := r.URL.Query()
+	account := ledger.Account(query.Get("account"))
+	if err := account.Validate(); err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	asOf := time.Now().UTC()
+	if v := query.Get("as_of"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			httpError(w, r, "bad as_of", http.StatusBadRequest)
+			return
+		}
+		asOf = t.UTC()
+	}
+
+	b, err := s.ledger.Balance(r.Context(), account, asOf)
+	if err != nil {
+		httpError(w, r, "can't get balance", http.StatusInternalServerError)
+		return
+	}
+
+	resp := BalanceResponse{
+		Account: string(account),
+		AsOf:    asOf,
+		Balance: b,
+	}
+	if err := sendJSON(w, resp); err != nil {
+		httpError(w, r, "can't marshal to JSON", http.StatusInternalServerError)
+	}
+}
+
+func (s *Server) refundHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireRole(w, r, Admin) {
+		return
+	}
+
+	var req struct {
+		Reason string
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, "bad json", http.StatusBadRequest)
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+	memo := fmt.Sprintf("refund ride %s", id)
+	if req.Reason != "" {
+		memo += ": " + req.Reason
+	}
+	e, err := s.ledger.Reverse(r.Context(), ledger.RideEntryID(id), time.Now().UTC(), memo)
+	switch {
+	case errors.Is(err, ledger.ErrNotFound):
+		httpError(w, r, "not found", http.StatusNotFound)
+		return
+	case errors.Is(err, ledger.ErrReversed):
+		httpError(w, r, "already refunded", http.StatusConflict)
+		return
+	case err != nil:
+		httpError(w, r, "can't refund", http.StatusInternalServerError)
+		return
+	}
+	ctxLogger(s.log, r.Context()).Printf("INFO: ride %s refunded (%s)", id, e.ID)
+
+	w.WriteHeader(http.StatusCreated)
+	if err := sendJSON(w, entryResponse(e)); err != nil {
+		s.log.Printf("WARNING: can't send - %s", err)
+	}
+}
+
+func (s *Server) payoutHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireRole(w, r, Admin) {
+		return
+	}
+
+	var req struct {
+		Amount int // ¢
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		httpError(w, r, "bad json", http.StatusBadRequest)
+		return
+	}
+	if req.Amount < 0 {
+		httpError(w, r, "negative amount", http.StatusBadRequest)
+		return
+	}
+
+	login := mux.Vars(r)["login"]
+	e, err := s.ledger.Payout(r.Context(), login, req.Amount, time.Now().UTC())
+	switch {
+	case errors.Is(err, ledger.ErrNoBalance):
+		httpError(w, r, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		httpError(w, r, "can't pay", http.StatusInternalServerError)
+		return
+	}
+	ctxLogger(s.log, r.Context()).Printf("INFO: payout to %s (%s)", login, e.ID)
+
+	w.WriteHeader(http.StatusCreated)
+	if err := sendJSON(w, entryResponse(e)); err != nil {
+		s.log.Printf("WARNING: can't send - %s", err)
+	}
+}
+
+// ledgerStore is a ledger.Store on top of the database.
+type ledgerStore struct {
+	db *db.DB
+}
+
+func journalEntry(e ledger.Entry) db.JournalEntry {
+	je := db.JournalEntry{
+		ID:       e.ID,
+		Memo:     e.Memo,
+		Time:     e.Time,
+		Reverses: e.Reverses,
+		Postings: make([]db.JournalPosting, len(e.Postings)),
+	}
+	for i, p := range e.Postings {
+		je.Postings[i] = db.JournalPosting{Account: string(p.Account), Amount: p.Amount}
+	}
+	return je
+}
+
+func (ls ledgerStore) AddEntry(ctx context.Context, e ledger.Entry) error {
+	err := ls.db.AddJournalEntry(ctx, journalEntry(e))
+	if errors.Is(err, db.ErrExists) {
+		return ledger.ErrDuplicate
+	}
+	return err
+}
+
+func (ls ledgerStore) AddPayout(ctx context.Context, e ledger.Entry, account ledger.Account) error {
+	err := ls.db.AddPayout(ctx, journalEntry(e), string(account))
+	switch {
+	case errors.Is(err, db.ErrExists):
+		return ledger.ErrDuplicate
+	case errors.Is(err, db.ErrNoBalance):
+		return ledger.ErrNoBalance
+	}
+	return err
+}
+
+func (ls ledgerStore) Entry(ctx context.Context, id string) (ledger.Entry, error) {
+	je, err := ls.db.JournalEntry(ctx, id)
+	if errors.Is(err, db.ErrNotFound) {
+		return ledger.Entry{}, ledger.ErrNotFound
+	}
+	if err != nil {
+		return ledger.Entry{}, err
+	}
+
+	e := ledger.Entry{
+		ID:       je.ID,
+		Memo:     je.Memo,
+		Time:     je.Time,
+		Reverses: je.Reverses,
+		Postings: make([]ledger.Posting, len(je.Postings)),
+	}
+	for i, p := range je.Postings {
+		e.Postings[i] = ledger.Posting{Account: ledger.Account(p.Account), Amount: p.Amount}
+	}
+	return e, nil
+}
+
+func (ls ledgerStore) Balance(ctx context.Context, account ledger.Account, asOf time.Time) (int, error) {
+	return ls.db.AccountBalance(ctx, string(account), asOf)
+}
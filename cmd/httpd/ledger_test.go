@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/353solutions/unter"
+	"github.com/353solutions/unter/db"
+	"github.com/353solutions/unter/ledger"
+)
+
+// postings returns entry amounts by account.
+func postings(e ledger.Entry) map[ledger.Account]int {
+	m := make(map[ledger.Account]int)
+	for _, p := range e.Postings {
+		m[p.Account] += p.Amount
+	}
+	return m
+}
+
+func TestRideEntry(t *testing.T) {
+	require := require.New(t)
+
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	rd := db.Ride{
+		ID:       "r1",
+		Driver:   "Bond",
+		Kind:     "private",
+		Start:    start,
+		End:      start.Add(3 * time.Minute),
+		Distance: 3,
+		Riders:   []string{"m"},
+	}
+	s := Server{fares: FaresConfig{BookingFee: 100, TaxRate: 0.1}}
+	fare, err := s.priceRide(&rd, s.fares.extras(50))
+	require.NoError(err)
+
+	e, err := rideEntry(rd, fare)
+	require.NoError(err)
+	require.Equal(ledger.RideEntryID("r1"), e.ID)
+	require.Equal(rd.End, e.Time)
+	commission := unter.RideCommission + 100
+	require.Equal(map[ledger.Account]int{
+		ledger.RiderAccount("m"):     fare.Total,
+		ledger.Tax:                   -fare.Tax,
+		ledger.Revenue:               -commission,
+		ledger.DriverAccount("Bond"): -(fare.Total - fare.Tax - commission),
+	}, postings(e))
+
+	rd.Riders = nil // started by the driver
+	e, err = rideEntry(rd, fare)
+	require.NoError(err)
+	require.Equal(fare.Total, postings(e)[ledger.Cash])
+}
+
+func TestRideEntryLegs(t *testing.T) {
+	require := require.New(t)
+
+	rd := db.Ride{
+		ID:     "r1",
+		Driver: "Bond",
+		End:    time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC),
+		Riders: []string{"m", "q"},
+		Legs:   []db.Leg{{Rider: "m", Fare: 800}, {Rider: "q", Fare: 200}},
+	}
+	fare := FareResponse{Total: 1000}
+
+	e, err := rideEntry(rd, fare)
+	require.NoError(err)
+	require.Equal(map[ledger.Account]int{
+		ledger.RiderAccount("m"):     800,
+		ledger.RiderAccount("q"):     200,
+		ledger.Revenue:               -unter.RideCommission,
+		ledger.DriverAccount("Bond"): -(1000 - unter.RideCommission),
+	}, postings(e))
+
+	// Commission is capped by the fare
+	fare = FareResponse{Total: 20, Legs: []int{10, 10}}
+	rd.Legs[0].Fare, rd.Legs[1].Fare = 10, 10
+	e, err = rideEntry(rd, fare)
+	require.NoError(err)
+	require.Equal(-20, postings(e)[ledger.Revenue])
+}
+
+func TestRefund(t *testing.T) {
+	require := require.New(t)
+
+	s := Server{
+		log:    log.New(io.Discard, "", 0),
+		ledger: ledger.New(ledger.NewMemStore()),
+	}
+	rd := db.Ride{
+		ID:     "r1",
+		Driver: "Bond",
+		End:    time.Now().UTC().Add(-time.Hour),
+		Riders: []string{"m"},
+	}
+	e, err := rideEntry(rd, FareResponse{Total: 1000})
+	require.NoError(err)
+	_, err = s.ledger.Post(context.Background(), e)
+	require.NoError(err)
+
+	balance := func() int {
+		w := httptest.NewRecorder()
+		s.balanceHandler(w, userRequest(http.MethodGet, "/admin/ledger/balance?account=rider_receivable:m", "", User{"M", Admin}, nil))
+		require.Equal(http.StatusOK, w.Code)
+		var resp BalanceResponse
+		require.NoError(json.NewDecoder(w.Body).Decode(&resp))
+		return resp.Balance
+	}
+	require.Equal(1000, balance())
+
+	vars := map[string]string{"id": "r1"}
+	w := httptest.NewRecorder()
+	s.refundHandler(w, userRequest(http.MethodPost, "/admin/rides/r1/refund", `{"reason": "late"}`, User{"M", Admin}, vars))
+	require.Equal(http.StatusCreated, w.Code)
+	require.Equal(0, balance())
+
+	w = httptest.NewRecorder()
+	s.refundHandler(w, userRequest(http.MethodPost, "/admin/rides/r1/refund", `{}`, User{"M", Admin}, vars))
+	require.Equal(http.StatusConflict, w.Code)
+
+	w = httptest.NewRecorder()
+	s.refundHandler(w, userRequest(http.MethodPost, "/admin/rides/r2/refund", `{}`, User{"M", Admin}, map[string]string{"id": "r2"}))
+	require.Equal(http.StatusNotFound, w.Code)
+}
+
+func TestPayout(t *testing.T) {
+	require := require.New(t)
+
+	s := Server{
+		log:    log.New(io.Discard, "", 0),
+		ledger: ledger.New(ledger.NewMemStore()),
+	}
+	rd := db.Ride{
+		ID:     "r1",
+		Driver: "Bond",
+		End:    time.Now().UTC().Add(-time.Hour),
+		Riders: []string{"m"},
+	}
+	e, err := rideEntry(rd, FareResponse{Total: 1000})
+	require.NoError(err)
+	_, err = s.ledger.Post(context.Background(), e)
+	require.NoError(err)
+
+	payout := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		vars := map[string]string{"login": "Bond"}
+		s.payoutHandler(w, userRequest(http.MethodPost, "/admin/drivers/Bond/payout", body, User{"M", Admin}, vars))
+		return w
+	}
+
+	require.Equal(http.StatusBadRequest, payout(`{"amount": -1}`).Code)
+	require.Equal(http.StatusConflict, payout(`{"amount": 1000}`).Code)
+
+	w := payout(`{"amount": 500}`)
+	require.Equal(http.StatusCreated, w.Code)
+	var resp EntryResponse
+	require.NoError(json.NewDecoder(w.Body).Decode(&resp))
+	require.Contains(resp.Postings, PostingResponse{"driver_payable:Bond", 500})
+
+	require.Equal(http.StatusCreated, payout("").Code) // the rest
+	b, err := s.ledger.Balance(context.Background(), ledger.DriverAccount("Bond"), time.Now().UTC())
+	require.NoError(err)
+	require.Equal(0, b)
+	require.Equal(http.StatusConflict, payout(`{}`).Code)
+}
+
+var balanceBadCases = []string{
+	"/admin/ledger/balance",
+	"/admin/ledger/balance?account=cash",
+	"/admin/ledger/balance?account=platform_revenue&as_of=yesterday",
+}
+
+func TestBalanceBad(t *testing.T) {
+	s := Server{log: log.New(io.Discard, "", 0)}
+	for _, url := range balanceBadCases {
+		t.Run(url, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			s.balanceHandler(w, userRequest(http.MethodGet, url, "", User{"M", Admin}, nil))
+			require.Equal(t, http.StatusBadRequest, w.Code)
+		})
+	}
+}
+
+func TestLedgerRoles(t *testing.T) {
+	s := Server{log: log.New(io.Discard, "", 0)}
+
+	w := httptest.NewRecorder()
+	s.balanceHandler(w, userRequest(http.MethodGet, "/admin/ledger/balance?account=platform_revenue", "", User{"Bond", Writer}, nil))
+	require.Equal(t, http.StatusForbidden, w.Code)
+
+	w = httptest.NewRecorder()
+	s.refundHandler(w, userRequest(http.MethodPost, "/admin/rides/r1/refund", `{}`, User{"m", Rider}, map[string]string{"id": "r1"}))
+	require.Equal(t, http.StatusForbidden, w.Code)
+
+	w = httptest.NewRecorder()
+	s.payoutHandler(w, userRequest(http.MethodPost, "/admin/drivers/Bond/payout", `{}`, User{"Bond", Writer}, map[string]string{"login": "Bond"}))
+	require.Equal(t, http.StatusForbidden, w.Code)
+}
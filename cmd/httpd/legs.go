@@ -0,0 +1,321 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/353solutions/unter"
+	"github.com/353solutions/unter/db"
+)
+
+/* Shared ride legs
+
+POST /rides/{id}/legs                    {"rider": "Moneypenny"}
+POST /rides/{id}/legs/{rider}/dropoff    {"distance": 1.2}
+
+Riders join and leave a shared ride, each rider pays for their leg (see
+unter.SplitFare). Riders given when the ride starts have a leg from the start.
+Leg distance is computed from GPS locations like the ride distance, legs still
+open when the ride ends are closed with it.
+*/
+
+type LegResponse struct {
+	Rider    string     `json:"rider"`
+	Pickup   time.Time  `json:"pickup"`
+	Dropoff  *time.Time `json:"dropoff,omitempty"`
+	Distance float64    `json:"distance,omitempty"`
+	Fare     int        `json:"fare,omitempty"` // ¢
+}
+
+func legResponses(legs []db.Leg) []LegResponse {
+	if len(legs) == 0 {
+		return nil
+	}
+
+	resp := make([]LegResponse, len(legs))
+	for i, l := range legs {
+		resp[i] = LegResponse{
+			Rider:    l.Rider,
+			Pickup:   l.Pickup,
+			Distance: l.Distance,
+			Fare:     l.Fare,
+		}
+		if !l.Dropoff.IsZero() {
+			resp[i].Dropoff = &legs[i].Dropoff
+		}
+	}
+	return resp
+}
+
+// rideFromDB converts a ride from the database.
+func rideFromDB(rd db.Ride) (unter.Ride, error) {
+	k, err := kindFromString(rd.Kind)
+	if err != nil {
+		return unter.Ride{}, err
+	}
+
+	r := unter.Ride{
+		ID:       rd.ID,
+		Driver:   rd.Driver,
+		CarID:    rd.CarID,
+		Kind:     k,
+		Start:    rd.Start,
+		End:      rd.End,
+		Distance: rd.Distance,
+		Riders:   rd.Riders,
+	}
+	for _, l := range rd.Legs {
+		r.Legs = append(r.Legs, unter.Leg{
+			Rider:    l.Rider,
+			Pickup:   l.Pickup,
+			Dropoff:  l.Dropoff,
+			Distance: l.Distance,
+		})
+	}
+	return r, nil
+}
+
+// startLegs opens a leg from the ride start for shared ride riders without
+// one, so riders given at start pay like riders picked up later.
+func startLegs(rd *db.Ride) {
+	if rd.Kind != unter.Shared.String() {
+		return
+	}
+
+	var legs []db.Leg
+	for _, login := range rd.Riders {
+		found := false
+		for _, l := range rd.Legs {
+			if l.Rider == login {
+				found = true
+				break
+			}
+		}
+		if !found {
+			legs = append(legs, db.Leg{Rider: login, Pickup: rd.Start})
+		}
+	}
+	rd.Legs = append(legs, rd.Legs...) // ordered by pickup
+}
+
+// addLeg picks up rider at t.
+func addLeg(rd *db.Ride, rider string, t time.Time) db.Leg {
+	leg := db.Leg{
+		Rider:  rider,
+		Pickup: t,
+	}
+	rd.Legs = append(rd.Legs, leg)
+	if !contains(rd.Riders, rider) {
+		rd.Riders = append(rd.Riders, rider)
+	}
+	return leg
+}
+
+// legBilling returns the billable distance of the part of the ride between
+// from and to.
+func legBilling(reported float64, locs []db.Location, from, to time.Time, cfg GPSConfig) billing {
+	var window []db.Location
+	for _, l := range locs {
+		if !l.Time.Before(from) && !l.Time.After(to) {
+			window = append(window, l)
+		}
+	}
+	return billableDistance(reported, toPoints(window), cfg)
+}
+
+// priceLegs closes open legs when rd ends and sets the leg fares. Open legs
+// without GPS get the ride distance in proportion to their time.
+func (s *Server) priceLegs(rd *db.Ride, locs []db.Location) error {
+	startLegs(rd) // rides started before riders had start legs
+	rideTime := rd.End.Sub(rd.Start)
+	for i := range rd.Legs {
+		l := &rd.Legs[i]
+		if !l.Dropoff.IsZero() {
+			continue
+		}
+
+		l.Dropoff = rd.End
+		bill := legBilling(0, locs, l.Pickup, l.Dropoff, s.gps)
+		l.Distance = bill.Distance
+		if bill.Flag == noGPSFlag && rideTime > 0 {
+			l.Distance = rd.Distance * float64(l.Dropoff.Sub(l.Pickup)) / float64(rideTime)
+		}
+	}
+
+	r, err := rideFromDB(*rd)
+	if err != nil {
+		return err
+	}
+	if err := r.Validate(); err != nil {
+		return err
+	}
+
+	for i, fare := range unter.SplitFare(r) {
+		rd.Legs[i].Fare = fare
+	}
+	return nil
+}
+
+// activeSharedRide returns the ride in the URL if it's an active shared ride
+// of the user, it sends an error and returns false if not.
+func (s *Server) activeSharedRide(w http.ResponseWriter, r *http.Request) (db.Ride, bool) {
+	if !requireRole(w, r, Writer, Admin) {
+		return db.Ride{}, false
+	}
+
+	rd, err := s.db.Get(r.Context(), mux.Vars(r)["id"])
+	switch {
+	case errors.Is(err, db.ErrNotFound):
+		httpError(w, r, "not found", http.StatusNotFound)
+		return db.Ride{}, false
+	case err != nil:
+		httpError(w, r, "can't get", http.StatusInternalServerError)
+		return db.Ride{}, false
+	}
+
+	u := RequestValues(r.Context()).User
+	if u.Role != Admin && u.Login != rd.Driver {
+		httpError(w, r, "forbidden", http.StatusForbidden)
+		return db.Ride{}, false
+	}
+
+	if rd.Kind != unter.Shared.String() {
+		httpError(w, r, "not a shared ride", http.StatusConflict)
+		return db.Ride{}, false
+	}
+
+	if rd.Cancelled || !rd.End.IsZero() {
+		httpError(w, r, "ride not active", http.StatusConflict)
+		return db.Ride{}, false
+	}
+
+	return rd, true
+}
+
+func (s *Server) pickupHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Rider string
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, "bad json", http.StatusBadRequest)
+		return
+	}
+
+	rd, ok := s.activeSharedRide(w, r)
+	if !ok {
+		return
+	}
+	startLegs(&rd) // rides started before riders had start legs
+
+	for _, l := range rd.Legs {
+		if l.Rider == req.Rider {
+			httpError(w, r, "rider already picked up", http.StatusConflict)
+			return
+		}
+	}
+	if err := s.checkRiders(r.Context(), []string{req.Rider}); err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	onBoard := 1
+	for _, l := range rd.Legs {
+		if l.Dropoff.IsZero() {
+			onBoard++
+		}
+	}
+	if _, err := s.rideVehicle(r.Context(), rd.Driver, rd.CarID, unter.Shared, onBoard); err != nil {
+		vehicleError(w, r, err)
+		return
+	}
+
+	leg := addLeg(&rd, req.Rider, time.Now().UTC())
+	if err := s.db.Update(r.Context(), rd); err != nil {
+		httpError(w, r, "can't update", http.StatusInternalServerError)
+		return
+	}
+	if err := s.cache.Delete(r.Context(), rd.ID); err != nil {
+		ctxLogger(s.log, r.Context()).Printf("WARNING: can't invalidate cache for %s - %s", rd.ID, err)
+	}
+
+	resp := map[string]any{
+		"id":     rd.ID,
+		"action": "pickup",
+		"rider":  leg.Rider,
+		"legs":   len(rd.Legs),
+	}
+	if err := sendJSON(w, resp); err != nil {
+		httpError(w, r, "can't marshal to JSON", http.StatusInternalServerError)
+	}
+}
+
+func (s *Server) dropoffHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Distance float64
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, "bad json", http.StatusBadRequest)
+		return
+	}
+	if req.Distance < 0 {
+		httpError(w, r, "negative distance", http.StatusBadRequest)
+		return
+	}
+
+	rd, ok := s.activeSharedRide(w, r)
+	if !ok {
+		return
+	}
+
+	rider := mux.Vars(r)["rider"]
+	i := -1
+	for j, l := range rd.Legs {
+		if l.Rider == rider {
+			i = j
+		}
+	}
+	if i == -1 {
+		httpError(w, r, "rider not on ride", http.StatusNotFound)
+		return
+	}
+	l := &rd.Legs[i]
+	if !l.Dropoff.IsZero() {
+		httpError(w, r, "rider already dropped off", http.StatusConflict)
+		return
+	}
+
+	locs, err := s.db.Locations(r.Context(), rd.ID)
+	if err != nil {
+		httpError(w, r, "can't get locations", http.StatusInternalServerError)
+		return
+	}
+	l.Dropoff = time.Now().UTC()
+	bill := legBilling(req.Distance, locs, l.Pickup, l.Dropoff, s.gps)
+	if bill.Flag == noGPSFlag && req.Distance == 0 {
+		httpError(w, r, "missing distance", http.StatusBadRequest)
+		return
+	}
+	l.Distance = bill.Distance
+
+	if err := s.db.Update(r.Context(), rd); err != nil {
+		httpError(w, r, "can't update", http.StatusInternalServerError)
+		return
+	}
+	if err := s.cache.Delete(r.Context(), rd.ID); err != nil {
+		ctxLogger(s.log, r.Context()).Printf("WARNING: can't invalidate cache for %s - %s", rd.ID, err)
+	}
+
+	resp := map[string]any{
+		"id":       rd.ID,
+		"action":   "dropoff",
+		"rider":    rider,
+		"distance": l.Distance,
+	}
+	if err := sendJSON(w, resp); err != nil {
+		httpError(w, r, "can't marshal to JSON", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/353solutions/unter/db"
+	"github.com/353solutions/unter/ledger"
+)
+
+func TestPriceLegs(t *testing.T) {
+	require := require.New(t)
+
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	at := func(min int) time.Time { return start.Add(time.Duration(min) * time.Minute) }
+	rd := db.Ride{
+		ID:       "r1",
+		Driver:   "Bond",
+		Kind:     "shared",
+		Start:    start,
+		End:      at(10),
+		Distance: 4,
+		Riders:   []string{"m", "q"},
+		Legs: []db.Leg{
+			{Rider: "m", Pickup: at(0)}, // open, no GPS
+			{Rider: "q", Pickup: at(2), Dropoff: at(4), Distance: 1},
+		},
+	}
+
+	s := Server{gps: GPSConfig{MaxSpeed: 120, Tolerance: 0.25}}
+	require.NoError(s.priceLegs(&rd, nil))
+	require.Equal(at(10), rd.Legs[0].Dropoff)
+	require.InDelta(4, rd.Legs[0].Distance, 0.001)
+	require.Equal(800, rd.Legs[0].Fare)
+	require.Equal(200, rd.Legs[1].Fare)
+
+	// Leg of a rider that's not on the ride
+	rd.Legs = append(rd.Legs, db.Leg{Rider: "x", Pickup: at(1), Dropoff: at(2)})
+	require.Error(s.priceLegs(&rd, nil))
+}
+
+func TestStartRiderLeg(t *testing.T) {
+	require := require.New(t)
+
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	at := func(min int) time.Time { return start.Add(time.Duration(min) * time.Minute) }
+
+	// Started with m, q picked up on the way
+	rd := db.Ride{
+		ID:     "r1",
+		Driver: "Bond",
+		Kind:   "shared",
+		Start:  start,
+		Riders: []string{"m"},
+	}
+	startLegs(&rd)
+	require.Equal([]db.Leg{{Rider: "m", Pickup: start}}, rd.Legs)
+	addLeg(&rd, "q", at(2))
+	rd.Legs[1].Dropoff, rd.Legs[1].Distance = at(4), 1
+	rd.End, rd.Distance = at(10), 4
+
+	s := Server{gps: GPSConfig{MaxSpeed: 120, Tolerance: 0.25}}
+	require.NoError(s.priceLegs(&rd, nil))
+	fare, err := s.priceRide(&rd, s.fares.extras(0))
+	require.NoError(err)
+	require.Equal([]int{800, 200}, fare.Legs)
+
+	e, err := rideEntry(rd, fare)
+	require.NoError(err)
+	p := postings(e)
+	require.Equal(800, p[ledger.RiderAccount("m")])
+	require.Equal(200, p[ledger.RiderAccount("q")])
+
+	// Rides started without start legs get them when priced
+	rd.Legs = rd.Legs[1:]
+	rd.Legs[0].Fare = 0
+	require.NoError(s.priceLegs(&rd, nil))
+	require.Len(rd.Legs, 2)
+	require.Equal(800, rd.Legs[0].Fare)
+}
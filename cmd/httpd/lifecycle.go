@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type shutdownStep struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+// Lifecycle runs a server and shuts it down in order.
+// Shutdown steps run in the order they were registered, all of them sharing
+// the grace period.
+type Lifecycle struct {
+	log   *log.Logger
+	grace time.Duration
+	steps []shutdownStep
+}
+
+func NewLifecycle(log *log.Logger, grace time.Duration) *Lifecycle {
+	return &Lifecycle{
+		log:   log,
+		grace: grace,
+	}
+}
+
+// OnShutdown registers a shutdown step.
+func (l *Lifecycle) OnShutdown(name string, fn func(ctx context.Context) error) {
+	l.steps = append(l.steps, shutdownStep{name, fn})
+}
+
+// OnClose registers a shutdown step for a resource that doesn't take a context.
+func (l *Lifecycle) OnClose(name string, fn func() error) {
+	l.OnShutdown(name, func(context.Context) error { return fn() })
+}
+
+// Run calls serve and waits until ctx is done or serve returns, then shuts
+// down. Use signal.NotifyContext to shut down on signals.
+func (l *Lifecycle) Run(ctx context.Context, serve func() error) error {
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- serve()
+	}()
+
+	var err error
+	select {
+	case <-ctx.Done():
+		l.log.Printf("INFO: shutting down (%s)", ctx.Err())
+	case err = <-errCh:
+		if errors.Is(err, http.ErrServerClosed) {
+			err = nil
+		}
+		if err != nil {
+			l.log.Printf("ERROR: server failed - %s", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), l.grace)
+	defer cancel()
+	if serr := l.Shutdown(ctx); err == nil {
+		err = serr
+	}
+
+	return err
+}
+
+// Shutdown runs all shutdown steps, it returns the first error.
+// Steps run even if previous ones failed or the grace period is over so
+// resources are always closed.
+func (l *Lifecycle) Shutdown(ctx context.Context) error {
+	var first error
+	for _, s := range l.steps {
+		start := time.Now()
+		err := s.fn(ctx)
+		if err != nil {
+			l.log.Printf("WARNING: shutdown %s - %s", s.name, err)
+			if first == nil {
+				first = fmt.Errorf("%s: %w", s.name, err)
+			}
+			continue
+		}
+		l.log.Printf("INFO: shutdown %s done in %v", s.name, time.Since(start))
+	}
+
+	return first
+}
+
+// background tracks background goroutines so shutdown can drain them.
+type background struct {
+	once   sync.Once
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func (b *background) init() {
+	b.once.Do(func() {
+		b.ctx, b.cancel = context.WithCancel(context.Background())
+	})
+}
+
+// Go runs fn in a goroutine, ctx is cancelled on shutdown.
+func (b *background) Go(fn func(ctx context.Context)) {
+	b.init()
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		fn(b.ctx)
+	}()
+}
+
+// Stop cancels background goroutines and waits for them to finish or for ctx
+// to expire.
+func (b *background) Stop(ctx context.Context) error {
+	b.init()
+	b.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		b.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("background goroutines: %w", ctx.Err())
+	}
+}
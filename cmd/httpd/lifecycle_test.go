@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLifecycleDrain(t *testing.T) {
+	require := require.New(t)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err, "listen")
+
+	started := make(chan struct{})
+	h := func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte("done")) //#nosec G104
+	}
+	srv := http.Server{Handler: http.HandlerFunc(h)}
+
+	var bg background
+	bgDone := false
+	bg.Go(func(ctx context.Context) {
+		<-ctx.Done()
+		time.Sleep(10 * time.Millisecond)
+		bgDone = true
+	})
+
+	p := NewProber(time.Second)
+	var steps []string
+	lc := NewLifecycle(log.New(io.Discard, "", 0), time.Second)
+	lc.OnShutdown("readiness", func(context.Context) error {
+		p.SetDraining()
+		steps = append(steps, "readiness")
+		return nil
+	})
+	lc.OnShutdown("http", func(ctx context.Context) error {
+		steps = append(steps, "http")
+		return srv.Shutdown(ctx)
+	})
+	lc.OnShutdown("background", bg.Stop)
+	lc.OnClose("db", func() error {
+		steps = append(steps, "db")
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- lc.Run(ctx, func() error { return srv.Serve(ln) })
+	}()
+
+	respCh := make(chan string, 1)
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String())
+		if err != nil {
+			respCh <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		respCh <- string(data)
+	}()
+
+	<-started
+	cancel() // instead of a signal
+
+	require.NoError(<-runErr, "run")
+	require.Equal("done", <-respCh, "in-flight request")
+	require.True(bgDone, "background")
+	require.Equal([]string{"readiness", "http", "db"}, steps)
+	require.False(p.Check().Ready(), "readiness")
+}
+
+func TestBackgroundStopTimeout(t *testing.T) {
+	var bg background
+	block := make(chan struct{})
+	defer close(block)
+	bg.Go(func(context.Context) { <-block })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.Error(t, bg.Stop(ctx))
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/353solutions/unter/db"
+	"github.com/353solutions/unter/geo"
+)
+
+/* GPS breadcrumbs
+
+POST /rides/{id}/locations
+	{"points": [{"lat": 32.07, "lon": 34.78, "time": "2026-03-01T12:00:00Z"}, ...]}
+
+Billable distance is computed from the locations when the ride ends, the
+driver reported distance is kept for comparison.
+*/
+
+// Distance flags, a flagged ride needs review.
+const (
+	noGPSFlag       = "no_gps"      // not enough locations, billed by reported distance
+	discrepancyFlag = "discrepancy" // reported and GPS distance differ
+)
+
+// minDiscrepancy is the smallest difference (miles) that's flagged, GPS is
+// noisy on short rides.
+const minDiscrepancy = 0.2
+
+// maxClockSkew is how far in the future location times can be.
+const maxClockSkew = time.Minute
+
+type billing struct {
+	Distance float64 // billable
+	Reported float64
+	GPS      geo.Track
+	Flag     string
+}
+
+func (b billing) String() string {
+	return fmt.Sprintf("reported=%.2f gps=%.2f (%d points, %d dropped)", b.Reported, b.GPS.Distance, b.GPS.Used, b.GPS.Dropped)
+}
+
+// billableDistance returns the distance to bill. It's the GPS distance if
+// there are at least two usable points, otherwise the reported distance.
+func billableDistance(reported float64, points []geo.Point, cfg GPSConfig) billing {
+	b := billing{
+		Reported: reported,
+		GPS:      geo.Distance(points, cfg.MaxSpeed),
+	}
+
+	if b.GPS.Used < 2 {
+		b.Distance, b.Flag = reported, noGPSFlag
+		return b
+	}
+
+	b.Distance = b.GPS.Distance
+	if reported > 0 {
+		diff := math.Abs(reported - b.GPS.Distance)
+		if diff > minDiscrepancy && diff > cfg.Tolerance*b.GPS.Distance {
+			b.Flag = discrepancyFlag
+		}
+	}
+	return b
+}
+
+func toPoints(locs []db.Location) []geo.Point {
+	points := make([]geo.Point, len(locs))
+	for i, l := range locs {
+		points[i] = geo.Point(l)
+	}
+	return points
+}
+
+func (s *Server) locationsHandler(w http.ResponseWriter, r *http.Request) {
+	v := RequestValues(r.Context())
+	if v == nil || !HasRole(v.User, Writer, Admin) {
+		httpError(w, r, "not allowed", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		Points []geo.Point
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, "bad json", http.StatusBadRequest)
+		return
+	}
+
+	if len(req.Points) == 0 {
+		httpError(w, r, "no points", http.StatusBadRequest)
+		return
+	}
+	if len(req.Points) > s.gps.MaxBatch {
+		httpError(w, r, fmt.Sprintf("too many points (max %d)", s.gps.MaxBatch), http.StatusBadRequest)
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+	rd, err := s.db.Get(r.Context(), id)
+	switch {
+	case errors.Is(err, db.ErrNotFound):
+		httpError(w, r, "not found", http.StatusNotFound)
+		return
+	case err != nil:
+		httpError(w, r, "can't get", http.StatusInternalServerError)
+		return
+	}
+
+	if v.User.Role != Admin && v.User.Login != rd.Driver {
+		httpError(w, r, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	if rd.Cancelled || !rd.End.IsZero() {
+		httpError(w, r, "ride not active", http.StatusConflict)
+		return
+	}
+
+	locs := make([]db.Location, len(req.Points))
+	maxTime := time.Now().Add(maxClockSkew)
+	for i, p := range req.Points {
+		if err := p.Validate(); err != nil {
+			httpError(w, r, fmt.Sprintf("point %d: %s", i, err), http.StatusBadRequest)
+			return
+		}
+		if p.Time.Before(rd.Start) || p.Time.After(maxTime) {
+			httpError(w, r, fmt.Sprintf("point %d: time out of ride", i), http.StatusBadRequest)
+			return
+		}
+		locs[i] = db.Location(p)
+		locs[i].Time = p.Time.UTC()
+	}
+
+	if err := s.db.AddLocations(r.Context(), id, locs); err != nil {
+		httpError(w, r, "can't insert", http.StatusInternalServerError)
+		return
+	}
+
+	resp := map[string]any{
+		"id":       id,
+		"accepted": len(locs),
+	}
+	if err := sendJSON(w, resp); err != nil {
+		httpError(w, r, "can't marshal to JSON", http.StatusInternalServerError)
+	}
+}
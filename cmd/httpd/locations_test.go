@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/353solutions/unter/geo"
+)
+
+// track returns points along the equator, ~0.69 miles apart a minute apart.
+func track(n int) []geo.Point {
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	points := make([]geo.Point, n)
+	for i := range points {
+		points[i] = geo.Point{Lat: 0, Lon: float64(i) * 0.01, Time: start.Add(time.Duration(i) * time.Minute)}
+	}
+	return points
+}
+
+var billingCases = []struct {
+	reported float64
+	points   []geo.Point
+	distance float64
+	flag     string
+}{
+	{3, nil, 3, noGPSFlag},
+	{3, track(1), 3, noGPSFlag},
+	{0, track(5), 2.76, ""},
+	{2.8, track(5), 2.76, ""},
+	{10, track(5), 2.76, discrepancyFlag},
+	{0.1, track(2), 0.69, discrepancyFlag},
+}
+
+func TestBillableDistance(t *testing.T) {
+	cfg := GPSConfig{MaxSpeed: 120, Tolerance: 0.25}
+	for _, tc := range billingCases {
+		name := fmt.Sprintf("%v-%d", tc.reported, len(tc.points))
+		t.Run(name, func(t *testing.T) {
+			b := billableDistance(tc.reported, tc.points, cfg)
+			require.InDelta(t, tc.distance, b.Distance, 0.01)
+			require.Equal(t, tc.flag, b.Flag)
+			require.Equal(t, tc.reported, b.Reported)
+		})
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	_ "embed"
 	"encoding/json"
 	"errors"
@@ -14,6 +15,7 @@ import (
 	"os"
 	"os/signal"
 	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -22,7 +24,14 @@ import (
 	"github.com/353solutions/unter"
 	"github.com/353solutions/unter/cache"
 	"github.com/353solutions/unter/db"
+	"github.com/353solutions/unter/dispatch"
+	"github.com/353solutions/unter/events"
+	"github.com/353solutions/unter/geo"
+	"github.com/353solutions/unter/ledger"
 	"github.com/353solutions/unter/logger"
+	"github.com/353solutions/unter/outbox"
+	"github.com/353solutions/unter/trace"
+	"github.com/353solutions/unter/webhook"
 )
 
 /* CRUD: Create, Retrieve, Update, Delete
@@ -35,7 +44,7 @@ import (
 /*
 API:
 POST /rides
-	car_id
+    car_id (optional, the driver's vehicle)
     driver
     kind (private, shared)
 -> ID
@@ -62,6 +71,23 @@ type Server struct {
 	db    *db.DB
 	cache *cache.Cache
 	log   *log.Logger
+	probe *Prober
+	bg    background
+
+	events    *events.Bus // nil disables ride events
+	heartbeat time.Duration
+	webhooks  *webhook.Dispatcher // nil disables webhooks
+	outbox    *outbox.Relay
+	ledger    *ledger.Ledger
+	gps       GPSConfig
+	ratings   RatingsConfig
+	fares     FaresConfig
+	estimates EstimatesConfig
+	zones     *geo.Zones // nil disables service zones
+	driverTTL time.Duration
+	matcher   *dispatch.Matcher
+
+	settings atomic.Pointer[Settings] // reloadable, see reload.go
 }
 
 func (s *Server) healthHandler(w http.ResponseWriter, r *http.Request) {
@@ -111,17 +137,24 @@ func (s *Server) startHandler(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		Driver string
 		Kind   string
+		CarID  string `json:"car_id"`
+		Riders []string
+		// Fare estimate, see estimates.go
+		EstimateID string `json:"estimate_id"`
+		// Start location, required when service zones are configured
+		Lat *float64
+		Lon *float64
 	}
 	// rdr := http.MaxBytesReader(w, r.Body, maxMsgSize)
 	// if err := json.NewDecoder(rdr).Decode(&req); err != nil {
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "bad json", http.StatusBadRequest)
+		httpError(w, r, "bad json", http.StatusBadRequest)
 		return
 	}
 
 	k, err := kindFromString(req.Kind)
 	if err != nil {
-		http.Error(w, "bad kind", http.StatusBadRequest)
+		httpError(w, r, "bad kind", http.StatusBadRequest)
 		return
 	}
 
@@ -130,41 +163,88 @@ func (s *Server) startHandler(w http.ResponseWriter, r *http.Request) {
 		Driver: strings.ToValidUTF8(req.Driver, ""),
 		Kind:   k,
 		Start:  time.Now().UTC(),
+		Riders: req.Riders,
 	}
 	if err := rd.Validate(); err != nil {
-		http.Error(w, "bad request", http.StatusBadRequest)
+		httpError(w, r, "bad request", http.StatusBadRequest)
 		return
 	}
 
 	v := RequestValues(r.Context())
 	if v == nil || v.User.Login != rd.Driver {
-		http.Error(w, "forbidden", http.StatusForbidden)
+		httpError(w, r, "forbidden", http.StatusForbidden)
 		return
 	}
 
 	if !HasRole(v.User, Writer, Admin) {
-		http.Error(w, "not allowed", http.StatusUnauthorized)
+		httpError(w, r, "not allowed", http.StatusUnauthorized)
+		return
+	}
+
+	if !s.canStart(w, r, rd.Driver) {
+		return
+	}
+	if err := s.checkRiders(r.Context(), rd.Riders); err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	car, err := s.rideVehicle(r.Context(), rd.Driver, req.CarID, rd.Kind, len(rd.Riders))
+	if err != nil {
+		vehicleError(w, r, err)
+		return
+	}
+	rd.CarID = car.ID
+
+	if req.EstimateID != "" {
+		if _, err := s.rideQuote(r.Context(), req.EstimateID, rd); err != nil {
+			quoteError(w, r, err)
+			return
+		}
+	}
+
+	pos, err := ridePosition(req.Lat, req.Lon)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	zone, err := s.startZone(pos)
+	switch {
+	case errors.Is(err, errOutsideZones):
+		httpError(w, r, err.Error(), http.StatusUnprocessableEntity)
+		return
+	case err != nil:
+		httpError(w, r, err.Error(), http.StatusBadRequest)
 		return
 	}
 
 	// Step 2: Work
 	// FIXME s.db.Add(rd)
 	dbr := db.Ride{
-		ID:     rd.ID,
-		Driver: rd.Driver,
-		Kind:   rd.Kind.String(),
-		Start:  rd.Start,
-	}
-	if err := s.db.Add(r.Context(), dbr); err != nil {
-		http.Error(w, "can't insert", http.StatusInternalServerError)
+		ID:        rd.ID,
+		Driver:    rd.Driver,
+		CarID:     rd.CarID,
+		Kind:      rd.Kind.String(),
+		Start:     rd.Start,
+		StartPos:  pos,
+		StartZone: zone,
+		Riders:    rd.Riders,
+		QuoteID:   req.EstimateID,
+	}
+	startLegs(&dbr)
+	if err := s.db.Add(r.Context(), dbr, rideEvent(events.RideStarted, dbr, dbr.Start)); err != nil {
+		httpError(w, r, "can't insert", http.StatusInternalServerError)
 		return
 	}
+	s.setAvailability(r.Context(), rd.Driver, unter.OnTrip)
 
 	// Step 3: Marshal & send response
 	resp := map[string]any{
 		"id":     rd.ID,
 		"action": "start",
 	}
+	if zone != "" {
+		resp["zone"] = zone
+	}
 	/*
 		 if err := json.NewEncoder(w).Encode(resp); err != nil {
 			// Can't change response code
@@ -173,7 +253,7 @@ func (s *Server) startHandler(w http.ResponseWriter, r *http.Request) {
 
 	//	w.WriteHeader(http.StatusCreated)
 	if err := sendJSON(w, resp); err != nil {
-		http.Error(w, "can't marshal to JSON", http.StatusInternalServerError)
+		httpError(w, r, "can't marshal to JSON", http.StatusInternalServerError)
 		return
 
 	}
@@ -186,49 +266,201 @@ POST /rides/{id}/end
 	{"distance": 1.3}
 */
 func (s *Server) endHandler(w http.ResponseWriter, r *http.Request) {
+	v := RequestValues(r.Context())
+	if v == nil || !HasRole(v.User, Writer, Admin) {
+		httpError(w, r, "not allowed", http.StatusUnauthorized)
+		return
+	}
+
 	var req struct {
 		Distance float64
+		Tip      int // ¢
+		// End location, defaults to the last GPS location
+		Lat *float64
+		Lon *float64
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "bad json", http.StatusBadRequest)
+		httpError(w, r, "bad json", http.StatusBadRequest)
 		return
 	}
 
-	if req.Distance == 0 {
-		http.Error(w, "missing distance", http.StatusBadRequest)
+	// Distance is optional when there are GPS locations, see locations.go
+	if req.Distance < 0 {
+		httpError(w, r, "negative distance", http.StatusBadRequest)
 		return
 	}
-	if req.Distance < 0 {
-		http.Error(w, "negative distance", http.StatusBadRequest)
+	if req.Tip < 0 || req.Tip > s.fares.MaxTip {
+		httpError(w, r, fmt.Sprintf("tip must be between 0 and %d¢", s.fares.MaxTip), http.StatusBadRequest)
+		return
+	}
+	endPos, err := ridePosition(req.Lat, req.Lon)
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
 		return
 	}
 
 	vars := mux.Vars(r)
 	id := vars["id"]
 	rd, err := s.db.Get(r.Context(), id)
+	switch {
+	case errors.Is(err, db.ErrNotFound):
+		httpError(w, r, "not found", http.StatusNotFound)
+		return
+	case err != nil:
+		httpError(w, r, "can't get", http.StatusInternalServerError)
+		return
+	}
+
+	if v.User.Role != Admin && v.User.Login != rd.Driver {
+		httpError(w, r, "forbidden", http.StatusForbidden)
+		return
+	}
+	if rd.Cancelled {
+		httpError(w, r, "ride cancelled", http.StatusConflict)
+		return
+	}
+	if !rd.End.IsZero() {
+		httpError(w, r, "ride ended", http.StatusConflict)
+		return
+	}
+
+	locs, err := s.db.Locations(r.Context(), id)
 	if err != nil {
-		http.Error(w, "not found", http.StatusNotFound)
+		httpError(w, r, "can't get locations", http.StatusInternalServerError)
 		return
 	}
-	rd.Distance = req.Distance
+	bill := billableDistance(req.Distance, toPoints(locs), s.gps)
+	if bill.Flag == noGPSFlag && req.Distance == 0 {
+		httpError(w, r, "missing distance", http.StatusBadRequest)
+		return
+	}
+	if bill.Flag != "" {
+		ctxLogger(s.log, r.Context()).Printf("WARNING: ride %s distance flagged %s: %s", id, bill.Flag, bill)
+	}
+
+	if endPos == nil && len(locs) > 0 {
+		last := locs[len(locs)-1]
+		endPos = &db.Position{Lat: last.Lat, Lon: last.Lon}
+	}
+
+	rd.EndPos = endPos
+	rd.EndZone = s.endZone(endPos)
+	rd.Distance = bill.Distance
+	rd.ReportedDistance = req.Distance
+	rd.DistanceFlag = bill.Flag
 	rd.End = time.Now().UTC()
-	if err := s.db.Update(r.Context(), rd); err != nil {
-		http.Error(w, "can't update", http.StatusInternalServerError)
+	if len(rd.Legs) > 0 {
+		if err := s.priceLegs(&rd, locs); err != nil {
+			httpError(w, r, fmt.Sprintf("bad legs - %s", err), http.StatusBadRequest)
+			return
+		}
+	}
+	x, err := s.fareExtras(r.Context(), rd, locs, req.Tip)
+	if err != nil {
+		httpError(w, r, "can't get estimate", http.StatusInternalServerError)
+		return
+	}
+	fare, err := s.priceRide(&rd, x)
+	if err != nil {
+		httpError(w, r, fmt.Sprintf("can't price - %s", err), http.StatusBadRequest)
+		return
+	}
+	entry, err := rideEntry(rd, fare)
+	if err != nil {
+		httpError(w, r, fmt.Sprintf("can't post fare - %s", err), http.StatusInternalServerError)
 		return
 	}
-	// TODO: invalidate cache
+	quoteID := ""
+	if x.CapRider != "" {
+		quoteID = rd.QuoteID
+	}
+	err = s.db.EndRide(r.Context(), rd, quoteID, []db.JournalEntry{journalEntry(entry)}, rideEvent(events.RideEnded, rd, rd.End))
+	switch {
+	case errors.Is(err, db.ErrQuoteUsed):
+		// Another ride ended with the quote since fareExtras, ending again prices without it
+		httpError(w, r, "estimate used by another ride", http.StatusConflict)
+		return
+	case err != nil:
+		httpError(w, r, "can't update", http.StatusInternalServerError)
+		return
+	}
+	s.setAvailability(r.Context(), rd.Driver, unter.Online)
+	if err := s.cache.Delete(r.Context(), id); err != nil {
+		ctxLogger(s.log, r.Context()).Printf("WARNING: can't invalidate cache for %s - %s", id, err)
+	}
 
 	resp := map[string]any{
-		"id":     id,
-		"action": "end",
+		"id":       id,
+		"action":   "end",
+		"distance": rd.Distance,
+		"fare":     fare,
+	}
+	if len(rd.Legs) > 0 {
+		resp["legs"] = legResponses(rd.Legs)
+	}
+
+	if err := sendJSON(w, resp); err != nil {
+		httpError(w, r, "can't marshal to JSON", http.StatusInternalServerError)
+		return
+	}
+}
+
+// POST /rides/{id}/cancel
+// Only the ride driver (or an admin) can cancel, and only an active ride.
+func (s *Server) cancelHandler(w http.ResponseWriter, r *http.Request) {
+	v := RequestValues(r.Context())
+	if v == nil || !HasRole(v.User, Writer, Admin) {
+		httpError(w, r, "not allowed", http.StatusUnauthorized)
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+	rd, err := s.db.Get(r.Context(), id)
+	switch {
+	case errors.Is(err, db.ErrNotFound):
+		httpError(w, r, "not found", http.StatusNotFound)
+		return
+	case err != nil:
+		httpError(w, r, "can't get", http.StatusInternalServerError)
+		return
+	}
+
+	if v.User.Role != Admin && v.User.Login != rd.Driver {
+		httpError(w, r, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	if rd.Cancelled || !rd.End.IsZero() {
+		httpError(w, r, "ride not active", http.StatusConflict)
+		return
+	}
+
+	rd.Cancelled = true
+	rd.End = time.Now().UTC()
+	if err := s.db.Update(r.Context(), rd, rideEvent(events.RideCancelled, rd, rd.End)); err != nil {
+		httpError(w, r, "can't update", http.StatusInternalServerError)
+		return
+	}
+	s.setAvailability(r.Context(), rd.Driver, unter.Online)
+	if err := s.cache.Delete(r.Context(), id); err != nil {
+		ctxLogger(s.log, r.Context()).Printf("WARNING: can't invalidate cache for %s - %s", id, err)
 	}
 
+	resp := map[string]any{
+		"id":     id,
+		"action": "cancel",
+	}
 	if err := sendJSON(w, resp); err != nil {
-		http.Error(w, "can't marshal to JSON", http.StatusInternalServerError)
+		httpError(w, r, "can't marshal to JSON", http.StatusInternalServerError)
 		return
 	}
 }
 
+// httpError sends an error message with the request ID so callers can report it.
+func httpError(w http.ResponseWriter, r *http.Request, msg string, code int) {
+	http.Error(w, fmt.Sprintf("%s (%s)", msg, RequestID(r.Context())), code)
+}
+
 // any = interface{} (go >= 1.18)
 func sendJSON(w http.ResponseWriter, val any) error {
 	data, err := json.Marshal(val)
@@ -242,12 +474,56 @@ func sendJSON(w http.ResponseWriter, val any) error {
 }
 
 type GetResponse struct {
-	ID       string     `json:"id,omitempty"`
-	Driver   string     `json:"driver,omitempty"`
-	Kind     string     `json:"kind,omitempty"`
-	Start    time.Time  `json:"start,omitempty"`
-	End      *time.Time `json:"end,omitempty"`
-	Distance float64    `json:"distance,omitempty"`
+	ID        string     `json:"id,omitempty"`
+	Driver    string     `json:"driver,omitempty"`
+	CarID     string     `json:"car_id,omitempty"`
+	Kind      string     `json:"kind,omitempty"`
+	Start     time.Time  `json:"start,omitempty"`
+	End       *time.Time `json:"end,omitempty"`
+	Distance  float64    `json:"distance,omitempty"`
+	Cancelled bool       `json:"cancelled,omitempty"`
+
+	ReportedDistance float64 `json:"reported_distance,omitempty"`
+	DistanceFlag     string  `json:"distance_flag,omitempty"`
+
+	StartZone string `json:"start_zone,omitempty"`
+	EndZone   string `json:"end_zone,omitempty"`
+
+	Riders []string      `json:"riders,omitempty"`
+	Legs   []LegResponse `json:"legs,omitempty"`
+
+	Fare       *FareResponse `json:"fare,omitempty"`
+	EstimateID string        `json:"estimate_id,omitempty"`
+}
+
+func rideResponse(rd db.Ride) GetResponse {
+	resp := GetResponse{
+		ID:        rd.ID,
+		Driver:    rd.Driver,
+		CarID:     rd.CarID,
+		Kind:      rd.Kind,
+		Start:     rd.Start,
+		Distance:  rd.Distance,
+		Cancelled: rd.Cancelled,
+
+		ReportedDistance: rd.ReportedDistance,
+		DistanceFlag:     rd.DistanceFlag,
+
+		StartZone: rd.StartZone,
+		EndZone:   rd.EndZone,
+
+		Riders: rd.Riders,
+		Legs:   legResponses(rd.Legs),
+
+		EstimateID: rd.QuoteID,
+	}
+	if !rd.End.Equal(time.Time{}) {
+		resp.End = &rd.End
+	}
+	if f, err := rideFare(rd); err == nil { // rd.Fare is still valid
+		resp.Fare = f
+	}
+	return resp
 }
 
 func ctxLogger(logger *log.Logger, ctx context.Context) *log.Logger {
@@ -280,31 +556,21 @@ func (s *Server) getHandler(w http.ResponseWriter, r *http.Request) {
 	rd, err := s.db.Get(r.Context(), id)
 	switch {
 	case errors.Is(err, db.ErrNotFound):
-		http.Error(w, "not found", http.StatusNotFound)
+		httpError(w, r, "not found", http.StatusNotFound)
 		return
 	case err != nil:
-		http.Error(w, "can't get", http.StatusInternalServerError)
+		httpError(w, r, "can't get", http.StatusInternalServerError)
 		return
 	}
 
-	resp := GetResponse{
-		ID:       rd.ID,
-		Driver:   rd.Driver,
-		Kind:     rd.Kind,
-		Start:    rd.Start,
-		Distance: rd.Distance,
-	}
-	if !rd.End.Equal(time.Time{}) {
-		resp.End = &rd.End
-	}
-
+	resp := rideResponse(rd)
 	data, err = json.Marshal(resp)
 	if err == nil {
 		s.cache.Set(r.Context(), id, data) //#nosec G104
 	}
 
 	if err := sendJSON(w, resp); err != nil {
-		http.Error(w, "can't marshal to JSON", http.StatusInternalServerError)
+		httpError(w, r, "can't marshal to JSON", http.StatusInternalServerError)
 		return
 	}
 }
@@ -317,19 +583,38 @@ JSON -> Go io.Reader: Decoder
 */
 
 func (s *Server) infoHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireRole(w, r, Rider, Writer, Admin) {
+		return
+	}
+
 	vars := mux.Vars(r)
 	id := vars["id"]
 	rd, err := s.db.Get(r.Context(), id)
+	switch {
+	case errors.Is(err, db.ErrNotFound):
+		httpError(w, r, "not found", http.StatusNotFound)
+		return
+	case err != nil:
+		httpError(w, r, "can't get", http.StatusInternalServerError)
+		return
+	}
+
+	u := RequestValues(r.Context()).User
+	if !canView(u, rd) {
+		httpError(w, r, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	rc, err := newReceipt(rd, u, time.Now().UTC())
 	if err != nil {
-		http.Error(w, "not found", http.StatusNotFound)
+		ctxLogger(s.log, r.Context()).Printf("ERROR: ride %s: can't build receipt - %s", id, err)
+		httpError(w, r, "can't build receipt", http.StatusInternalServerError)
 		return
 	}
 
-	// fee := unter.RideFee(rd.End.Sub(rd.Start), rd.Distance, rd.Kind == unter.Shared.String())
 	w.Header().Set("Content-Type", "text/html")
 	// exercise: replace printf with html/template
-	// fmt.Fprintf(w, infoHTML, rd.ID, rd.Driver, rd.Start, rd.End, rd.Kind, rd.Distance, fee)
-	if err := infoTemplate.Execute(w, rd); err != nil {
+	if err := infoTemplate.Execute(w, rc); err != nil {
 		s.log.Printf("WARNING: failed to executed template - %s", err)
 	}
 }
@@ -339,31 +624,87 @@ var version = "1.2.3"
 func buildRouter(s *Server) *http.ServeMux {
 	r := mux.NewRouter()
 	r.HandleFunc("/health", s.healthHandler).Methods("GET")
+	r.HandleFunc("/livez", s.livezHandler).Methods("GET")
+	r.HandleFunc("/readyz", s.readyzHandler).Methods("GET")
 	r.HandleFunc("/rides", s.startHandler).Methods("POST")
+	r.HandleFunc("/rides/events", s.eventsHandler).Methods("GET") // before /rides/{id}
 	r.HandleFunc("/rides/{id}", s.getHandler).Methods("GET")
 	r.HandleFunc("/rides/{id}/end", s.endHandler).Methods("POST")
+	r.HandleFunc("/rides/{id}/cancel", s.cancelHandler).Methods("POST")
+	r.HandleFunc("/rides/{id}/locations", s.locationsHandler).Methods("POST")
+	r.HandleFunc("/rides/{id}/legs", s.pickupHandler).Methods("POST")
+	r.HandleFunc("/rides/{id}/legs/{rider}/dropoff", s.dropoffHandler).Methods("POST")
+	r.HandleFunc("/rides/{id}/events", s.eventsHandler).Methods("GET")
+	r.HandleFunc("/rides/{id}/rating", s.rateHandler).Methods("POST")
+	r.HandleFunc("/drivers", s.addDriverHandler).Methods("POST")
+	r.HandleFunc("/drivers/me/heartbeat", s.heartbeatHandler).Methods("POST")
+	r.HandleFunc("/drivers/me/offer", s.offerHandler).Methods("GET") // before /drivers/{login}
+	r.HandleFunc("/drivers/{login}", s.getDriverHandler).Methods("GET")
+	r.HandleFunc("/drivers/{login}/state", s.driverStateHandler).Methods("POST")
+	r.HandleFunc("/drivers/{login}/stats", s.driverStatsHandler).Methods("GET")
+	r.HandleFunc("/vehicles", s.addVehicleHandler).Methods("POST")
+	r.HandleFunc("/vehicles/{id}", s.getVehicleHandler).Methods("GET")
+	r.HandleFunc("/vehicles/{id}/assign", s.assignVehicleHandler).Methods("POST")
+	r.HandleFunc("/vehicles/{id}/assignments", s.assignmentsHandler).Methods("GET")
+	r.HandleFunc("/riders", s.addRiderHandler).Methods("POST")
+	r.HandleFunc("/estimate", s.estimateHandler).Methods("GET")
+	r.HandleFunc("/me/rides", s.myRidesHandler).Methods("GET")
+	r.HandleFunc("/ride-requests", s.requestRideHandler).Methods("POST")
+	r.HandleFunc("/ride-requests/{id}", s.getRideRequestHandler).Methods("GET")
+	r.HandleFunc("/ride-requests/{id}/cancel", s.cancelRideRequestHandler).Methods("POST")
+	r.HandleFunc("/ride-requests/{id}/accept", s.acceptHandler).Methods("POST")
+	r.HandleFunc("/ride-requests/{id}/decline", s.declineHandler).Methods("POST")
+	r.HandleFunc("/admin/drivers/review", s.reviewDriversHandler).Methods("GET")
+	r.HandleFunc("/admin/ledger/balance", s.balanceHandler).Methods("GET")
+	r.HandleFunc("/admin/rides/{id}/refund", s.refundHandler).Methods("POST")
+	r.HandleFunc("/admin/drivers/{login}/payout", s.payoutHandler).Methods("POST")
+	r.HandleFunc("/admin/webhooks", s.addWebhookHandler).Methods("POST")
+	r.HandleFunc("/admin/webhooks", s.listWebhooksHandler).Methods("GET")
+	r.HandleFunc("/admin/webhooks/{id}", s.deleteWebhookHandler).Methods("DELETE")
+	r.HandleFunc("/admin/webhooks/{id}/deliveries", s.listDeliveriesHandler).Methods("GET")
+	r.HandleFunc("/admin/deliveries/{id}", s.getDeliveryHandler).Methods("GET")
+	r.HandleFunc("/admin/deliveries/{id}/retry", s.retryDeliveryHandler).Methods("POST")
+	r.HandleFunc("/admin/outbox/{id}/retry", s.retryOutboxHandler).Methods("POST")
 	r.HandleFunc("/debug/pprof/profile", pprof.Profile)
 	r.HandleFunc("/info/{id}", s.infoHandler)
+	r.Use(routeMiddleware)
 
 	mux := http.NewServeMux()
-	h := topMiddleware(s.log, r)
-	h = http.MaxBytesHandler(h, 3_000_000)
+	h := topMiddleware(s.log, s.Settings, s.riderLogin, r)
 	mux.Handle("/", h)
 	return mux
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "certs" {
+		if err := certsCmd(os.Args[2:], os.Stdout); err != nil {
+			log.Printf("ERROR: %s", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if err := run(); err != nil {
+		log.Printf("ERROR: %s", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
 	var err error
 	infoTemplate, err = template.New("info").Parse(infoHTML)
 	if err != nil {
-		log.Printf("ERROR: can't compile template - %s", err)
-		os.Exit(1)
+		return fmt.Errorf("can't compile template - %w", err)
 	}
 
 	cfg, err := loadConfig()
 	if err != nil {
-		log.Printf("ERROR: can't load config - %s", err)
-		os.Exit(1)
+		return fmt.Errorf("can't load config - %w", err)
+	}
+
+	if cfg.PrintConfig {
+		fmt.Print(cfg.Dump())
+		return nil
 	}
 
 	expvar.NewString("version").Set(version)
@@ -374,76 +715,221 @@ func main() {
 	expvar.NewString("host").Set(host)
 	// service name....
 
-	logger, err := logger.New("[UNTER] ", cfg.LogFile)
+	logger, logFile, err := logger.New("[UNTER] ", cfg.LogFile, cfg.Secrets()...)
 	if err != nil {
-		log.Printf("ERROR: can't load logger - %s", err)
-		os.Exit(1)
+		return fmt.Errorf("can't load logger - %w", err)
+	}
+	// Closed last, after all shutdown steps are logged
+	defer func() {
+		if err := logFile.Close(); err != nil {
+			log.Printf("WARNING: can't close log file - %s", err)
+		}
+	}()
+
+	logger.Printf("INFO: config:\n%s", cfg.Dump())
+
+	switch cfg.Trace.Exporter {
+	case "stdout":
+		trace.SetExporter(trace.NewStdoutExporter())
+	case "file":
+		e, err := trace.NewFileExporter(cfg.Trace.File)
+		if err != nil {
+			return fmt.Errorf("can't open trace file - %w", err)
+		}
+		defer e.Close()
+		trace.SetExporter(e)
+	}
+	trace.Default.OnError = func(err error) {
+		logger.Printf("WARNING: can't export span - %s", err)
+	}
+
+	// Load files before connecting so a bad file won't leave connections open
+	settings, err := NewSettings(cfg)
+	if err != nil {
+		return err
+	}
 
+	var zones *geo.Zones
+	if cfg.Zones.File != "" {
+		zones, err = geo.LoadZones(cfg.Zones.File)
+		if err != nil {
+			return fmt.Errorf("can't load zones - %w", err)
+		}
+		logger.Printf("INFO: %d service zones loaded from %s", zones.Len(), cfg.Zones.File)
 	}
 
-	// logger.Printf("INFO: config=%#v", cfg)
-	logger.Printf("INFO: config: Addr: %#v, CacheAddr: %#v, LogFile: %#v", cfg.Addr, cfg.CacheAddr, cfg.LogFile)
+	var (
+		certs     *certReloader
+		tlsConfig *tls.Config
+	)
+	if !cfg.TLS.Disable {
+		certs, err = newCertReloader(cfg.TLS.Cert, cfg.TLS.Key)
+		if err != nil {
+			return fmt.Errorf("can't load TLS certificate - %w", err)
+		}
+		tlsConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: certs.GetCertificate,
+		}
+		if err := certs.checkExpiry(cfg.TLS.ExpiryWarning); err != nil {
+			logger.Printf("WARNING: %s", err)
+		}
+		if cfg.TLS.ClientAuth != "none" {
+			tlsConfig.ClientAuth, _ = clientAuthType(cfg.TLS.ClientAuth) // validated in config
+			tlsConfig.ClientCAs, err = loadCertPool(cfg.TLS.ClientCA)
+			if err != nil {
+				return fmt.Errorf("can't load client CA - %w", err)
+			}
+		}
+	}
 
+	// Connections are closed on return, after the shutdown steps
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 	db, err := db.Connect(ctx, cfg.DSN)
 	if err != nil {
-		logger.Printf("ERROR: can't connect to database - %s", err)
-		os.Exit(1)
+		return fmt.Errorf("can't connect to database - %w", err)
 	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			logger.Printf("WARNING: can't close database - %s", err)
+		}
+	}()
 
 	ctx, cancel = context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
-	cache, err := cache.Connect(ctx, cfg.CacheAddr, time.Minute)
+	cache, err := cache.Connect(ctx, cfg.CacheAddr, cfg.CacheTTL)
 	if err != nil {
-		logger.Printf("ERROR: can't connect to cache - %s", err)
-		os.Exit(1)
+		return fmt.Errorf("can't connect to cache - %w", err)
 	}
+	defer func() {
+		if err := cache.Close(); err != nil {
+			logger.Printf("WARNING: can't close cache - %s", err)
+		}
+	}()
 
 	s := Server{
-		db:    db, // injection
-		cache: cache,
-		log:   logger,
+		db:        db, // injection
+		cache:     cache,
+		log:       logger,
+		events:    events.NewBus(cache, events.NewBroker(cfg.Events.History)),
+		heartbeat: cfg.Events.Heartbeat,
+		gps:       cfg.GPS,
+		ratings:   cfg.Ratings,
+		fares:     cfg.Fares,
+		estimates: cfg.Estimates,
+		ledger:    ledger.New(ledgerStore{db}),
+		zones:     zones,
+		driverTTL: cfg.Drivers.HeartbeatTTL,
+	}
+	s.settings.Store(settings)
+
+	s.matcher = dispatch.NewMatcher(cfg.Dispatch.Precision, s.acceptRide)
+	s.matcher.OfferTimeout = cfg.Dispatch.OfferTimeout
+	s.matcher.Radius = cfg.Dispatch.Radius
+	s.matcher.MaxOffers = cfg.Dispatch.MaxOffers
+	s.matcher.TTL = cfg.Drivers.HeartbeatTTL
+
+	s.webhooks = webhook.NewDispatcher(webhookStore{db}, cfg.Webhooks.Timeout)
+	s.webhooks.MaxAttempts = cfg.Webhooks.MaxAttempts
+	s.webhooks.OnError = func(err error) {
+		logger.Printf("ERROR: webhooks: %s", err)
+	}
+
+	sinks, err := s.outboxSinks(cfg.Outbox, cache, logger)
+	if err != nil {
+		return err
+	}
+	s.outbox = outbox.NewRelay(outboxStore{db}, sinks...)
+	s.outbox.Retention = cfg.Outbox.Retention
+	s.outbox.MaxAttempts = cfg.Outbox.MaxAttempts
+	s.outbox.OnError = func(err error) {
+		logger.Printf("ERROR: outbox: %s", err)
+	}
+
+	var checks []Check
+	if certs != nil {
+		checks = append(checks, certExpiryCheck(certs, cfg.TLS.ExpiryWarning))
 	}
+	s.probe = s.defaultProber(cfg.Probe, checks...)
+
 	// routing
 	// - if route ends with / it's a prefix match
 	// - otherwise exact match
 	mux := buildRouter(&s)
 
 	srv := http.Server{
-		Addr:         cfg.Addr,
-		Handler:      mux,
-		ReadTimeout:  time.Second,
-		WriteTimeout: 2 * time.Second,
-	}
-
-	logger.Printf("INFO: server starting on %s", cfg.Addr)
-	errCh := make(chan error)
-	go func() {
-		errCh <- srv.ListenAndServeTLS("cert.pem", "key.pem")
-	}()
+		Addr:              cfg.Addr,
+		Handler:           mux,
+		TLSConfig:         tlsConfig,
+		ReadTimeout:       cfg.HTTP.ReadTimeout,
+		ReadHeaderTimeout: cfg.HTTP.ReadHeaderTimeout,
+		WriteTimeout:      cfg.HTTP.WriteTimeout,
+		IdleTimeout:       cfg.HTTP.IdleTimeout,
+	}
+
+	// Setup can't fail from here, start background work
+	rl := reloader{
+		s:     &s,
+		log:   logger,
+		load:  loadConfig,
+		cfg:   cfg,
+		certs: certs,
+	}
+	s.bg.Go(rl.Run)
+	s.bg.Go(s.runEvents)
+	s.bg.Go(func(ctx context.Context) {
+		s.webhooks.Run(ctx, cfg.Webhooks.PollInterval)
+	})
+	s.bg.Go(func(ctx context.Context) {
+		s.matcher.Run(ctx, time.Second)
+	})
+	s.bg.Go(func(ctx context.Context) {
+		s.outbox.Run(ctx, cfg.Outbox.PollInterval)
+	})
+
+	// Order matters: fail readiness so load balancers stop sending traffic,
+	// stop accepting and drain requests, stop background work. Connections
+	// are closed by the deferred calls above.
+	lc := NewLifecycle(logger, cfg.ShutdownGrace)
+	lc.OnShutdown("readiness", func(ctx context.Context) error {
+		s.probe.SetDraining()
+		return sleepCtx(ctx, cfg.ShutdownDelay)
+	})
+	// Event streams never end on their own, close them so Shutdown won't wait
+	lc.OnShutdown("events", func(context.Context) error {
+		s.events.Broker().Close()
+		return nil
+	})
+	lc.OnShutdown("http", srv.Shutdown)
+	lc.OnShutdown("background", s.bg.Stop)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	logger.Printf("INFO: server starting on %s (TLS: %v)", cfg.Addr, !cfg.TLS.Disable)
+	err = lc.Run(ctx, func() error {
+		if cfg.TLS.Disable {
+			return srv.ListenAndServe()
+		}
+		return srv.ListenAndServeTLS("", "") // certificate from TLSConfig
+	})
+	logger.Printf("INFO: server down")
+	return err
+}
 
-	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+// sleepCtx sleeps for d or until ctx is done.
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
 
-	exitCode := 0
+	t := time.NewTimer(d)
+	defer t.Stop()
 	select {
-	case sig := <-sigCh:
-		logger.Printf("INFO: caught signal %v, shutting down", sig)
-		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
-		defer cancel()
-		if err := srv.Shutdown(ctx); err != nil {
-			logger.Printf("WARNING: shutdown error - %s", err)
-		}
-	case err := <-errCh:
-		if !errors.Is(err, http.ErrServerClosed) {
-			logger.Printf("ERROR: %s", err)
-			exitCode = 1
-		}
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
-
-	logger.Printf("INFO: server down")
-	// cleanup
-	// s.db.Close() ...
-	os.Exit(exitCode)
 }
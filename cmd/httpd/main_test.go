@@ -35,6 +35,7 @@ func setupServer(t *testing.T) *Server {
 		cache: cache,
 		log:   log.Default(),
 	}
+	s.probe = s.defaultProber(cfg.Probe)
 	return &s
 }
 
@@ -70,10 +71,36 @@ func Test_startHandler(t *testing.T) {
 	require := require.New(t)
 	s := setupServer(t)
 
+	// Rides start only by registered, online drivers
+	login := "q-" + uuid.NewString()[:8]
+	d := db.Driver{
+		Login:          login,
+		Name:           "Q",
+		LicenseNumber:  "007",
+		LicenseExpires: time.Now().AddDate(1, 0, 0).UTC(),
+		State:          "active",
+		Availability:   "offline",
+		Created:        time.Now().UTC(),
+	}
+	ctx := context.Background()
+	require.NoError(s.db.AddDriver(ctx, d), "add driver")
+	require.NoError(s.db.DriverHeartbeat(ctx, login, "online", time.Now().UTC(), nil), "heartbeat")
+	car := db.Vehicle{
+		ID:                uuid.NewString(),
+		Plate:             login,
+		Capacity:          4,
+		Class:             "standard",
+		InspectionExpires: time.Now().AddDate(1, 0, 0).UTC(),
+		Created:           time.Now().UTC(),
+	}
+	require.NoError(s.db.AddVehicle(ctx, car), "add vehicle")
+	require.NoError(s.db.AssignVehicle(ctx, car.ID, login, time.Now().UTC()), "assign vehicle")
+	s.driverTTL = time.Minute
+
 	w := httptest.NewRecorder()
 	// buf := strings.NewReader(`{"driver": "q", "kind": "start"}`)
 	msg := map[string]any{
-		"driver": "q",
+		"driver": login,
 		"kind":   "shared",
 	}
 	var buf bytes.Buffer
@@ -82,9 +109,9 @@ func Test_startHandler(t *testing.T) {
 	r := httptest.NewRequest(http.MethodPost, "/rides", &buf)
 	v := Values{
 		RequestID: uuid.NewString(),
-		User:      User{"q", Admin},
+		User:      User{login, Admin},
 	}
-	ctx := context.WithValue(r.Context(), ctxKey, &v)
+	ctx = context.WithValue(r.Context(), ctxKey, &v)
 	r = r.Clone(ctx)
 	// r.Header.Set()
 	// r.BasicAuth("bond", "007")
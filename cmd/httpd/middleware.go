@@ -9,6 +9,8 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+
+	"github.com/353solutions/unter/trace"
 )
 
 type keyType int
@@ -18,6 +20,8 @@ var ctxKey keyType = 1
 type Values struct {
 	RequestID string
 	User      User
+	Route     string // route template, set by routeMiddleware
+	ClientIP  string
 }
 
 func RequestValues(ctx context.Context) *Values {
@@ -45,8 +49,24 @@ const (
 	Viewer Role = iota + 1
 	Writer
 	Admin
+	Rider
 )
 
+func (r Role) String() string {
+	switch r {
+	case Viewer:
+		return "viewer"
+	case Writer:
+		return "writer"
+	case Admin:
+		return "admin"
+	case Rider:
+		return "rider"
+	}
+
+	return fmt.Sprintf("<Role %d>", r)
+}
+
 type User struct {
 	Login string
 	Role  Role
@@ -77,43 +97,140 @@ func HasRole(u User, roles ...Role) bool {
 	return false
 }
 
-// middleware
-func topMiddleware(log *log.Logger, h http.Handler) http.Handler {
+// requireRole sends an error and returns false if the request user doesn't
+// have one of roles.
+func requireRole(w http.ResponseWriter, r *http.Request, roles ...Role) bool {
+	v := RequestValues(r.Context())
+	if v == nil || v.User.Role == 0 {
+		httpError(w, r, "unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	if !HasRole(v.User, roles...) {
+		httpError(w, r, "forbidden", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+const (
+	requestIDHeader = "X-Request-ID"
+	maxRequestIDLen = 128
+)
+
+// validRequestID reports if id is safe to adopt as request ID (and to log).
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// riderLoginFunc authenticates riders, it returns ErrBadLogin on bad login or
+// password.
+type riderLoginFunc func(ctx context.Context, login, passwd string) (User, error)
+
+// middleware, riderLogin can be nil to allow only staff logins
+func topMiddleware(log *log.Logger, settings func() *Settings, riderLogin riderLoginFunc, h http.Handler) http.Handler {
 	fn := func(w http.ResponseWriter, r *http.Request) {
 		// before
-		rid := uuid.NewString()
+		start := time.Now()
+		st := settings() // same settings for the whole request
+		access := st.Access
+		clientIP := st.Proxies.ClientIP(r)
+		r.Body = http.MaxBytesReader(w, r.Body, st.MaxBodySize)
+		rid := r.Header.Get(requestIDHeader)
+		if !validRequestID(rid) {
+			if rid != "" {
+				log.Printf("WARNING: [SEC] bad %s from %s", requestIDHeader, clientIP)
+			}
+			rid = uuid.NewString()
+		}
+		w.Header().Set(requestIDHeader, rid)
 		v := Values{
 			RequestID: rid,
+			ClientIP:  clientIP,
 		}
 
+		rw := newResponseWriter(w)
+		w = rw
+		if access != nil {
+			defer func() {
+				e := AccessEntry{
+					Time:      start,
+					RequestID: rid,
+					Remote:    clientIP,
+					User:      v.User.Login,
+					Method:    r.Method,
+					Route:     v.Route,
+					Proto:     r.Proto,
+					Status:    rw.Status(),
+					Bytes:     rw.bytes,
+					Duration:  time.Since(start),
+					Referer:   r.Referer(),
+					UserAgent: r.UserAgent(),
+				}
+				if err := access.Log(e); err != nil {
+					log.Printf("WARNING: <%s> can't write access log - %s", rid, err)
+				}
+			}()
+		}
+
+		ctx := trace.Extract(r.Context(), r.Header)
+		ctx, span := trace.Start(ctx, "HTTP "+r.Method, trace.Server)
+		defer func() {
+			if v.Route != "" {
+				span.SetName(fmt.Sprintf("HTTP %s %s", r.Method, v.Route))
+			}
+			span.SetAttr("http.status_code", fmt.Sprint(rw.Status()))
+			span.SetAttr("request_id", rid)
+			span.Finish()
+		}()
+		w.Header().Set(trace.Header, span.Context().Traceparent())
+
 		login, passwd, ok := r.BasicAuth()
 		if ok {
 			user, err := LoginUser(login, passwd)
+			if errors.Is(err, ErrBadLogin) && riderLogin != nil {
+				user, err = riderLogin(r.Context(), login, passwd)
+			}
 			if err != nil {
 				badLogins.Add(1)
-				log.Printf("ERROR: <%s> [SEC] %q bad auth from %s", rid, login, r.RemoteAddr)
+				log.Printf("ERROR: <%s> [SEC] %q bad auth from %s", rid, login, clientIP)
 				http.Error(w, fmt.Sprintf("bad login (%s)", rid), http.StatusForbidden)
 				return
 			}
-			log.Printf("INFO: <%s> [SEC] %q logged in from %s", rid, login, r.RemoteAddr)
+			log.Printf("INFO: <%s> [SEC] %q logged in from %s", rid, login, clientIP)
 			v.User = user
+		} else if user, ok := st.CertRoles.CertUser(r); ok {
+			okLogins.Add(1)
+			log.Printf("INFO: <%s> [SEC] %q (%s) logged in with client certificate from %s", rid, user.Login, user.Role, clientIP)
+			v.User = user
+		} else if subj := certSubject(r); subj != "" {
+			log.Printf("WARNING: <%s> [SEC] unmapped client certificate %q from %s", rid, subj, clientIP)
 		} else {
 			okLogins.Add(1)
-			log.Printf("INFO: <%s> [SEC] no auth from %s", rid, r.RemoteAddr)
+			log.Printf("INFO: <%s> [SEC] no auth from %s", rid, clientIP)
 		}
 
-		ctx := context.WithValue(r.Context(), ctxKey, &v)
+		ctx = context.WithValue(ctx, ctxKey, &v)
 		r = r.Clone(ctx)
 
 		log.Printf("INFO: <%s> %s called", rid, r.URL.Path)
-		start := time.Now()
 
 		h.ServeHTTP(w, r)
 
 		// after
 		duration := time.Since(start)
-		// exercise: Log the return HTTP status
-		log.Printf("INFO: <%s> %s ended in %v", rid, r.URL.Path, duration)
+		log.Printf("INFO: <%s> %s ended in %v (status %d)", rid, r.URL.Path, duration, rw.Status())
 	}
 
 	return http.HandlerFunc(fn)
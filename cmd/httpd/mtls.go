@@ -0,0 +1,101 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+func roleFromString(s string) (Role, error) {
+	for _, r := range []Role{Viewer, Writer, Admin, Rider} {
+		if strings.EqualFold(s, r.String()) {
+			return r, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown role: %q", s)
+}
+
+// CertRoles maps client certificate identities (URI SAN, DNS SAN or subject
+// common name) to roles.
+type CertRoles map[string]Role
+
+func ParseCertRoles(m map[string]string) (CertRoles, error) {
+	cr := make(CertRoles)
+	for id, name := range m {
+		r, err := roleFromString(name)
+		if err != nil {
+			return nil, fmt.Errorf("client %q: %w", id, err)
+		}
+		cr[id] = r
+	}
+	return cr, nil
+}
+
+// certIdentities returns the identities of a certificate, most specific first.
+func certIdentities(cert *x509.Certificate) []string {
+	var ids []string
+	for _, u := range cert.URIs {
+		ids = append(ids, u.String())
+	}
+	ids = append(ids, cert.DNSNames...)
+	if cert.Subject.CommonName != "" {
+		ids = append(ids, cert.Subject.CommonName)
+	}
+	return ids
+}
+
+// CertUser returns the user for a verified client certificate in r.
+func (cr CertRoles) CertUser(r *http.Request) (User, bool) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return User{}, false
+	}
+
+	leaf := r.TLS.VerifiedChains[0][0]
+	for _, id := range certIdentities(leaf) {
+		if role, ok := cr[id]; ok {
+			return User{Login: id, Role: role}, true
+		}
+	}
+
+	return User{}, false
+}
+
+// certSubject returns a printable client certificate subject, "" if there's no
+// verified client certificate.
+func certSubject(r *http.Request) string {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	return r.TLS.VerifiedChains[0][0].Subject.String()
+}
+
+// clientAuthType returns the tls.ClientAuthType for a config value.
+func clientAuthType(mode string) (tls.ClientAuthType, error) {
+	switch mode {
+	case "none":
+		return tls.NoClientCert, nil
+	case "optional":
+		return tls.VerifyClientCertIfGiven, nil
+	case "require":
+		return tls.RequireAndVerifyClientCert, nil
+	}
+
+	return 0, fmt.Errorf("unknown client auth mode: %q", mode)
+}
+
+func loadCertPool(file string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(file) //#nosec G304
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("%s: no certificates found", file)
+	}
+	return pool, nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCertUser(t *testing.T) {
+	roles, err := ParseCertRoles(map[string]string{
+		"spiffe://unter/billing": "viewer",
+		"batch.unter.internal":   "writer",
+	})
+	require.NoError(t, err)
+
+	spiffe, _ := url.Parse("spiffe://unter/billing")
+	certs := map[string]*x509.Certificate{
+		"spiffe://unter/billing": {URIs: []*url.URL{spiffe}, Subject: pkix.Name{CommonName: "billing"}},
+		"batch.unter.internal":   {Subject: pkix.Name{CommonName: "batch.unter.internal"}},
+		"":                       {Subject: pkix.Name{CommonName: "stranger"}},
+	}
+
+	for login, cert := range certs {
+		t.Run(login, func(t *testing.T) {
+			var user User
+			h := topMiddleware(log.New(io.Discard, "", 0), staticSettings(&Settings{CertRoles: roles}), nil,
+				http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					user = RequestValues(r.Context()).User
+				}))
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+			h.ServeHTTP(httptest.NewRecorder(), r)
+			require.Equal(t, login, user.Login)
+		})
+	}
+}
+
+func TestParseCertRolesBad(t *testing.T) {
+	_, err := ParseCertRoles(map[string]string{"batch": "root"})
+	require.Error(t, err)
+}
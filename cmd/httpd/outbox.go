@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/353solutions/unter/cache"
+	"github.com/353solutions/unter/db"
+	"github.com/353solutions/unter/events"
+	"github.com/353solutions/unter/outbox"
+	"github.com/353solutions/unter/webhook"
+)
+
+/* Ride events go through the outbox
+
+handler: ride change + outbox row in one transaction
+relay:   outbox -> sinks (events, webhook, stream, log)
+
+The outbox row ID is the event ID, the dedup ID is "<type>:<ride ID>" so
+retried requests won't create a second event.
+
+Events that failed Outbox.MaxAttempts times are dead, they're logged and kept
+until retried:
+
+POST /admin/outbox/{id}/retry    (Admin) dead -> pending, only failed sinks
+*/
+
+// rideEvent returns an outbox event for a ride change.
+func rideEvent(typ events.Type, rd db.Ride, t time.Time) db.OutboxEvent {
+	e := events.Event{
+		DedupID: fmt.Sprintf("%s:%s", typ, rd.ID),
+		Type:    typ,
+		RideID:  rd.ID,
+		Driver:  rd.Driver,
+		Riders:  rideRiders(rd),
+		Time:    t,
+	}
+	data, _ := json.Marshal(e) // can't fail
+
+	return db.OutboxEvent{
+		DedupID: e.DedupID,
+		Type:    string(typ),
+		Payload: data,
+		Created: time.Now().UTC(),
+	}
+}
+
+// rideRiders returns the ride riders, including riders picked up on legs.
+func rideRiders(rd db.Ride) []string {
+	riders := append([]string(nil), rd.Riders...)
+	for _, l := range rd.Legs {
+		found := false
+		for _, login := range riders {
+			if login == l.Rider {
+				found = true
+				break
+			}
+		}
+		if !found {
+			riders = append(riders, l.Rider)
+		}
+	}
+	return riders
+}
+
+// messageEvent decodes the event in an outbox message.
+func messageEvent(m outbox.Message) (events.Event, error) {
+	var e events.Event
+	if err := json.Unmarshal(m.Payload, &e); err != nil {
+		return events.Event{}, err
+	}
+	e.ID = m.ID
+	e.DedupID = m.DedupID
+	return e, nil
+}
+
+// eventsSink publishes to the events bus (SSE).
+type eventsSink struct {
+	bus *events.Bus
+}
+
+func (eventsSink) Name() string { return "events" }
+
+func (s eventsSink) Send(ctx context.Context, m outbox.Message) error {
+	e, err := messageEvent(m)
+	if err != nil {
+		return err
+	}
+	_, err = s.bus.Publish(ctx, e)
+	return err
+}
+
+// webhookSink enqueues webhook deliveries.
+type webhookSink struct {
+	d *webhook.Dispatcher
+}
+
+func (webhookSink) Name() string { return "webhook" }
+
+func (s webhookSink) Send(ctx context.Context, m outbox.Message) error {
+	e, err := messageEvent(m)
+	if err != nil {
+		return err
+	}
+	return s.d.Enqueue(ctx, e)
+}
+
+const (
+	eventsSinkName  = "events"
+	webhookSinkName = "webhook"
+	streamSinkName  = "stream"
+	logSinkName     = "log"
+)
+
+var sinkNames = []string{eventsSinkName, webhookSinkName, streamSinkName, logSinkName}
+
+// outboxSinks returns the configured sinks.
+func (s *Server) outboxSinks(cfg OutboxConfig, c *cache.Cache, logger *log.Logger) ([]outbox.Sink, error) {
+	var sinks []outbox.Sink
+	for _, name := range cfg.Sinks {
+		switch name {
+		case eventsSinkName:
+			sinks = append(sinks, eventsSink{s.events})
+		case webhookSinkName:
+			sinks = append(sinks, webhookSink{s.webhooks})
+		case streamSinkName:
+			sinks = append(sinks, outbox.StreamSink{Stream: cfg.Stream, MaxLen: cfg.StreamMaxLen, Adder: c})
+		case logSinkName:
+			sinks = append(sinks, outbox.LogSink{Log: logger})
+		default:
+			return nil, fmt.Errorf("unknown outbox sink: %q", name)
+		}
+	}
+	return sinks, nil
+}
+
+func (s *Server) retryOutboxHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireRole(w, r, Admin) {
+		return
+	}
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		httpError(w, r, "bad id", http.StatusBadRequest)
+		return
+	}
+
+	err = s.outbox.Retry(r.Context(), id)
+	switch {
+	case errors.Is(err, outbox.ErrNotFound):
+		httpError(w, r, "no dead event", http.StatusNotFound)
+		return
+	case err != nil:
+		httpError(w, r, "can't retry", http.StatusInternalServerError)
+		return
+	}
+	ctxLogger(s.log, r.Context()).Printf("INFO: outbox event %d retried", id)
+
+	resp := map[string]any{
+		"id":     id,
+		"action": "retry",
+	}
+	if err := sendJSON(w, resp); err != nil {
+		httpError(w, r, "can't marshal to JSON", http.StatusInternalServerError)
+	}
+}
+
+// outboxStore is an outbox.Store on top of the database.
+type outboxStore struct {
+	db *db.DB
+}
+
+func (st outboxStore) Claim(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]outbox.Message, error) {
+	es, err := st.db.ClaimOutbox(ctx, now, lease, limit)
+	if err != nil {
+		return nil, err
+	}
+	msgs := make([]outbox.Message, len(es))
+	for i, e := range es {
+		msgs[i] = outbox.Message(e)
+	}
+	return msgs, nil
+}
+
+func (st outboxStore) MarkPublished(ctx context.Context, id int64, t time.Time) error {
+	return st.db.MarkOutboxPublished(ctx, id, t)
+}
+
+func (st outboxStore) MarkFailed(ctx context.Context, id int64, sent []string, reason string, next time.Time) error {
+	return st.db.MarkOutboxFailed(ctx, id, sent, reason, next)
+}
+
+func (st outboxStore) MarkDead(ctx context.Context, id int64, sent []string, reason string, t time.Time) error {
+	return st.db.MarkOutboxDead(ctx, id, sent, reason, t)
+}
+
+func (st outboxStore) Revive(ctx context.Context, id int64, now time.Time) error {
+	err := st.db.ReviveOutbox(ctx, id, now)
+	if errors.Is(err, db.ErrNotFound) {
+		return outbox.ErrNotFound
+	}
+	return err
+}
+
+func (st outboxStore) Purge(ctx context.Context, before time.Time) (int64, error) {
+	return st.db.PurgeOutbox(ctx, before)
+}
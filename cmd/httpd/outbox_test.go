@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/353solutions/unter/db"
+	"github.com/353solutions/unter/events"
+	"github.com/353solutions/unter/outbox"
+	"github.com/353solutions/unter/webhook"
+)
+
+func TestRideEvent(t *testing.T) {
+	require := require.New(t)
+
+	rd := db.Ride{ID: "r1", Driver: "Bond", Riders: []string{"m"}, Legs: []db.Leg{{Rider: "m"}, {Rider: "q"}}}
+	end := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	oe := rideEvent(events.RideEnded, rd, end)
+	require.Equal("ride.ended:r1", oe.DedupID)
+
+	e, err := messageEvent(outbox.Message{ID: 42, DedupID: oe.DedupID, Payload: oe.Payload})
+	require.NoError(err)
+	require.Equal(int64(42), e.ID)
+	require.Equal(events.RideEnded, e.Type)
+	require.Equal("Bond", e.Driver)
+	require.Equal([]string{"m", "q"}, e.Riders)
+	require.True(end.Equal(e.Time))
+}
+
+func TestWebhookSinkDedup(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	store := webhook.NewMemStore()
+	err := store.AddSubscription(ctx, webhook.Subscription{ID: "wh1", URL: "http://localhost", Secret: "s"})
+	require.NoError(err)
+	sink := webhookSink{webhook.NewDispatcher(store, time.Second)}
+
+	m := outbox.Message{ID: 1, DedupID: "ride.started:r1", Payload: rideEvent(events.RideStarted, db.Ride{ID: "r1"}, time.Now()).Payload}
+	require.NoError(sink.Send(ctx, m))
+	require.NoError(sink.Send(ctx, m)) // relay retry
+
+	ds, err := store.Deliveries(ctx, "wh1", "", 10)
+	require.NoError(err)
+	require.Len(ds, 1)
+}
+
+func TestOutboxConfig(t *testing.T) {
+	cfg := OutboxConfig{Sinks: []string{"events", "kafka"}, PollInterval: time.Second, MaxAttempts: 3}
+	require.Error(t, cfg.Validate())
+	cfg.Sinks = sinkNames
+	require.NoError(t, cfg.Validate())
+	cfg.MaxAttempts = 0
+	require.Error(t, cfg.Validate())
+}
+
+func TestRetryOutbox(t *testing.T) {
+	s := Server{log: log.New(io.Discard, "", 0)}
+
+	w := httptest.NewRecorder()
+	s.retryOutboxHandler(w, userRequest(http.MethodPost, "/admin/outbox/1/retry", "", User{"Bond", Writer}, map[string]string{"id": "1"}))
+	require.Equal(t, http.StatusForbidden, w.Code)
+
+	w = httptest.NewRecorder()
+	s.retryOutboxHandler(w, userRequest(http.MethodPost, "/admin/outbox/x/retry", "", User{"M", Admin}, map[string]string{"id": "x"}))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Password hashes are "pbkdf2-sha256$<iterations>$<salt>$<key>" with base64
+// salt and key (PBKDF2 from RFC 8018).
+const (
+	passwordScheme     = "pbkdf2-sha256"
+	passwordIterations = 100_000
+	passwordSaltLen    = 16
+	minPasswordLen     = 8
+)
+
+func hashPassword(passwd string) (string, error) {
+	salt := make([]byte, passwordSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := pbkdf2([]byte(passwd), salt, passwordIterations)
+	enc := base64.RawStdEncoding
+	hash := fmt.Sprintf("%s$%d$%s$%s", passwordScheme, passwordIterations, enc.EncodeToString(salt), enc.EncodeToString(key))
+	return hash, nil
+}
+
+// checkPassword reports if passwd matches hash.
+func checkPassword(hash, passwd string) bool {
+	fields := strings.Split(hash, "$")
+	if len(fields) != 4 || fields[0] != passwordScheme {
+		return false
+	}
+	iter, err := strconv.Atoi(fields[1])
+	if err != nil || iter <= 0 {
+		return false
+	}
+	enc := base64.RawStdEncoding
+	salt, err := enc.DecodeString(fields[2])
+	if err != nil {
+		return false
+	}
+	key, err := enc.DecodeString(fields[3])
+	if err != nil {
+		return false
+	}
+
+	return hmac.Equal(key, pbkdf2([]byte(passwd), salt, iter))
+}
+
+// pbkdf2 returns a single block (32 bytes) PBKDF2-HMAC-SHA256 key.
+func pbkdf2(passwd, salt []byte, iter int) []byte {
+	mac := hmac.New(sha256.New, passwd)
+	mac.Write(salt)
+	mac.Write(binary.BigEndian.AppendUint32(nil, 1)) // block index
+	u := mac.Sum(nil)
+
+	key := append([]byte(nil), u...)
+	for i := 1; i < iter; i++ {
+		mac.Reset()
+		mac.Write(u)
+		u = mac.Sum(u[:0])
+		for j := range key {
+			key[j] ^= u[j]
+		}
+	}
+	return key
+}
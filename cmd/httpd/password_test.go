@@ -0,0 +1,29 @@
+package main
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPBKDF2(t *testing.T) {
+	// RFC 7914 section 11, first 32 bytes
+	key := pbkdf2([]byte("passwd"), []byte("salt"), 1)
+	require.Equal(t, "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc", hex.EncodeToString(key))
+}
+
+func TestPassword(t *testing.T) {
+	require := require.New(t)
+
+	hash, err := hashPassword("m0neypenny")
+	require.NoError(err)
+	require.True(checkPassword(hash, "m0neypenny"))
+	require.False(checkPassword(hash, "m0neypennY"))
+	require.False(checkPassword("", ""))
+	require.False(checkPassword("md5$1$a$b", "m0neypenny"))
+
+	other, err := hashPassword("m0neypenny")
+	require.NoError(err)
+	require.NotEqual(hash, other, "salt")
+}
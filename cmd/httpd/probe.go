@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Check is a dependency check used by readiness probes.
+// A failing critical check makes the service not ready, a failing
+// non-critical (degradable) check only reports the service as degraded.
+type Check struct {
+	Name     string
+	Critical bool
+	Timeout  time.Duration
+	Fn       func(ctx context.Context) error
+}
+
+type CheckResult struct {
+	OK       bool          `json:"ok"`
+	Critical bool          `json:"critical"`
+	Error    string        `json:"error,omitempty"`
+	Latency  time.Duration `json:"latency_ns"`
+}
+
+type Readiness struct {
+	Status  string                 `json:"status"` // ready, degraded, not ready
+	Checked time.Time              `json:"checked"`
+	Checks  map[string]CheckResult `json:"checks"`
+}
+
+const (
+	statusReady    = "ready"
+	statusDegraded = "degraded"
+	statusNotReady = "not ready"
+	statusDraining = "shutting down"
+)
+
+func (r Readiness) Ready() bool {
+	return r.Status != statusNotReady && r.Status != statusDraining
+}
+
+// Prober runs checks, caching results for ttl so frequent probes won't
+// overload dependencies.
+type Prober struct {
+	checks   []Check
+	ttl      time.Duration
+	draining atomic.Bool
+
+	mu   sync.Mutex
+	last Readiness
+}
+
+func NewProber(ttl time.Duration, checks ...Check) *Prober {
+	return &Prober{
+		checks: checks,
+		ttl:    ttl,
+	}
+}
+
+// SetDraining makes readiness fail, used during shutdown.
+func (p *Prober) SetDraining() {
+	p.draining.Store(true)
+}
+
+// Check returns the current readiness, running the checks if the cached
+// result is older than the TTL. Concurrent callers wait for a single run.
+// Checks don't use the caller context, a cancelled request must not cache a
+// failure for every other caller. Each check is limited by its Timeout.
+func (p *Prober) Check() Readiness {
+	if p.draining.Load() {
+		return Readiness{Status: statusDraining, Checked: time.Now().UTC()}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.last.Checked.IsZero() && time.Since(p.last.Checked) < p.ttl {
+		return p.last
+	}
+
+	results := make([]CheckResult, len(p.checks))
+	var wg sync.WaitGroup
+	for i, c := range p.checks {
+		wg.Add(1)
+		go func(i int, c Check) {
+			defer wg.Done()
+			results[i] = runCheck(context.Background(), c)
+		}(i, c)
+	}
+	wg.Wait()
+
+	rd := Readiness{
+		Status:  statusReady,
+		Checked: time.Now().UTC(),
+		Checks:  make(map[string]CheckResult),
+	}
+	for i, c := range p.checks {
+		res := results[i]
+		rd.Checks[c.Name] = res
+		switch {
+		case res.OK:
+		case c.Critical:
+			rd.Status = statusNotReady
+		case rd.Status == statusReady:
+			rd.Status = statusDegraded
+		}
+	}
+
+	p.last = rd
+	return rd
+}
+
+func runCheck(ctx context.Context, c Check) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := c.Fn(ctx)
+	res := CheckResult{
+		OK:       err == nil,
+		Critical: c.Critical,
+		Latency:  time.Since(start),
+	}
+	if err != nil {
+		res.Error = err.Error()
+	}
+	return res
+}
+
+// livezHandler reports the process is up, it doesn't check dependencies.
+func (s *Server) livezHandler(w http.ResponseWriter, r *http.Request) {
+	resp := map[string]any{
+		"status": "ok",
+	}
+	if err := sendJSON(w, resp); err != nil {
+		s.log.Printf("WARNING: can't send - %s", err)
+	}
+}
+
+func (s *Server) readyzHandler(w http.ResponseWriter, r *http.Request) {
+	rd := s.probe.Check()
+	if !rd.Ready() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := sendJSON(w, rd); err != nil {
+		s.log.Printf("WARNING: can't send - %s", err)
+	}
+}
+
+// defaultProber checks the database (critical), the cache (degradable) and
+// extra checks.
+func (s *Server) defaultProber(cfg ProbeConfig, extra ...Check) *Prober {
+	checks := []Check{
+		{
+			Name:     "db",
+			Critical: true,
+			Timeout:  cfg.DBTimeout,
+			Fn:       s.db.Health,
+		},
+		{
+			Name:     "rides",
+			Critical: true,
+			Timeout:  cfg.DBTimeout,
+			Fn:       s.db.CheckRides,
+		},
+		{
+			Name:     "cache",
+			Critical: false,
+			Timeout:  cfg.CacheTimeout,
+			Fn:       s.cache.Health,
+		},
+	}
+
+	return NewProber(cfg.TTL, append(checks, extra...)...)
+}
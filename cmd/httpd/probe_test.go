@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func okCheck(context.Context) error   { return nil }
+func failCheck(context.Context) error { return fmt.Errorf("oops") }
+
+var readyCases = []struct {
+	name     string
+	db       func(context.Context) error
+	cache    func(context.Context) error
+	status   string
+	httpCode int
+}{
+	{"ok", okCheck, okCheck, statusReady, http.StatusOK},
+	{"cache down", okCheck, failCheck, statusDegraded, http.StatusOK},
+	{"db down", failCheck, okCheck, statusNotReady, http.StatusServiceUnavailable},
+}
+
+func Test_readyzHandler(t *testing.T) {
+	for _, tc := range readyCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require := require.New(t)
+			s := Server{
+				log: log.New(io.Discard, "", 0),
+				probe: NewProber(
+					time.Second,
+					Check{"db", true, time.Second, tc.db},
+					Check{"cache", false, time.Second, tc.cache},
+				),
+			}
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/readyz", nil)
+			s.readyzHandler(w, r)
+
+			require.Equal(tc.httpCode, w.Code)
+			rd := s.probe.Check()
+			require.Equal(tc.status, rd.Status)
+		})
+	}
+}
+
+func TestProberCache(t *testing.T) {
+	calls := 0
+	check := func(context.Context) error {
+		calls++
+		return nil
+	}
+	p := NewProber(time.Minute, Check{"db", true, time.Second, check})
+	for i := 0; i < 10; i++ {
+		p.Check()
+	}
+	require.Equal(t, 1, calls)
+}
+
+func TestProberCanceled(t *testing.T) {
+	s := Server{
+		log:   log.New(io.Discard, "", 0),
+		probe: NewProber(time.Minute, Check{"db", true, time.Second, func(ctx context.Context) error { return ctx.Err() }}),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/readyz", nil).WithContext(ctx)
+	s.readyzHandler(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.True(t, s.probe.Check().Ready(), "cached")
+}
+
+func TestProberTimeout(t *testing.T) {
+	slow := func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	p := NewProber(0, Check{"db", true, 10 * time.Millisecond, slow})
+	rd := p.Check()
+	require.False(t, rd.Ready())
+}
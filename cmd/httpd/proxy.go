@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// TrustedProxies decides the client IP of a request.
+// X-Forwarded-For is used only when the request comes from a trusted proxy,
+// otherwise anyone could spoof their address.
+type TrustedProxies []*net.IPNet
+
+// ParseTrustedProxies parses a list of IPs or CIDRs.
+func ParseTrustedProxies(addrs []string) (TrustedProxies, error) {
+	var tp TrustedProxies
+	for _, a := range addrs {
+		a = strings.TrimSpace(a)
+		if a == "" {
+			continue
+		}
+
+		if !strings.Contains(a, "/") {
+			ip := net.ParseIP(a)
+			if ip == nil {
+				return nil, fmt.Errorf("bad proxy IP: %q", a)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			tp = append(tp, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, n, err := net.ParseCIDR(a)
+		if err != nil {
+			return nil, fmt.Errorf("bad proxy CIDR: %q", a)
+		}
+		tp = append(tp, n)
+	}
+
+	return tp, nil
+}
+
+func (tp TrustedProxies) trusted(ip net.IP) bool {
+	for _, n := range tp {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the client IP of r. It walks X-Forwarded-For from the
+// right, skipping trusted proxies, and returns the first untrusted address.
+func (tp TrustedProxies) ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || !tp.trusted(ip) {
+		return host
+	}
+
+	var hops []string
+	for _, h := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(h, ",")...)
+	}
+
+	client := host
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		ip := net.ParseIP(hop)
+		if ip == nil {
+			break
+		}
+		client = hop
+		if !tp.trusted(ip) {
+			break
+		}
+	}
+
+	return client
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var clientIPCases = []struct {
+	name   string
+	remote string
+	xff    string
+	client string
+}{
+	{"direct", "1.2.3.4:1234", "", "1.2.3.4"},
+	{"untrusted spoof", "1.2.3.4:1234", "6.6.6.6", "1.2.3.4"},
+	{"trusted", "10.0.0.1:1234", "5.6.7.8", "5.6.7.8"},
+	{"chain", "10.0.0.1:1234", "6.6.6.6, 5.6.7.8, 10.0.0.2", "5.6.7.8"},
+	{"all trusted", "10.0.0.1:1234", "10.0.0.3", "10.0.0.3"},
+	{"garbage", "10.0.0.1:1234", "bogus", "10.0.0.1"},
+}
+
+func TestClientIP(t *testing.T) {
+	proxies, err := ParseTrustedProxies([]string{"10.0.0.0/8", "192.168.1.1"})
+	require.NoError(t, err)
+
+	for _, tc := range clientIPCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tc.remote
+			if tc.xff != "" {
+				r.Header.Set("X-Forwarded-For", tc.xff)
+			}
+			require.Equal(t, tc.client, proxies.ClientIP(r))
+		})
+	}
+}
+
+func TestParseTrustedProxiesBad(t *testing.T) {
+	_, err := ParseTrustedProxies([]string{"10.0.0.0/33"})
+	require.Error(t, err)
+}
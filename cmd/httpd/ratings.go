@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/353solutions/unter"
+	"github.com/353solutions/unter/db"
+)
+
+/* Ratings
+
+POST /rides/{id}/rating     (rider or driver) {"stars": 5, "tags": ["clean"], "comment": "..."}
+GET  /drivers/{login}/stats (Admin or the driver)
+GET  /admin/drivers/review  (Admin) drivers flagged for review
+
+Riders rate the driver and the driver rates the riders (on shared rides the
+driver sets "rider"). A ride is rated once per rater and ratee, up to
+Ratings.Window after it ends.
+
+The driver rating is a weighted average of the last Ratings.Last rider
+ratings (see unter.RollingScore). Drivers rated below Ratings.Threshold are
+flagged for review, the flag clears when the rating goes back up.
+*/
+
+var (
+	errNotInRide = errors.New("not in ride")
+	errNoRider   = errors.New("missing rider")
+)
+
+// ratee returns who login rates in rd, byRider is true if login is a rider.
+// The driver must pass rider on rides with several riders.
+func ratee(rd db.Ride, login, rider string) (string, bool, error) {
+	for _, r := range rd.Riders {
+		if r == login {
+			return rd.Driver, true, nil
+		}
+	}
+
+	if login != rd.Driver {
+		return "", false, errNotInRide
+	}
+
+	if rider == "" {
+		if len(rd.Riders) != 1 {
+			return "", false, errNoRider
+		}
+		return rd.Riders[0], false, nil
+	}
+	for _, r := range rd.Riders {
+		if r == rider {
+			return r, false, nil
+		}
+	}
+	return "", false, fmt.Errorf("%q: %w", rider, errNotInRide)
+}
+
+func (s *Server) rateHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireRole(w, r, Rider, Writer) {
+		return
+	}
+
+	var req struct {
+		Stars   int
+		Tags    []string
+		Comment string
+		Rider   string // driver rating a rider
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, "bad json", http.StatusBadRequest)
+		return
+	}
+
+	rd, err := s.db.Get(r.Context(), mux.Vars(r)["id"])
+	switch {
+	case errors.Is(err, db.ErrNotFound):
+		httpError(w, r, "not found", http.StatusNotFound)
+		return
+	case err != nil:
+		httpError(w, r, "can't get", http.StatusInternalServerError)
+		return
+	}
+
+	login := RequestValues(r.Context()).User.Login
+	to, byRider, err := ratee(rd, login, req.Rider)
+	switch {
+	case errors.Is(err, errNoRider):
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		httpError(w, r, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	now := time.Now().UTC()
+	ur, err := rideFromDB(rd)
+	if err != nil {
+		httpError(w, r, "bad ride", http.StatusInternalServerError)
+		return
+	}
+	if rd.Cancelled {
+		err = fmt.Errorf("ride cancelled")
+	} else {
+		err = ur.CanRate(now, s.ratings.Window)
+	}
+	if err != nil {
+		httpError(w, r, err.Error(), http.StatusConflict)
+		return
+	}
+
+	rt := unter.Rating{
+		RideID:  rd.ID,
+		Rater:   login,
+		Ratee:   to,
+		ByRider: byRider,
+		Stars:   req.Stars,
+		Tags:    req.Tags,
+		Comment: strings.TrimSpace(req.Comment),
+		Time:    now,
+	}
+	if err := rt.Validate(); err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	dr := db.Rating{
+		RideID:  rt.RideID,
+		Rater:   rt.Rater,
+		Ratee:   rt.Ratee,
+		ByRider: rt.ByRider,
+		Stars:   rt.Stars,
+		Tags:    rt.Tags,
+		Comment: rt.Comment,
+		Created: rt.Time,
+	}
+	err = s.db.AddRating(r.Context(), dr)
+	switch {
+	case errors.Is(err, db.ErrExists):
+		httpError(w, r, "already rated", http.StatusConflict)
+		return
+	case err != nil:
+		httpError(w, r, "can't insert", http.StatusInternalServerError)
+		return
+	}
+	ctxLogger(s.log, r.Context()).Printf("INFO: ride %s: %s rated %s %d stars", rt.RideID, rt.Rater, rt.Ratee, rt.Stars)
+
+	if byRider {
+		// The rating is in, review is updated on the next rating if this fails
+		if _, err := s.reviewDriver(r.Context(), to, now); err != nil {
+			ctxLogger(s.log, r.Context()).Printf("ERROR: %s: can't update review - %s", to, err)
+		}
+	}
+
+	resp := map[string]any{
+		"ride_id": rt.RideID,
+		"ratee":   rt.Ratee,
+		"stars":   rt.Stars,
+	}
+	w.WriteHeader(http.StatusCreated)
+	if err := sendJSON(w, resp); err != nil {
+		s.log.Printf("WARNING: can't send - %s", err)
+	}
+}
+
+// driverScore returns the rolling rating of a driver.
+func (s *Server) driverScore(ctx context.Context, login string) (unter.Score, error) {
+	stars, err := s.db.DriverStars(ctx, login, s.ratings.Last)
+	if err != nil {
+		return unter.Score{}, err
+	}
+	return unter.RollingScore(stars, s.ratings.Last), nil
+}
+
+// reviewDriver flags or clears login for review by the driver score.
+func (s *Server) reviewDriver(ctx context.Context, login string, now time.Time) (unter.Score, error) {
+	score, err := s.driverScore(ctx, login)
+	if err != nil {
+		return unter.Score{}, err
+	}
+
+	review := score.NeedsReview(s.ratings.Threshold, s.ratings.MinRatings)
+	if err := s.db.SetDriverReview(ctx, login, review, now); err != nil {
+		return unter.Score{}, err
+	}
+	if review {
+		ctxLogger(s.log, ctx).Printf("WARNING: driver %s flagged for review: rating %.2f (%d ratings)", login, score.Average, score.Count)
+	}
+	return score, nil
+}
+
+type DriverStatsResponse struct {
+	Login       string     `json:"login"`
+	Rides       int        `json:"rides"`
+	Rating      float64    `json:"rating"` // 0 if there are no ratings
+	Ratings     int        `json:"ratings"`
+	Review      bool       `json:"review"`
+	ReviewSince *time.Time `json:"review_since,omitempty"`
+}
+
+func (s *Server) driverStatsHandler(w http.ResponseWriter, r *http.Request) {
+	login := mux.Vars(r)["login"]
+	v := RequestValues(r.Context())
+	if v == nil || (v.User.Role != Admin && v.User.Login != login) {
+		httpError(w, r, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	d, err := s.db.Driver(r.Context(), login)
+	switch {
+	case errors.Is(err, db.ErrNotFound):
+		httpError(w, r, "not found", http.StatusNotFound)
+		return
+	case err != nil:
+		httpError(w, r, "can't get", http.StatusInternalServerError)
+		return
+	}
+
+	rides, err := s.db.DriverRides(r.Context(), login)
+	if err != nil {
+		httpError(w, r, "can't get rides", http.StatusInternalServerError)
+		return
+	}
+	score, err := s.driverScore(r.Context(), login)
+	if err != nil {
+		httpError(w, r, "can't get ratings", http.StatusInternalServerError)
+		return
+	}
+
+	resp := DriverStatsResponse{
+		Login:   login,
+		Rides:   rides,
+		Rating:  math.Round(score.Average*100) / 100,
+		Ratings: score.Count,
+		Review:  !d.ReviewSince.IsZero(),
+	}
+	if resp.Review {
+		resp.ReviewSince = &d.ReviewSince
+	}
+	if err := sendJSON(w, resp); err != nil {
+		httpError(w, r, "can't marshal to JSON", http.StatusInternalServerError)
+	}
+}
+
+func (s *Server) reviewDriversHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireRole(w, r, Admin) {
+		return
+	}
+
+	drivers, err := s.db.DriversForReview(r.Context())
+	if err != nil {
+		httpError(w, r, "can't list", http.StatusInternalServerError)
+		return
+	}
+
+	type review struct {
+		Login string    `json:"login"`
+		Name  string    `json:"name"`
+		Since time.Time `json:"since"`
+	}
+	resp := make([]review, len(drivers))
+	for i, d := range drivers {
+		resp[i] = review{d.Login, d.Name, d.ReviewSince}
+	}
+	if err := sendJSON(w, resp); err != nil {
+		httpError(w, r, "can't marshal to JSON", http.StatusInternalServerError)
+	}
+}
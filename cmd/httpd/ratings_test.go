@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/353solutions/unter/db"
+)
+
+var rateeCases = []struct {
+	name    string
+	riders  []string
+	login   string
+	rider   string
+	ratee   string
+	byRider bool
+	ok      bool
+}{
+	{"rider", []string{"Moneypenny"}, "Moneypenny", "", "Bond", true, true},
+	{"driver", []string{"Moneypenny"}, "Bond", "", "Moneypenny", false, true},
+	{"driver shared", []string{"Moneypenny", "Q"}, "Bond", "Q", "Q", false, true},
+	{"driver shared no rider", []string{"Moneypenny", "Q"}, "Bond", "", "", false, false},
+	{"driver other rider", []string{"Moneypenny"}, "Bond", "Q", "", false, false},
+	{"stranger", []string{"Moneypenny"}, "Q", "", "", false, false},
+}
+
+func TestRatee(t *testing.T) {
+	for _, tc := range rateeCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rd := db.Ride{ID: "r1", Driver: "Bond", Riders: tc.riders}
+			to, byRider, err := ratee(rd, tc.login, tc.rider)
+			if !tc.ok {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.ratee, to)
+			require.Equal(t, tc.byRider, byRider)
+		})
+	}
+}
+
+func TestRatingRoles(t *testing.T) {
+	s := Server{log: log.New(io.Discard, "", 0)}
+
+	w := httptest.NewRecorder()
+	s.rateHandler(w, userRequest(http.MethodPost, "/rides/r1/rating", `{"stars": 5}`, User{"M", Admin}, map[string]string{"id": "r1"}))
+	require.Equal(t, http.StatusForbidden, w.Code)
+
+	w = httptest.NewRecorder()
+	s.driverStatsHandler(w, userRequest(http.MethodGet, "/drivers/Bond/stats", "", User{"Q", Writer}, map[string]string{"login": "Bond"}))
+	require.Equal(t, http.StatusForbidden, w.Code)
+
+	w = httptest.NewRecorder()
+	s.reviewDriversHandler(w, userRequest(http.MethodGet, "/admin/drivers/review", "", User{"Bond", Writer}, nil))
+	require.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestRateSharedRiders(t *testing.T) {
+	require := require.New(t)
+	s := setupServer(t)
+	s.ratings.Window = time.Hour
+
+	ctx := context.Background()
+	now := time.Now().UTC()
+	suffix := uuid.NewString()[:8]
+	riders := []string{"m-" + suffix, "q-" + suffix}
+	for _, login := range riders {
+		require.NoError(s.db.AddRider(ctx, db.Rider{Login: login, Name: login, Created: now}, ""))
+	}
+	rd := db.Ride{
+		ID:       uuid.NewString(),
+		Driver:   "Bond",
+		Kind:     "shared",
+		Start:    now.Add(-10 * time.Minute),
+		End:      now.Add(-time.Minute),
+		Distance: 3,
+		Riders:   riders,
+	}
+	require.NoError(s.db.Add(ctx, rd))
+
+	rate := func(rider string) int {
+		w := httptest.NewRecorder()
+		body := fmt.Sprintf(`{"stars": 5, "rider": %q}`, rider)
+		s.rateHandler(w, userRequest(http.MethodPost, "/rides/"+rd.ID+"/rating", body, User{"Bond", Writer}, map[string]string{"id": rd.ID}))
+		return w.Code
+	}
+	require.Equal(http.StatusCreated, rate(riders[0]))
+	require.Equal(http.StatusCreated, rate(riders[1]))
+	require.Equal(http.StatusConflict, rate(riders[0]))
+}
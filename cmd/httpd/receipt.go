@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/353solutions/unter"
+	"github.com/353solutions/unter/db"
+	"github.com/353solutions/unter/ledger"
+)
+
+/* Receipts
+
+GET /info/{id}    (the ride driver, riders or Admin) HTML receipt
+
+Ended rides show the stored fare (see fares.go), rides ended before fares were
+stored are priced without extras. Ongoing and cancelled rides have no fare.
+
+The driver and Admin see all riders and the whole trip. On rides with several
+riders, a rider sees only themselves and their part: their leg fare (or share
+of the fee) and share of the extras, split like the ledger (see rideEntry).
+*/
+
+// canView returns true if u can see rd.
+func canView(u User, rd db.Ride) bool {
+	if u.Role == Admin || u.Login == rd.Driver {
+		return true
+	}
+	for _, login := range rd.Riders {
+		if u.Login == login {
+			return true
+		}
+	}
+	return false
+}
+
+// ReceiptItem is a receipt line.
+type ReceiptItem struct {
+	Label  string
+	Amount string
+}
+
+// Receipt is the info page data, values are formatted for display.
+type Receipt struct {
+	ID       string
+	Status   string // ongoing, ended or cancelled
+	Driver   string
+	Riders   []string
+	Kind     string
+	Start    string
+	End      string // "" if ongoing
+	Duration string // so far for ongoing rides
+	Distance string
+	Items    []ReceiptItem
+	Total    string // "" if there's no fare
+}
+
+const receiptTimeFmt = "2006-01-02 15:04 MST"
+
+// newReceipt returns the receipt of rd as u sees it.
+func newReceipt(rd db.Ride, u User, now time.Time) (Receipt, error) {
+	rider := -1 // index in riders if u is one of several riders
+	riders, _ := rideShares(rd, FareResponse{})
+	if u.Role != Admin && u.Login != rd.Driver && len(riders) > 1 {
+		for i, login := range riders {
+			if login == u.Login {
+				rider = i
+			}
+		}
+	}
+
+	rc := Receipt{
+		ID:       rd.ID,
+		Status:   "ongoing",
+		Driver:   rd.Driver,
+		Riders:   rd.Riders,
+		Kind:     rd.Kind,
+		Start:    rd.Start.Format(receiptTimeFmt),
+		Duration: formatDuration(now.Sub(rd.Start)),
+	}
+	if rider != -1 {
+		rc.Riders = []string{u.Login}
+	}
+	if rd.End.IsZero() {
+		return rc, nil
+	}
+
+	rc.End = rd.End.Format(receiptTimeFmt)
+	rc.Duration = formatDuration(rd.End.Sub(rd.Start))
+	if rd.Cancelled {
+		rc.Status = "cancelled"
+		return rc, nil
+	}
+	rc.Status = "ended"
+	rc.Distance = fmt.Sprintf("%.2f mi", rd.Distance)
+
+	fare, err := rideFare(rd)
+	if err != nil {
+		return Receipt{}, err
+	}
+	if fare == nil {
+		r, err := rideFromDB(rd)
+		if err != nil {
+			return Receipt{}, err
+		}
+		f := fareResponse(unter.RideFare(r, unter.Extras{}))
+		fare = &f
+	}
+	if rider != -1 {
+		rc.Items, rc.Total = riderItems(rd, *fare, rider)
+		return rc, nil
+	}
+	rc.Items = receiptItems(*fare)
+	rc.Total = formatCents(fare.Total)
+	return rc, nil
+}
+
+// riderItems returns the receipt items and total of rider i (see rideShares)
+// on a ride with several riders.
+func riderItems(rd db.Ride, f FareResponse, i int) ([]ReceiptItem, string) {
+	riders, shares := rideShares(rd, f)
+	total := ledger.Split(f.Total, shares, len(riders))[i]
+
+	var item ReceiptItem
+	fee := f.Fee - f.SharedDiscount - f.QuoteDiscount
+	switch {
+	case len(rd.Legs) > 0:
+		fee = shares[i]
+		item = ReceiptItem{fmt.Sprintf("Your leg (%.2f mi)", rd.Legs[i].Distance), formatCents(fee)}
+	default:
+		fee = ledger.Split(fee, nil, len(riders))[i]
+		item = ReceiptItem{fmt.Sprintf("Ride fee (1/%d)", len(riders)), formatCents(fee)}
+	}
+
+	items := []ReceiptItem{item}
+	if extras := total - fee; extras != 0 {
+		items = append(items, ReceiptItem{"Your share of surcharges, tax and tip", formatCents(extras)})
+	}
+	return items, formatCents(total)
+}
+
+func receiptItems(f FareResponse) []ReceiptItem {
+	fee := fmt.Sprintf("Ride fee (%s)", f.Winner)
+	if f.Winner == unter.MinimumFee.String() {
+		fee = "Ride fee (minimum)"
+	}
+	items := []ReceiptItem{{fee, formatCents(f.Fee)}}
+
+	if f.SharedDiscount != 0 {
+		items = append(items, ReceiptItem{"Shared ride discount", formatCents(-f.SharedDiscount)})
+	}
+	if f.QuoteDiscount != 0 {
+		items = append(items, ReceiptItem{"Estimate guarantee", formatCents(-f.QuoteDiscount)})
+	}
+	for _, s := range f.Surcharges {
+		items = append(items, ReceiptItem{"Surcharge: " + s.Name, formatCents(s.Amount)})
+	}
+	if f.Tax != 0 {
+		items = append(items, ReceiptItem{fmt.Sprintf("Tax (%g%%)", f.TaxRate*100), formatCents(f.Tax)})
+	}
+	if f.Tip != 0 {
+		items = append(items, ReceiptItem{"Tip", formatCents(f.Tip)})
+	}
+	return items
+}
+
+// formatCents returns ¢ as dollars, e.g. 1234 -> "$12.34".
+func formatCents(c int) string {
+	sign := ""
+	if c < 0 {
+		sign, c = "-", -c
+	}
+	return fmt.Sprintf("%s$%d.%02d", sign, c/100, c%100)
+}
+
+// formatDuration returns d rounded to minutes, e.g. "1h 05m", seconds below a
+// minute.
+func formatDuration(d time.Duration) string {
+	if d < time.Minute {
+		return fmt.Sprintf("%ds", int(d.Round(time.Second)/time.Second))
+	}
+
+	d = d.Round(time.Minute)
+	h, m := int(d/time.Hour), int(d%time.Hour/time.Minute)
+	if h == 0 {
+		return fmt.Sprintf("%dm", m)
+	}
+	return fmt.Sprintf("%dh %02dm", h, m)
+}
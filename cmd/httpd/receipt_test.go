@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/353solutions/unter/db"
+)
+
+var formatCentsCases = []struct {
+	cents    int
+	expected string
+}{
+	{0, "$0.00"},
+	{7, "$0.07"},
+	{1234, "$12.34"},
+	{-75, "-$0.75"},
+}
+
+func TestFormatCents(t *testing.T) {
+	for _, tc := range formatCentsCases {
+		t.Run(fmt.Sprint(tc.cents), func(t *testing.T) {
+			require.Equal(t, tc.expected, formatCents(tc.cents))
+		})
+	}
+}
+
+var formatDurationCases = []struct {
+	d        time.Duration
+	expected string
+}{
+	{20 * time.Second, "20s"},
+	{12*time.Minute + 40*time.Second, "13m"},
+	{time.Hour + 5*time.Minute, "1h 05m"},
+}
+
+func TestFormatDuration(t *testing.T) {
+	for _, tc := range formatDurationCases {
+		t.Run(tc.expected, func(t *testing.T) {
+			require.Equal(t, tc.expected, formatDuration(tc.d))
+		})
+	}
+}
+
+var canViewCases = []struct {
+	user User
+	ok   bool
+}{
+	{User{"Bond", Writer}, true},
+	{User{"Moneypenny", Rider}, true},
+	{User{"M", Admin}, true},
+	{User{"Q", Writer}, false},
+	{User{"Felix", Rider}, false},
+}
+
+func TestCanView(t *testing.T) {
+	rd := db.Ride{ID: "r1", Driver: "Bond", Riders: []string{"Moneypenny"}}
+	for _, tc := range canViewCases {
+		t.Run(tc.user.Login, func(t *testing.T) {
+			require.Equal(t, tc.ok, canView(tc.user, rd))
+		})
+	}
+}
+
+func renderReceipt(t *testing.T, rd db.Ride, u User, now time.Time) string {
+	tmpl, err := template.New("info").Parse(infoHTML)
+	require.NoError(t, err)
+
+	rc, err := newReceipt(rd, u, now)
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	require.NoError(t, tmpl.Execute(&buf, rc))
+	return buf.String()
+}
+
+func TestReceipt(t *testing.T) {
+	require := require.New(t)
+
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	rd := db.Ride{
+		ID:       "r1",
+		Driver:   "Bond",
+		Kind:     "private",
+		Start:    start,
+		Distance: 3,
+		Riders:   []string{"Moneypenny"},
+	}
+
+	// Ongoing
+	html := renderReceipt(t, rd, User{"Moneypenny", Rider}, start.Add(10*time.Minute))
+	require.Contains(html, "ongoing")
+	require.Contains(html, "10m")
+	require.NotContains(html, "0001")
+	require.NotContains(html, "Total")
+
+	// Ended, priced
+	rd.End = start.Add(3 * time.Minute)
+	s := Server{fares: FaresConfig{BookingFee: 100, TaxRate: 0.1}}
+	_, err := s.priceRide(&rd, s.fares.extras(50))
+	require.NoError(err)
+	html = renderReceipt(t, rd, User{"Moneypenny", Rider}, start.Add(time.Hour))
+	for _, text := range []string{"ended", "Ride fee (distance)", "$7.50", "Surcharge: booking", "$1.00", "Tax (10%)", "$0.85", "$0.50", "$9.85", "3m"} {
+		require.Contains(html, text)
+	}
+
+	// Ended before fares were stored
+	rd.FareDetails = nil
+	html = renderReceipt(t, rd, User{"Moneypenny", Rider}, start.Add(time.Hour))
+	require.Contains(html, "$7.50")
+
+	// Cancelled
+	rd.Cancelled = true
+	html = renderReceipt(t, rd, User{"Moneypenny", Rider}, start.Add(time.Hour))
+	require.Contains(html, "cancelled")
+	require.NotContains(html, "Total")
+}
+
+func TestReceiptShared(t *testing.T) {
+	require := require.New(t)
+
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	at := func(min int) time.Time { return start.Add(time.Duration(min) * time.Minute) }
+	rd := db.Ride{
+		ID:       "r1",
+		Driver:   "Bond",
+		Kind:     "shared",
+		Start:    start,
+		End:      at(10),
+		Distance: 4,
+		Riders:   []string{"m", "q"},
+		Legs: []db.Leg{
+			{Rider: "m", Pickup: at(0)},
+			{Rider: "q", Pickup: at(2), Dropoff: at(4), Distance: 1},
+		},
+	}
+	s := Server{
+		gps:   GPSConfig{MaxSpeed: 120, Tolerance: 0.25},
+		fares: FaresConfig{BookingFee: 100},
+	}
+	require.NoError(s.priceLegs(&rd, nil))
+	fare, err := s.priceRide(&rd, s.fares.extras(0))
+	require.NoError(err)
+
+	// Riders see only their own leg
+	html := renderReceipt(t, rd, User{"q", Rider}, at(20))
+	for _, text := range []string{"Your leg (1.00 mi)", "$2.00", "Your share of surcharges, tax and tip", "$0.20", "$2.20"} {
+		require.Contains(html, text)
+	}
+	require.NotContains(html, `">m<`)
+	require.NotContains(html, formatCents(fare.Total))
+
+	// The driver and admins see the whole ride
+	for _, u := range []User{{"Bond", Writer}, {"M", Admin}} {
+		html = renderReceipt(t, rd, u, at(20))
+		require.Contains(html, `">q<`)
+		require.Contains(html, `">m<`)
+		require.Contains(html, formatCents(fare.Total))
+		require.NotContains(html, "Your leg")
+	}
+}
+
+func TestInfoAuth(t *testing.T) {
+	s := Server{log: log.New(io.Discard, "", 0)}
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/info/r1", nil)
+	s.infoHandler(w, r)
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/353solutions/unter/logger"
+)
+
+// Settings are the parts of the configuration that can change without a
+// restart. They are swapped atomically on reload.
+type Settings struct {
+	Access      *AccessLog // nil disables access log
+	Proxies     TrustedProxies
+	MaxBodySize int64
+	CertRoles   CertRoles
+}
+
+const defaultMaxBodySize = 3_000_000 // 3MB
+
+func NewSettings(cfg Config) (*Settings, error) {
+	var access *AccessLog
+	if cfg.AccessLog.Format != "off" {
+		var err error
+		access, err = NewAccessLog(os.Stdout, cfg.AccessLog.Format, cfg.AccessLog.SampleRate, cfg.AccessLog.SampledRoutes)
+		if err != nil {
+			return nil, fmt.Errorf("access log: %w", err)
+		}
+	}
+
+	proxies, err := ParseTrustedProxies(cfg.HTTP.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
+	roles, err := ParseCertRoles(cfg.TLS.ClientRoles)
+	if err != nil {
+		return nil, err
+	}
+
+	s := Settings{
+		Access:      access,
+		Proxies:     proxies,
+		MaxBodySize: cfg.HTTP.MaxBodySize,
+		CertRoles:   roles,
+	}
+	return &s, nil
+}
+
+// Settings returns the current settings.
+func (s *Server) Settings() *Settings {
+	if st := s.settings.Load(); st != nil {
+		return st
+	}
+	return &Settings{MaxBodySize: defaultMaxBodySize}
+}
+
+// reloadable are config fields (and their sub fields) applied on reload,
+// changing other fields requires a restart.
+var reloadable = []string{
+	"AccessLog.",
+	"HTTP.TrustedProxies",
+	"HTTP.MaxBodySize",
+	"TLS.Cert",
+	"TLS.Key",
+	"TLS.ClientRoles",
+	"Reload.",
+}
+
+func isReloadable(path string) bool {
+	for _, prefix := range reloadable {
+		if path == prefix || (strings.HasSuffix(prefix, ".") && strings.HasPrefix(path, prefix)) {
+			return true
+		}
+	}
+	return false
+}
+
+// certReloader serves a TLS certificate that can be replaced while running.
+// Existing connections keep their certificate, new handshakes get the new one.
+type certReloader struct {
+	mu   sync.RWMutex
+	cert *tls.Certificate
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	var cr certReloader
+	if err := cr.Load(certFile, keyFile); err != nil {
+		return nil, err
+	}
+	return &cr, nil
+}
+
+// Load loads a new certificate, on error the current one is kept.
+func (cr *certReloader) Load(certFile, keyFile string) error {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	cr.cert = &cert
+	return nil
+}
+
+// GetCertificate is used in tls.Config.
+func (cr *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cr.mu.RLock()
+	defer cr.mu.RUnlock()
+	return cr.cert, nil
+}
+
+// reloader re-reads the configuration and applies reloadable settings.
+type reloader struct {
+	s     *Server
+	log   *log.Logger
+	load  func() (Config, error)
+	certs *certReloader // nil when TLS is disabled
+
+	mu  sync.Mutex
+	cfg Config
+}
+
+// Reload loads the configuration and applies it, if the new configuration is
+// invalid it's rejected and the current one stays.
+func (rl *reloader) Reload() error {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	cfg, err := rl.load()
+	if err != nil {
+		rl.log.Printf("ERROR: reload rejected - %s", err)
+		return err
+	}
+
+	settings, err := NewSettings(cfg)
+	if err != nil {
+		rl.log.Printf("ERROR: reload rejected - %s", err)
+		return err
+	}
+
+	// Load certificate to a new reloader first so a bad certificate won't
+	// leave us with new settings and an old certificate.
+	var cert *certReloader
+	if rl.certs != nil && !cfg.TLS.Disable {
+		cert, err = newCertReloader(cfg.TLS.Cert, cfg.TLS.Key)
+		if err != nil {
+			rl.log.Printf("ERROR: reload rejected - TLS certificate: %s", err)
+			return err
+		}
+	}
+
+	for _, d := range configDiff(&rl.cfg, &cfg) {
+		if isReloadable(d.Path) {
+			rl.log.Printf("INFO: reload: %s", d)
+		} else {
+			rl.log.Printf("WARNING: reload: %s (requires restart, ignored)", d)
+		}
+	}
+
+	rl.s.settings.Store(settings)
+	if cert != nil {
+		c, _ := cert.GetCertificate(nil)
+		rl.certs.mu.Lock()
+		rl.certs.cert = c
+		rl.certs.mu.Unlock()
+	}
+	rl.cfg = cfg
+	rl.log.Printf("INFO: configuration reloaded")
+	return nil
+}
+
+type fieldDiff struct {
+	Path     string
+	Old, New string
+}
+
+func (d fieldDiff) String() string {
+	return fmt.Sprintf("%s: %q -> %q", d.Path, d.Old, d.New)
+}
+
+// configDiff returns changed fields between two configurations, secrets are
+// masked.
+func configDiff(old, new *Config) []fieldDiff {
+	oldFields := configFields(envPrefix, old)
+	newFields := configFields(envPrefix, new)
+
+	var diffs []fieldDiff
+	for i, of := range oldFields {
+		nf := newFields[i]
+		if reflect.DeepEqual(of.Value.Interface(), nf.Value.Interface()) {
+			continue
+		}
+
+		d := fieldDiff{
+			Path: of.Path,
+			Old:  fmt.Sprint(of.Value.Interface()),
+			New:  fmt.Sprint(nf.Value.Interface()),
+		}
+		if of.Mask {
+			d.Old, d.New = logger.Masked, logger.Masked
+		}
+		diffs = append(diffs, d)
+	}
+	return diffs
+}
+
+// watchFiles returns the files to watch for changes.
+func (rl *reloader) watchFiles() []string {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	var files []string
+	for _, f := range []string{rl.cfg.ConfigFile, rl.cfg.DSNFile} {
+		if f != "" {
+			files = append(files, f)
+		}
+	}
+	if rl.certs != nil {
+		files = append(files, rl.cfg.TLS.Cert, rl.cfg.TLS.Key)
+	}
+	return files
+}
+
+func (rl *reloader) interval() time.Duration {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	return rl.cfg.Reload.WatchInterval
+}
+
+// Run reloads on SIGHUP and, if WatchInterval is set, when one of the
+// configuration or certificate files changes. It returns when ctx is done.
+func (rl *reloader) Run(ctx context.Context) {
+	hupCh := make(chan os.Signal, 1)
+	signal.Notify(hupCh, syscall.SIGHUP)
+	defer signal.Stop(hupCh)
+
+	mtimes := fileTimes(rl.watchFiles())
+	for {
+		var tick <-chan time.Time
+		if d := rl.interval(); d > 0 {
+			tick = time.After(d)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-hupCh:
+			rl.log.Printf("INFO: caught SIGHUP, reloading")
+			rl.Reload() //#nosec G104 - logged in Reload
+			mtimes = fileTimes(rl.watchFiles())
+		case <-tick:
+			current := fileTimes(rl.watchFiles())
+			if !reflect.DeepEqual(current, mtimes) {
+				rl.log.Printf("INFO: files changed, reloading")
+				rl.Reload() //#nosec G104 - logged in Reload
+				mtimes = current
+			}
+		}
+	}
+}
+
+func fileTimes(files []string) map[string]time.Time {
+	times := make(map[string]time.Time)
+	for _, f := range files {
+		if info, err := os.Stat(f); err == nil {
+			times[f] = info.ModTime()
+		}
+	}
+	return times
+}
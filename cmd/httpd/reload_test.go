@@ -0,0 +1,101 @@
+package main
+
+import (
+	"crypto/x509"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestCert writes cert.pem & key.pem for cn to dir.
+func writeTestCert(t *testing.T, dir, cn string) (string, string) {
+	opts := certsOptions{
+		dir:     dir,
+		hosts:   []string{cn},
+		caTTL:   day,
+		certTTL: time.Hour,
+	}
+	err := genCerts(opts, io.Discard)
+	require.NoError(t, err)
+
+	return filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+}
+
+func certCN(t *testing.T, cr *certReloader) string {
+	c, err := cr.GetCertificate(nil)
+	require.NoError(t, err)
+	x, err := x509.ParseCertificate(c.Certificate[0])
+	require.NoError(t, err)
+	return x.Subject.CommonName
+}
+
+func TestReload(t *testing.T) {
+	require := require.New(t)
+
+	dir := t.TempDir()
+	certFile, keyFile := writeTestCert(t, dir, "old.local")
+
+	t.Setenv("UNTER_TLS_CERT", certFile)
+	t.Setenv("UNTER_TLS_KEY", keyFile)
+	cfg, err := loadConfig()
+	require.NoError(err)
+
+	var s Server
+	settings, err := NewSettings(cfg)
+	require.NoError(err)
+	s.settings.Store(settings)
+
+	certs, err := newCertReloader(certFile, keyFile)
+	require.NoError(err)
+	rl := reloader{
+		s:     &s,
+		log:   log.New(io.Discard, "", 0),
+		load:  loadConfig,
+		certs: certs,
+		cfg:   cfg,
+	}
+
+	// Valid reload
+	writeTestCert(t, dir, "new.local")
+	t.Setenv("UNTER_HTTP_MAX_BODY_SIZE", "1000")
+	err = rl.Reload()
+	require.NoError(err)
+	require.Equal(int64(1000), s.Settings().MaxBodySize)
+	require.Equal("new.local", certCN(t, certs))
+
+	// Invalid config, old settings stay
+	t.Setenv("UNTER_HTTP_MAX_BODY_SIZE", "2000")
+	t.Setenv("UNTER_ACCESS_LOG_FORMAT", "xml")
+	err = rl.Reload()
+	require.Error(err)
+	require.Equal(int64(1000), s.Settings().MaxBodySize)
+
+	// Bad certificate, old settings and certificate stay
+	t.Setenv("UNTER_ACCESS_LOG_FORMAT", "json")
+	err = os.WriteFile(certFile, []byte("garbage"), 0600)
+	require.NoError(err)
+	err = rl.Reload()
+	require.Error(err)
+	require.Equal(int64(1000), s.Settings().MaxBodySize)
+	require.Equal("new.local", certCN(t, certs))
+}
+
+func TestConfigDiff(t *testing.T) {
+	var old, new Config
+	old.DSN = "password=a"
+	new.DSN = "password=b"
+	new.HTTP.MaxBodySize = 10
+
+	diffs := configDiff(&old, &new)
+	require.Len(t, diffs, 2)
+	out := fmt.Sprint(diffs)
+	require.NotContains(t, out, "password")
+	require.False(t, isReloadable(diffs[0].Path), diffs[0].Path)
+	require.True(t, isReloadable(diffs[1].Path), diffs[1].Path)
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/353solutions/unter"
+	"github.com/353solutions/unter/db"
+)
+
+/* Riders
+
+POST /riders     (Admin or the rider) {"login": "Moneypenny", "name": "Eve Moneypenny", "email": "...", "password": "..."}
+GET  /me/rides   (rider) ?limit=20
+
+Riders are linked to rides by login, shared rides can have several. Riders
+with a password log in with basic auth, others with a client certificate
+mapped to the rider role.
+*/
+
+const maxRiderRides = 100
+
+func (s *Server) addRiderHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireRole(w, r, Admin, Rider) {
+		return
+	}
+
+	var req struct {
+		Login    string
+		Name     string
+		Email    string
+		Phone    string
+		Password string
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, "bad json", http.StatusBadRequest)
+		return
+	}
+
+	// Riders register themselves
+	u := RequestValues(r.Context()).User
+	if u.Role == Rider {
+		req.Login = u.Login
+	}
+
+	rd := unter.Rider{
+		Login:   strings.ToValidUTF8(req.Login, ""),
+		Name:    strings.ToValidUTF8(req.Name, ""),
+		Email:   req.Email,
+		Phone:   req.Phone,
+		Created: time.Now().UTC(),
+	}
+	if err := rd.Validate(); err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var hash string
+	if req.Password != "" {
+		if len(req.Password) < minPasswordLen {
+			httpError(w, r, fmt.Sprintf("password must be at least %d characters", minPasswordLen), http.StatusBadRequest)
+			return
+		}
+		var err error
+		hash, err = hashPassword(req.Password)
+		if err != nil {
+			httpError(w, r, "can't hash password", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	err := s.db.AddRider(r.Context(), db.Rider(rd), hash)
+	switch {
+	case errors.Is(err, db.ErrExists):
+		httpError(w, r, "rider exists", http.StatusConflict)
+		return
+	case err != nil:
+		httpError(w, r, "can't insert", http.StatusInternalServerError)
+		return
+	}
+	ctxLogger(s.log, r.Context()).Printf("INFO: rider %s registered", rd.Login)
+
+	resp := map[string]any{
+		"login": rd.Login,
+		"name":  rd.Name,
+	}
+	w.WriteHeader(http.StatusCreated)
+	if err := sendJSON(w, resp); err != nil {
+		s.log.Printf("WARNING: can't send - %s", err)
+	}
+}
+
+// riderLogin returns the rider user if passwd matches the rider password.
+func (s *Server) riderLogin(ctx context.Context, login, passwd string) (User, error) {
+	hash, err := s.db.RiderPassword(ctx, login)
+	if errors.Is(err, db.ErrNotFound) {
+		return User{}, ErrBadLogin
+	}
+	if err != nil {
+		return User{}, err
+	}
+	if !checkPassword(hash, passwd) {
+		return User{}, ErrBadLogin
+	}
+	return User{login, Rider}, nil
+}
+
+// checkRiders returns an error if one of riders is not registered.
+func (s *Server) checkRiders(ctx context.Context, riders []string) error {
+	for _, login := range riders {
+		if _, err := s.db.Rider(ctx, login); err != nil {
+			if errors.Is(err, db.ErrNotFound) {
+				return fmt.Errorf("unknown rider: %q", login)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Server) myRidesHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireRole(w, r, Rider) {
+		return
+	}
+
+	limit := 20
+	if s := r.URL.Query().Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 || n > maxRiderRides {
+			httpError(w, r, "bad limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	login := RequestValues(r.Context()).User.Login
+	rides, err := s.db.RiderRides(r.Context(), login, limit)
+	if err != nil {
+		httpError(w, r, "can't list", http.StatusInternalServerError)
+		return
+	}
+
+	resp := make([]GetResponse, len(rides))
+	for i, rd := range rides {
+		resp[i] = rideResponse(rd)
+	}
+	if err := sendJSON(w, resp); err != nil {
+		httpError(w, r, "can't marshal to JSON", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var addRiderCases = []struct {
+	name string
+	user User
+	body string
+	code int
+}{
+	{"driver", User{"Bond", Writer}, `{"name": "James"}`, http.StatusForbidden},
+	{"no name", User{"Moneypenny", Rider}, `{}`, http.StatusBadRequest},
+	{"bad email", User{"Moneypenny", Rider}, `{"name": "Eve", "email": "eve"}`, http.StatusBadRequest},
+	{"admin no login", User{"M", Admin}, `{"name": "Eve"}`, http.StatusBadRequest},
+	{"short password", User{"Moneypenny", Rider}, `{"name": "Eve", "password": "p3nny"}`, http.StatusBadRequest},
+}
+
+func TestAddRiderBad(t *testing.T) {
+	s := Server{log: log.New(io.Discard, "", 0)}
+	for _, tc := range addRiderCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			s.addRiderHandler(w, userRequest(http.MethodPost, "/riders", tc.body, tc.user, nil))
+			require.Equal(t, tc.code, w.Code)
+		})
+	}
+}
+
+func TestMyRidesRole(t *testing.T) {
+	s := Server{log: log.New(io.Discard, "", 0)}
+	w := httptest.NewRecorder()
+	s.myRidesHandler(w, userRequest(http.MethodGet, "/me/rides", "", User{"Bond", Writer}, nil))
+	require.Equal(t, http.StatusForbidden, w.Code)
+
+	w = httptest.NewRecorder()
+	s.myRidesHandler(w, userRequest(http.MethodGet, "/me/rides?limit=1000", "", User{"Moneypenny", Rider}, nil))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestRiderBasicAuth(t *testing.T) {
+	hash, err := hashPassword("m0neypenny")
+	require.NoError(t, err)
+	riderLogin := func(ctx context.Context, login, passwd string) (User, error) {
+		if login != "Moneypenny" || !checkPassword(hash, passwd) {
+			return User{}, ErrBadLogin
+		}
+		return User{login, Rider}, nil
+	}
+
+	var user User
+	h := topMiddleware(log.New(io.Discard, "", 0), staticSettings(&Settings{}), riderLogin, http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			user = RequestValues(r.Context()).User
+		}))
+
+	cases := []struct {
+		login  string
+		passwd string
+		code   int
+		user   User
+	}{
+		{"Moneypenny", "m0neypenny", http.StatusOK, User{"Moneypenny", Rider}},
+		{"Moneypenny", "p3nny", http.StatusForbidden, User{}},
+		{"Bond", "007", http.StatusOK, User{"Bond", Writer}},
+	}
+	for _, tc := range cases {
+		user = User{}
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/me/rides", nil)
+		r.SetBasicAuth(tc.login, tc.passwd)
+		h.ServeHTTP(w, r)
+		require.Equal(t, tc.code, w.Code, tc.login)
+		require.Equal(t, tc.user, user, tc.login)
+	}
+}
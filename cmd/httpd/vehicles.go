@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/353solutions/unter"
+	"github.com/353solutions/unter/db"
+)
+
+/* Vehicles
+
+POST /vehicles                    (Admin) {"plate": "BMT 216A", "model": "Aston Martin DB5", "capacity": 1, "class": "premium", "inspection_expires": "2027-01-01T00:00:00Z"}
+GET  /vehicles/{id}               (Admin)
+POST /vehicles/{id}/assign        (Admin) {"driver": "Bond"}
+GET  /vehicles/{id}/assignments   (Admin)
+
+Rides are driven in the driver's assigned vehicle (the ride car_id), the
+vehicle must fit the ride kind and have a valid inspection.
+*/
+
+var (
+	errNoVehicle   = errors.New("driver has no vehicle")
+	errNotAssigned = errors.New("vehicle not assigned to driver")
+)
+
+func classFromString(s string) (unter.Class, error) {
+	for _, c := range []unter.Class{unter.Standard, unter.XL, unter.Premium} {
+		if s == c.String() {
+			return c, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown class: %s", s)
+}
+
+func vehicleFromDB(v db.Vehicle) (unter.Vehicle, error) {
+	c, err := classFromString(v.Class)
+	if err != nil {
+		return unter.Vehicle{}, err
+	}
+
+	uv := unter.Vehicle{
+		ID:                v.ID,
+		Plate:             v.Plate,
+		Model:             v.Model,
+		Capacity:          v.Capacity,
+		Class:             c,
+		InspectionExpires: v.InspectionExpires,
+	}
+	return uv, nil
+}
+
+type VehicleResponse struct {
+	ID                string    `json:"id"`
+	Plate             string    `json:"plate"`
+	Model             string    `json:"model,omitempty"`
+	Capacity          int       `json:"capacity"`
+	Class             string    `json:"class"`
+	InspectionExpires time.Time `json:"inspection_expires"`
+}
+
+func vehicleResponse(v unter.Vehicle) VehicleResponse {
+	return VehicleResponse{
+		ID:                v.ID,
+		Plate:             v.Plate,
+		Model:             v.Model,
+		Capacity:          v.Capacity,
+		Class:             v.Class.String(),
+		InspectionExpires: v.InspectionExpires,
+	}
+}
+
+// rideVehicle returns the vehicle for a ride of driver. carID is optional
+// and defaults to the driver's vehicle.
+func (s *Server) rideVehicle(ctx context.Context, driver, carID string, k unter.Kind, riders int) (unter.Vehicle, error) {
+	dv, err := s.db.DriverVehicle(ctx, driver)
+	switch {
+	case errors.Is(err, db.ErrNotFound):
+		return unter.Vehicle{}, errNoVehicle
+	case err != nil:
+		return unter.Vehicle{}, err
+	}
+	if carID != "" && carID != dv.ID {
+		return unter.Vehicle{}, errNotAssigned
+	}
+
+	v, err := vehicleFromDB(dv)
+	if err != nil {
+		return unter.Vehicle{}, err
+	}
+	if riders < 1 {
+		riders = 1
+	}
+	if err := v.CanServe(k, riders, time.Now()); err != nil {
+		return unter.Vehicle{}, err
+	}
+	return v, nil
+}
+
+// vehicleError sends a rideVehicle error.
+func vehicleError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, errNoVehicle), errors.Is(err, errNotAssigned), errors.Is(err, unter.ErrInspectionExpired):
+		httpError(w, r, err.Error(), http.StatusForbidden)
+	case errors.Is(err, unter.ErrCapacity), errors.Is(err, unter.ErrClass):
+		httpError(w, r, err.Error(), http.StatusUnprocessableEntity)
+	default:
+		httpError(w, r, "can't get vehicle", http.StatusInternalServerError)
+	}
+}
+
+func (s *Server) addVehicleHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireRole(w, r, Admin) {
+		return
+	}
+
+	var req struct {
+		Plate             string
+		Model             string
+		Capacity          int
+		Class             string
+		InspectionExpires time.Time `json:"inspection_expires"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, "bad json", http.StatusBadRequest)
+		return
+	}
+
+	c, err := classFromString(req.Class)
+	if err != nil {
+		httpError(w, r, "bad class", http.StatusBadRequest)
+		return
+	}
+	v := unter.Vehicle{
+		ID:                unter.NewID(),
+		Plate:             strings.ToUpper(strings.TrimSpace(strings.ToValidUTF8(req.Plate, ""))),
+		Model:             strings.ToValidUTF8(req.Model, ""),
+		Capacity:          req.Capacity,
+		Class:             c,
+		InspectionExpires: req.InspectionExpires.UTC(),
+	}
+	if err := v.Validate(); err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	dv := db.Vehicle{
+		ID:                v.ID,
+		Plate:             v.Plate,
+		Model:             v.Model,
+		Capacity:          v.Capacity,
+		Class:             v.Class.String(),
+		InspectionExpires: v.InspectionExpires,
+		Created:           time.Now().UTC(),
+	}
+	if err := s.db.AddVehicle(r.Context(), dv); err != nil {
+		httpError(w, r, "can't insert", http.StatusInternalServerError)
+		return
+	}
+	ctxLogger(s.log, r.Context()).Printf("INFO: vehicle %s (%s) added", v.ID, v.Plate)
+
+	w.WriteHeader(http.StatusCreated)
+	if err := sendJSON(w, vehicleResponse(v)); err != nil {
+		s.log.Printf("WARNING: can't send - %s", err)
+	}
+}
+
+// vehicle returns the vehicle in the URL, it sends an error and returns
+// false if not found.
+func (s *Server) vehicle(w http.ResponseWriter, r *http.Request) (unter.Vehicle, bool) {
+	dv, err := s.db.Vehicle(r.Context(), mux.Vars(r)["id"])
+	switch {
+	case errors.Is(err, db.ErrNotFound):
+		httpError(w, r, "not found", http.StatusNotFound)
+		return unter.Vehicle{}, false
+	case err != nil:
+		httpError(w, r, "can't get", http.StatusInternalServerError)
+		return unter.Vehicle{}, false
+	}
+
+	v, err := vehicleFromDB(dv)
+	if err != nil {
+		httpError(w, r, "can't get", http.StatusInternalServerError)
+		return unter.Vehicle{}, false
+	}
+	return v, true
+}
+
+func (s *Server) getVehicleHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireRole(w, r, Admin) {
+		return
+	}
+	v, ok := s.vehicle(w, r)
+	if !ok {
+		return
+	}
+
+	if err := sendJSON(w, vehicleResponse(v)); err != nil {
+		httpError(w, r, "can't marshal to JSON", http.StatusInternalServerError)
+	}
+}
+
+func (s *Server) assignVehicleHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireRole(w, r, Admin) {
+		return
+	}
+
+	var req struct {
+		Driver string
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, "bad json", http.StatusBadRequest)
+		return
+	}
+
+	v, ok := s.vehicle(w, r)
+	if !ok {
+		return
+	}
+	_, err := s.db.Driver(r.Context(), req.Driver)
+	switch {
+	case errors.Is(err, db.ErrNotFound):
+		httpError(w, r, "unknown driver", http.StatusBadRequest)
+		return
+	case err != nil:
+		httpError(w, r, "can't get driver", http.StatusInternalServerError)
+		return
+	}
+
+	if err := s.db.AssignVehicle(r.Context(), v.ID, req.Driver, time.Now().UTC()); err != nil {
+		httpError(w, r, "can't assign", http.StatusInternalServerError)
+		return
+	}
+	ctxLogger(s.log, r.Context()).Printf("INFO: vehicle %s assigned to %s", v.ID, req.Driver)
+
+	resp := map[string]any{
+		"id":     v.ID,
+		"driver": req.Driver,
+	}
+	if err := sendJSON(w, resp); err != nil {
+		httpError(w, r, "can't marshal to JSON", http.StatusInternalServerError)
+	}
+}
+
+type AssignmentResponse struct {
+	Driver string     `json:"driver"`
+	Start  time.Time  `json:"start"`
+	End    *time.Time `json:"end,omitempty"`
+}
+
+func (s *Server) assignmentsHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireRole(w, r, Admin) {
+		return
+	}
+
+	as, err := s.db.Assignments(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		httpError(w, r, "can't list", http.StatusInternalServerError)
+		return
+	}
+
+	resp := make([]AssignmentResponse, len(as))
+	for i, a := range as {
+		resp[i] = AssignmentResponse{Driver: a.Driver, Start: a.Start}
+		if !a.End.IsZero() {
+			resp[i].End = &as[i].End
+		}
+	}
+	if err := sendJSON(w, resp); err != nil {
+		httpError(w, r, "can't marshal to JSON", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var addVehicleCases = []struct {
+	name string
+	body string
+}{
+	{"bad class", `{"plate": "BMT 216A", "capacity": 1, "class": "tank", "inspection_expires": "2030-01-01T00:00:00Z"}`},
+	{"no plate", `{"capacity": 1, "class": "premium", "inspection_expires": "2030-01-01T00:00:00Z"}`},
+	{"no seats", `{"plate": "BMT 216A", "class": "premium", "inspection_expires": "2030-01-01T00:00:00Z"}`},
+	{"no inspection", `{"plate": "BMT 216A", "capacity": 1, "class": "premium"}`},
+}
+
+func TestAddVehicleBad(t *testing.T) {
+	s := Server{log: log.New(io.Discard, "", 0)}
+	for _, tc := range addVehicleCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			s.addVehicleHandler(w, userRequest(http.MethodPost, "/vehicles", tc.body, User{"M", Admin}, nil))
+			require.Equal(t, http.StatusBadRequest, w.Code)
+		})
+	}
+
+	w := httptest.NewRecorder()
+	s.addVehicleHandler(w, userRequest(http.MethodPost, "/vehicles", addVehicleCases[0].body, User{"Bond", Writer}, nil))
+	require.Equal(t, http.StatusForbidden, w.Code)
+}
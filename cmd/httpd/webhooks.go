@@ -0,0 +1,319 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/353solutions/unter/db"
+	"github.com/353solutions/unter/events"
+	"github.com/353solutions/unter/webhook"
+)
+
+/* Webhooks admin API (Admin role)
+
+POST   /admin/webhooks                   {"url": "...", "events": ["ride.ended"]}
+GET    /admin/webhooks
+DELETE /admin/webhooks/{id}
+GET    /admin/webhooks/{id}/deliveries   ?status=dead&limit=50
+GET    /admin/deliveries/{id}            delivery with attempts
+POST   /admin/deliveries/{id}/retry      dead -> pending
+
+The signing secret is returned only on creation.
+*/
+
+func (s *Server) addWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireRole(w, r, Admin) {
+		return
+	}
+
+	var req struct {
+		URL    string
+		Events []string
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, r, "bad json", http.StatusBadRequest)
+		return
+	}
+
+	sub := webhook.Subscription{
+		ID:      webhook.NewID("wh"),
+		URL:     req.URL,
+		Secret:  webhook.NewSecret(),
+		Events:  req.Events,
+		Created: time.Now().UTC(),
+	}
+	known := make([]string, len(events.Types))
+	for i, t := range events.Types {
+		known[i] = string(t)
+	}
+	if err := sub.Validate(known...); err != nil {
+		httpError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := s.webhooks.Store().AddSubscription(r.Context(), sub); err != nil {
+		httpError(w, r, "can't add", http.StatusInternalServerError)
+		return
+	}
+	ctxLogger(s.log, r.Context()).Printf("INFO: webhook %s added for %s", sub.ID, sub.URL)
+
+	w.WriteHeader(http.StatusCreated)
+	if err := sendJSON(w, sub); err != nil {
+		s.log.Printf("WARNING: can't send - %s", err)
+	}
+}
+
+func (s *Server) listWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireRole(w, r, Admin) {
+		return
+	}
+
+	subs, err := s.webhooks.Store().Subscriptions(r.Context())
+	if err != nil {
+		httpError(w, r, "can't list", http.StatusInternalServerError)
+		return
+	}
+	for i := range subs {
+		subs[i].Secret = ""
+	}
+
+	if err := sendJSON(w, subs); err != nil {
+		httpError(w, r, "can't marshal to JSON", http.StatusInternalServerError)
+	}
+}
+
+func (s *Server) deleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireRole(w, r, Admin) {
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+	err := s.webhooks.Store().DeleteSubscription(r.Context(), id)
+	switch {
+	case errors.Is(err, webhook.ErrNotFound):
+		httpError(w, r, "not found", http.StatusNotFound)
+		return
+	case err != nil:
+		httpError(w, r, "can't delete", http.StatusInternalServerError)
+		return
+	}
+	ctxLogger(s.log, r.Context()).Printf("INFO: webhook %s deleted", id)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+const maxDeliveries = 500
+
+func (s *Server) listDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireRole(w, r, Admin) {
+		return
+	}
+
+	status := webhook.Status(r.URL.Query().Get("status"))
+	switch status {
+	case "", webhook.Pending, webhook.Delivered, webhook.Dead:
+	default:
+		httpError(w, r, "bad status", http.StatusBadRequest)
+		return
+	}
+
+	limit := 50
+	if s := r.URL.Query().Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 || n > maxDeliveries {
+			httpError(w, r, "bad limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	ds, err := s.webhooks.Store().Deliveries(r.Context(), mux.Vars(r)["id"], status, limit)
+	if err != nil {
+		httpError(w, r, "can't list", http.StatusInternalServerError)
+		return
+	}
+	if ds == nil {
+		ds = []webhook.Delivery{}
+	}
+
+	if err := sendJSON(w, ds); err != nil {
+		httpError(w, r, "can't marshal to JSON", http.StatusInternalServerError)
+	}
+}
+
+func (s *Server) getDeliveryHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireRole(w, r, Admin) {
+		return
+	}
+
+	store := s.webhooks.Store()
+	d, err := store.Delivery(r.Context(), mux.Vars(r)["id"])
+	switch {
+	case errors.Is(err, webhook.ErrNotFound):
+		httpError(w, r, "not found", http.StatusNotFound)
+		return
+	case err != nil:
+		httpError(w, r, "can't get", http.StatusInternalServerError)
+		return
+	}
+
+	attempts, err := store.Attempts(r.Context(), d.ID)
+	if err != nil {
+		httpError(w, r, "can't get attempts", http.StatusInternalServerError)
+		return
+	}
+
+	resp := struct {
+		webhook.Delivery
+		Payload  json.RawMessage   `json:"payload"`
+		Attempts []webhook.Attempt `json:"attempt_log"`
+	}{d, d.Payload, attempts}
+	if err := sendJSON(w, resp); err != nil {
+		httpError(w, r, "can't marshal to JSON", http.StatusInternalServerError)
+	}
+}
+
+func (s *Server) retryDeliveryHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireRole(w, r, Admin) {
+		return
+	}
+
+	d, err := s.webhooks.Retry(r.Context(), mux.Vars(r)["id"])
+	switch {
+	case errors.Is(err, webhook.ErrNotFound):
+		httpError(w, r, "not found", http.StatusNotFound)
+		return
+	case errors.Is(err, webhook.ErrNotDead):
+		httpError(w, r, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		httpError(w, r, "can't retry", http.StatusInternalServerError)
+		return
+	}
+
+	if err := sendJSON(w, d); err != nil {
+		httpError(w, r, "can't marshal to JSON", http.StatusInternalServerError)
+	}
+}
+
+// webhookStore is a webhook.Store on top of the database.
+type webhookStore struct {
+	db *db.DB
+}
+
+func storeErr(err error) error {
+	if errors.Is(err, db.ErrNotFound) {
+		return webhook.ErrNotFound
+	}
+	return err
+}
+
+func (ws webhookStore) AddSubscription(ctx context.Context, s webhook.Subscription) error {
+	return ws.db.AddWebhook(ctx, db.Webhook(s))
+}
+
+func (ws webhookStore) Subscription(ctx context.Context, id string) (webhook.Subscription, error) {
+	w, err := ws.db.Webhook(ctx, id)
+	return webhook.Subscription(w), storeErr(err)
+}
+
+func (ws webhookStore) Subscriptions(ctx context.Context) ([]webhook.Subscription, error) {
+	hooks, err := ws.db.Webhooks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	subs := make([]webhook.Subscription, len(hooks))
+	for i, w := range hooks {
+		subs[i] = webhook.Subscription(w)
+	}
+	return subs, nil
+}
+
+func (ws webhookStore) DeleteSubscription(ctx context.Context, id string) error {
+	return storeErr(ws.db.DeleteWebhook(ctx, id))
+}
+
+func toDBDelivery(d webhook.Delivery) db.WebhookDelivery {
+	return db.WebhookDelivery{
+		ID:          d.ID,
+		WebhookID:   d.SubscriptionID,
+		EventID:     d.EventID,
+		EventType:   d.EventType,
+		Payload:     d.Payload,
+		Status:      string(d.Status),
+		Attempts:    d.Attempts,
+		NextAttempt: d.NextAttempt,
+		LastError:   d.LastError,
+		Created:     d.Created,
+		Updated:     d.Updated,
+	}
+}
+
+func fromDBDelivery(d db.WebhookDelivery) webhook.Delivery {
+	return webhook.Delivery{
+		ID:             d.ID,
+		SubscriptionID: d.WebhookID,
+		EventID:        d.EventID,
+		EventType:      d.EventType,
+		Payload:        d.Payload,
+		Status:         webhook.Status(d.Status),
+		Attempts:       d.Attempts,
+		NextAttempt:    d.NextAttempt,
+		LastError:      d.LastError,
+		Created:        d.Created,
+		Updated:        d.Updated,
+	}
+}
+
+func fromDBDeliveries(ds []db.WebhookDelivery) []webhook.Delivery {
+	out := make([]webhook.Delivery, len(ds))
+	for i, d := range ds {
+		out[i] = fromDBDelivery(d)
+	}
+	return out
+}
+
+func (ws webhookStore) AddDelivery(ctx context.Context, d webhook.Delivery) error {
+	return ws.db.AddDelivery(ctx, toDBDelivery(d))
+}
+
+func (ws webhookStore) Delivery(ctx context.Context, id string) (webhook.Delivery, error) {
+	d, err := ws.db.Delivery(ctx, id)
+	return fromDBDelivery(d), storeErr(err)
+}
+
+func (ws webhookStore) UpdateDelivery(ctx context.Context, d webhook.Delivery) error {
+	return ws.db.UpdateDelivery(ctx, toDBDelivery(d))
+}
+
+func (ws webhookStore) Deliveries(ctx context.Context, subID string, status webhook.Status, limit int) ([]webhook.Delivery, error) {
+	ds, err := ws.db.Deliveries(ctx, subID, string(status), limit)
+	return fromDBDeliveries(ds), err
+}
+
+func (ws webhookStore) ClaimDue(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]webhook.Delivery, error) {
+	ds, err := ws.db.ClaimDue(ctx, now, lease, limit)
+	return fromDBDeliveries(ds), err
+}
+
+func (ws webhookStore) AddAttempt(ctx context.Context, a webhook.Attempt) error {
+	return ws.db.AddAttempt(ctx, db.WebhookAttempt(a))
+}
+
+func (ws webhookStore) Attempts(ctx context.Context, deliveryID string) ([]webhook.Attempt, error) {
+	as, err := ws.db.Attempts(ctx, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]webhook.Attempt, len(as))
+	for i, a := range as {
+		out[i] = webhook.Attempt(a)
+	}
+	return out, nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+
+	"github.com/353solutions/unter/events"
+	"github.com/353solutions/unter/webhook"
+)
+
+// userRequest returns a request as user, bypassing authentication.
+func userRequest(method, path, body string, u User, vars map[string]string) *http.Request {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	v := Values{
+		RequestID: "test",
+		User:      u,
+	}
+	r = r.Clone(context.WithValue(r.Context(), ctxKey, &v))
+	return mux.SetURLVars(r, vars)
+}
+
+func TestWebhooksAdmin(t *testing.T) {
+	require := require.New(t)
+
+	type received struct {
+		header http.Header
+		body   []byte
+	}
+	ch := make(chan received, 1)
+	rcv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		ch <- received{r.Header, body}
+	}))
+	defer rcv.Close()
+
+	s := Server{
+		log:      log.New(io.Discard, "", 0),
+		webhooks: webhook.NewDispatcher(webhook.NewMemStore(), time.Second),
+	}
+	admin := User{"ops", Admin}
+
+	// Not admin
+	w := httptest.NewRecorder()
+	s.addWebhookHandler(w, userRequest("POST", "/admin/webhooks", `{"url": "http://localhost"}`, User{"Q", Viewer}, nil))
+	require.Equal(http.StatusForbidden, w.Code)
+
+	// Bad event
+	w = httptest.NewRecorder()
+	body := `{"url": "` + rcv.URL + `", "events": ["ride.exploded"]}`
+	s.addWebhookHandler(w, userRequest("POST", "/admin/webhooks", body, admin, nil))
+	require.Equal(http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	body = `{"url": "` + rcv.URL + `", "events": ["ride.ended"]}`
+	s.addWebhookHandler(w, userRequest("POST", "/admin/webhooks", body, admin, nil))
+	require.Equal(http.StatusCreated, w.Code)
+	var sub webhook.Subscription
+	require.NoError(json.NewDecoder(w.Body).Decode(&sub))
+	require.NotEmpty(sub.Secret)
+
+	// Secret not listed
+	w = httptest.NewRecorder()
+	s.listWebhooksHandler(w, userRequest("GET", "/admin/webhooks", "", admin, nil))
+	require.Equal(http.StatusOK, w.Code)
+	require.NotContains(w.Body.String(), sub.Secret)
+
+	ctx := context.Background()
+	err := s.webhooks.Enqueue(ctx, events.Event{ID: 7, Type: events.RideEnded, RideID: "r1", Driver: "Bond"})
+	require.NoError(err)
+	_, err = s.webhooks.Process(ctx)
+	require.NoError(err)
+
+	got := <-ch
+	require.Equal(string(events.RideEnded), got.header.Get(webhook.EventHeader))
+	err = webhook.Verify(sub.Secret, got.header.Get(webhook.SignatureHeader), got.body, time.Minute)
+	require.NoError(err)
+
+	w = httptest.NewRecorder()
+	vars := map[string]string{"id": sub.ID}
+	s.listDeliveriesHandler(w, userRequest("GET", "/admin/webhooks/x/deliveries?status=delivered", "", admin, vars))
+	require.Equal(http.StatusOK, w.Code)
+	var ds []webhook.Delivery
+	require.NoError(json.NewDecoder(w.Body).Decode(&ds))
+	require.Len(ds, 1)
+	require.Equal(int64(7), ds[0].EventID)
+
+	w = httptest.NewRecorder()
+	vars = map[string]string{"id": ds[0].ID}
+	s.getDeliveryHandler(w, userRequest("GET", "/admin/deliveries/x", "", admin, vars))
+	require.Equal(http.StatusOK, w.Code)
+	var d struct {
+		Payload    events.Event
+		AttemptLog []webhook.Attempt `json:"attempt_log"`
+	}
+	require.NoError(json.NewDecoder(w.Body).Decode(&d))
+	require.Equal("r1", d.Payload.RideID)
+	require.Len(d.AttemptLog, 1)
+
+	// Only dead deliveries can be retried
+	w = httptest.NewRecorder()
+	s.retryDeliveryHandler(w, userRequest("POST", "/admin/deliveries/x/retry", "", admin, vars))
+	require.Equal(http.StatusConflict, w.Code)
+
+	w = httptest.NewRecorder()
+	vars = map[string]string{"id": sub.ID}
+	s.deleteWebhookHandler(w, userRequest("DELETE", "/admin/webhooks/x", "", admin, vars))
+	require.Equal(http.StatusNoContent, w.Code)
+}
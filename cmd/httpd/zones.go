@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/353solutions/unter/db"
+	"github.com/353solutions/unter/geo"
+)
+
+var (
+	errMissingLocation = errors.New("missing location")
+	errBadLocation     = errors.New("bad location")
+	errOutsideZones    = errors.New("outside service zones")
+)
+
+// ridePosition returns the position for optional lat/lon, nil if both are
+// missing.
+func ridePosition(lat, lon *float64) (*db.Position, error) {
+	if lat == nil && lon == nil {
+		return nil, nil
+	}
+	if lat == nil || lon == nil {
+		return nil, errBadLocation
+	}
+
+	p := geo.Point{Lat: *lat, Lon: *lon, Time: time.Now()} // reported now
+	if err := p.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %s", errBadLocation, err)
+	}
+	return &db.Position{Lat: p.Lat, Lon: p.Lon}, nil
+}
+
+// startZone returns the zone a ride starts in. When zones are configured the
+// position is required and must be in a zone.
+func (s *Server) startZone(pos *db.Position) (string, error) {
+	if s.zones == nil {
+		return "", nil
+	}
+	if pos == nil {
+		return "", errMissingLocation
+	}
+
+	z, ok := s.zones.Lookup(pos.Lat, pos.Lon)
+	if !ok {
+		return "", errOutsideZones
+	}
+	return z.ID, nil
+}
+
+// endZone returns the zone a ride ends in, rides can end outside of zones.
+func (s *Server) endZone(pos *db.Position) string {
+	if s.zones == nil || pos == nil {
+		return ""
+	}
+	if z, ok := s.zones.Lookup(pos.Lat, pos.Lon); ok {
+		return z.ID
+	}
+	return ""
+}
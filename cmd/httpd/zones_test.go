@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/353solutions/unter/geo"
+)
+
+func fp(v float64) *float64 { return &v }
+
+var startZoneCases = []struct {
+	name     string
+	lat, lon *float64
+	zone     string
+	err      error
+}{
+	{"city", fp(32.05), fp(34.76), "tlv", nil},
+	{"port", fp(32.095), fp(34.775), "tlv-port", nil},
+	{"outside", fp(40.71), fp(-74.0), "", errOutsideZones},
+	{"missing", nil, nil, "", errMissingLocation},
+	{"partial", fp(32.05), nil, "", errBadLocation},
+	{"bad", fp(132.05), fp(34.76), "", errBadLocation},
+}
+
+func TestStartZone(t *testing.T) {
+	zones, err := geo.LoadZones("../../geo/testdata/zones.geojson")
+	require.NoError(t, err)
+	s := Server{zones: zones}
+
+	for _, tc := range startZoneCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pos, err := ridePosition(tc.lat, tc.lon)
+			if err == nil {
+				var zone string
+				zone, err = s.startZone(pos)
+				require.Equal(t, tc.zone, zone)
+			}
+			require.ErrorIs(t, err, tc.err)
+		})
+	}
+
+	// No zones, location is optional
+	var noZones Server
+	zone, err := noZones.startZone(nil)
+	require.NoError(t, err)
+	require.Empty(t, zone)
+}
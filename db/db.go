@@ -27,7 +27,9 @@ import (
 	"errors"
 	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
+
+	"github.com/353solutions/unter/trace"
 )
 
 var (
@@ -39,6 +41,9 @@ var (
 
 	//go:embed sql/update.sql
 	updateSQL string
+
+	//go:embed sql/check.sql
+	checkRidesSQL string
 )
 
 type DB struct {
@@ -65,44 +70,167 @@ func (db *DB) Close() error {
 }
 
 func (db *DB) Health(ctx context.Context) error {
-	return db.conn.PingContext(ctx)
-	// TODO: Run run actual query (such as "SELECT 1")
+	var n int
+	return db.conn.QueryRowContext(ctx, "SELECT 1").Scan(&n)
+}
+
+// CheckRides checks that the rides table is accessible.
+func (db *DB) CheckRides(ctx context.Context) error {
+	ctx, span := startSpan(ctx, "check", checkRidesSQL)
+	defer span.Finish()
+
+	var n int
+	err := db.conn.QueryRowContext(ctx, checkRidesSQL).Scan(&n)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil // empty table is fine
+	}
+	span.SetError(err)
+	return err
 }
 
 type Ride struct {
 	ID     string
 	Driver string
+	CarID  string
 	Kind   string
 	Start  time.Time
 	End    time.Time
 	// End      sql.NullTime
-	Distance float64
+	Distance  float64
+	Cancelled bool
+	// ReportedDistance is the distance reported by the driver, Distance is
+	// computed from GPS locations when there are enough.
+	ReportedDistance float64
+	DistanceFlag     string // why distance needs review, "" if it doesn't
+
+	StartPos  *Position // nil if unknown
+	StartZone string
+	EndPos    *Position
+	EndZone   string
+
+	Riders []string // rider logins, riders are added but never removed
+	Legs   []Leg    // shared rides, added or updated but never removed
+
+	Fare        int    // ¢, set when the ride ends
+	FareDetails []byte // JSON fare breakdown, nil if not priced
+	QuoteID     string // fare estimate, "" if none
+}
+
+type Position struct {
+	Lat float64
+	Lon float64
+}
+
+// posArgs returns SQL arguments for p, NULL if it's nil.
+func posArgs(p *Position) (any, any) {
+	if p == nil {
+		return nil, nil
+	}
+	return p.Lat, p.Lon
+}
+
+func scanPos(lat, lon sql.NullFloat64) *Position {
+	if !lat.Valid || !lon.Valid {
+		return nil
+	}
+	return &Position{lat.Float64, lon.Float64}
+}
+
+// startSpan starts a span for an SQL statement.
+func startSpan(ctx context.Context, name, query string) (context.Context, *trace.Span) {
+	ctx, span := trace.Start(ctx, "sql."+name, trace.Client)
+	span.SetAttr("db.system", "postgresql")
+	span.SetAttr("db.statement", query)
+	return ctx, span
 }
 
-func (db *DB) Add(ctx context.Context, r Ride) error {
-	_, err := db.conn.ExecContext(ctx, insertSQL,
-		r.ID, r.Driver, r.Kind, r.Start, r.End, r.Distance)
+// Add inserts a ride, events are added to the outbox in the same transaction.
+func (db *DB) Add(ctx context.Context, r Ride, events ...OutboxEvent) error {
+	ctx, span := startSpan(ctx, "insert", insertSQL)
+	defer span.Finish()
+
+	startLat, startLon := posArgs(r.StartPos)
+	err := db.inTx(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, insertSQL,
+			r.ID, r.Driver, r.Kind, r.Start, r.End, r.Distance,
+			startLat, startLon, r.StartZone, r.CarID, r.QuoteID)
+		if err != nil {
+			return err
+		}
+		if err := addRideRiders(ctx, tx, r.ID, r.Riders); err != nil {
+			return err
+		}
+		if err := upsertLegs(ctx, tx, r.ID, r.Legs); err != nil {
+			return err
+		}
+		return addOutbox(ctx, tx, events)
+	})
+	span.SetError(err)
 	return err
 }
 
 var ErrNotFound = errors.New("not found")
 
 func (db *DB) Get(ctx context.Context, id string) (Ride, error) {
+	ctx, span := startSpan(ctx, "get", getSQL)
+	defer span.Finish()
+
 	r := db.conn.QueryRowContext(ctx, getSQL, id)
 	var rd Ride
-	err := r.Scan(&rd.ID, &rd.Driver, &rd.Kind, &rd.Start, &rd.End, &rd.Distance)
+	var startLat, startLon, endLat, endLon sql.NullFloat64
+	err := r.Scan(&rd.ID, &rd.Driver, &rd.Kind, &rd.Start, &rd.End, &rd.Distance, &rd.Cancelled,
+		&rd.ReportedDistance, &rd.DistanceFlag,
+		&startLat, &startLon, &rd.StartZone, &endLat, &endLon, &rd.EndZone, &rd.CarID,
+		&rd.Fare, &rd.FareDetails, &rd.QuoteID,
+		pq.Array(&rd.Riders))
+	if !errors.Is(err, sql.ErrNoRows) {
+		span.SetError(err)
+	}
 	switch {
 	case errors.Is(err, sql.ErrNoRows):
 		return Ride{}, ErrNotFound
 	case err != nil:
 		return Ride{}, err
 	}
+	rd.StartPos, rd.EndPos = scanPos(startLat, startLon), scanPos(endLat, endLon)
+
+	rd.Legs, err = db.Legs(ctx, id)
+	if err != nil {
+		return Ride{}, err
+	}
 
 	return rd, nil
 }
 
-func (db *DB) Update(ctx context.Context, r Ride) error {
-	_, err := db.conn.ExecContext(ctx, updateSQL,
-		r.ID, r.Driver, r.Kind, r.Start, r.End, r.Distance)
+// Update updates a ride, events are added to the outbox in the same
+// transaction.
+func (db *DB) Update(ctx context.Context, r Ride, events ...OutboxEvent) error {
+	ctx, span := startSpan(ctx, "update", updateSQL)
+	defer span.Finish()
+
+	err := db.inTx(ctx, func(tx *sql.Tx) error {
+		if err := updateRide(ctx, tx, r); err != nil {
+			return err
+		}
+		return addOutbox(ctx, tx, events)
+	})
+	span.SetError(err)
 	return err
 }
+
+func updateRide(ctx context.Context, tx *sql.Tx, r Ride) error {
+	startLat, startLon := posArgs(r.StartPos)
+	endLat, endLon := posArgs(r.EndPos)
+	_, err := tx.ExecContext(ctx, updateSQL,
+		r.ID, r.Driver, r.Kind, r.Start, r.End, r.Distance, r.Cancelled,
+		r.ReportedDistance, r.DistanceFlag,
+		startLat, startLon, r.StartZone, endLat, endLon, r.EndZone, r.CarID,
+		r.Fare, r.FareDetails, r.QuoteID)
+	if err != nil {
+		return err
+	}
+	if err := addRideRiders(ctx, tx, r.ID, r.Riders); err != nil {
+		return err
+	}
+	return upsertLegs(ctx, tx, r.ID, r.Legs)
+}
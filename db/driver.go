@@ -0,0 +1,106 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+	"errors"
+	"time"
+)
+
+var (
+	//go:embed sql/driver_insert.sql
+	driverInsertSQL string
+
+	//go:embed sql/driver_get.sql
+	driverGetSQL string
+
+	//go:embed sql/driver_state.sql
+	driverStateSQL string
+
+	//go:embed sql/driver_heartbeat.sql
+	driverHeartbeatSQL string
+
+	//go:embed sql/driver_availability.sql
+	driverAvailabilitySQL string
+)
+
+type Driver struct {
+	Login          string
+	Name           string
+	Phone          string
+	LicenseNumber  string
+	LicenseExpires time.Time
+	Vehicle        string
+	State          string
+	Availability   string
+	LastSeen       time.Time // zero if never seen
+	Pos            *Position // last known position
+	ReviewSince    time.Time // zero if not flagged for review
+	Created        time.Time
+}
+
+func (db *DB) AddDriver(ctx context.Context, d Driver) error {
+	ctx, span := startSpan(ctx, "driver.insert", driverInsertSQL)
+	defer span.Finish()
+
+	_, err := db.conn.ExecContext(ctx, driverInsertSQL,
+		d.Login, d.Name, d.Phone, d.LicenseNumber, d.LicenseExpires, d.Vehicle,
+		d.State, d.Availability, d.Created)
+	span.SetError(err)
+	return err
+}
+
+func (db *DB) Driver(ctx context.Context, login string) (Driver, error) {
+	ctx, span := startSpan(ctx, "driver.get", driverGetSQL)
+	defer span.Finish()
+
+	var d Driver
+	var lastSeen, review sql.NullTime
+	var lat, lon sql.NullFloat64
+	err := db.conn.QueryRowContext(ctx, driverGetSQL, login).Scan(
+		&d.Login, &d.Name, &d.Phone, &d.LicenseNumber, &d.LicenseExpires, &d.Vehicle,
+		&d.State, &d.Availability, &lastSeen, &lat, &lon, &review)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return Driver{}, ErrNotFound
+	case err != nil:
+		span.SetError(err)
+		return Driver{}, err
+	}
+	d.LastSeen = lastSeen.Time
+	d.ReviewSince = review.Time
+	d.Pos = scanPos(lat, lon)
+
+	return d, nil
+}
+
+// exec runs a single row update, it returns ErrNotFound if no row changed.
+func (db *DB) exec(ctx context.Context, name, query string, args ...any) error {
+	ctx, span := startSpan(ctx, name, query)
+	defer span.Finish()
+
+	res, err := db.conn.ExecContext(ctx, query, args...)
+	if err != nil {
+		span.SetError(err)
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (db *DB) SetDriverState(ctx context.Context, login, state string) error {
+	return db.exec(ctx, "driver.state", driverStateSQL, login, state)
+}
+
+// DriverHeartbeat records driver availability, pos can be nil.
+func (db *DB) DriverHeartbeat(ctx context.Context, login, availability string, t time.Time, pos *Position) error {
+	lat, lon := posArgs(pos)
+	return db.exec(ctx, "driver.heartbeat", driverHeartbeatSQL, login, availability, t, lat, lon)
+}
+
+func (db *DB) SetDriverAvailability(ctx context.Context, login, availability string) error {
+	return db.exec(ctx, "driver.availability", driverAvailabilitySQL, login, availability)
+}
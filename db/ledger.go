@@ -0,0 +1,186 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	//go:embed sql/journal_entry_insert.sql
+	journalEntryInsertSQL string
+
+	//go:embed sql/journal_posting_insert.sql
+	journalPostingInsertSQL string
+
+	//go:embed sql/journal_entry_get.sql
+	journalEntryGetSQL string
+
+	//go:embed sql/journal_postings_get.sql
+	journalPostingsGetSQL string
+
+	//go:embed sql/account_balance.sql
+	accountBalanceSQL string
+
+	//go:embed sql/account_lock.sql
+	accountLockSQL string
+)
+
+// ErrNoBalance is returned when a payout is more than the account balance.
+var ErrNoBalance = errors.New("insufficient balance")
+
+type JournalPosting struct {
+	Account string
+	Amount  int
+}
+
+// JournalEntry is a ledger entry, the schema rejects unbalanced entries,
+// updates and deletes.
+type JournalEntry struct {
+	ID       string
+	Memo     string
+	Time     time.Time
+	Reverses string
+	Postings []JournalPosting
+}
+
+// AddJournalEntry inserts an entry, it returns ErrExists if the ID exists.
+func (db *DB) AddJournalEntry(ctx context.Context, e JournalEntry) error {
+	ctx, span := startSpan(ctx, "journal.insert", journalEntryInsertSQL)
+	defer span.Finish()
+
+	err := db.inTx(ctx, func(tx *sql.Tx) error {
+		return addJournalEntry(ctx, tx, e)
+	})
+	if !errors.Is(err, ErrExists) {
+		span.SetError(err)
+	}
+	return err
+}
+
+// AddPayout inserts payout e to account if it doesn't make the account balance
+// (as of e.Time) positive, it returns ErrNoBalance otherwise. Payouts to the
+// same account are serialized with an advisory lock.
+func (db *DB) AddPayout(ctx context.Context, e JournalEntry, account string) error {
+	ctx, span := startSpan(ctx, "journal.payout", journalEntryInsertSQL)
+	defer span.Finish()
+
+	err := db.inTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, accountLockSQL, account); err != nil {
+			return fmt.Errorf("lock %s: %w", account, err)
+		}
+		var balance int
+		if err := tx.QueryRowContext(ctx, accountBalanceSQL, account, e.Time).Scan(&balance); err != nil {
+			return fmt.Errorf("balance %s: %w", account, err)
+		}
+		for _, p := range e.Postings {
+			if p.Account == account {
+				balance += p.Amount
+			}
+		}
+		if balance > 0 {
+			return fmt.Errorf("%s: %w", account, ErrNoBalance)
+		}
+		return addJournalEntry(ctx, tx, e)
+	})
+	if !errors.Is(err, ErrExists) && !errors.Is(err, ErrNoBalance) {
+		span.SetError(err)
+	}
+	return err
+}
+
+func addJournalEntry(ctx context.Context, tx *sql.Tx, e JournalEntry) error {
+	res, err := tx.ExecContext(ctx, journalEntryInsertSQL, e.ID, e.Memo, e.Time, e.Reverses)
+	if err != nil {
+		return fmt.Errorf("journal %s: %w", e.ID, err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("journal %s: %w", e.ID, ErrExists)
+	}
+
+	for i, p := range e.Postings {
+		if _, err := tx.ExecContext(ctx, journalPostingInsertSQL, e.ID, i, p.Account, p.Amount); err != nil {
+			return fmt.Errorf("journal %s posting %d: %w", e.ID, i, err)
+		}
+	}
+	return nil
+}
+
+func (db *DB) JournalEntry(ctx context.Context, id string) (JournalEntry, error) {
+	ctx, span := startSpan(ctx, "journal.get", journalEntryGetSQL)
+	defer span.Finish()
+
+	var e JournalEntry
+	err := db.conn.QueryRowContext(ctx, journalEntryGetSQL, id).Scan(&e.ID, &e.Memo, &e.Time, &e.Reverses)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return JournalEntry{}, ErrNotFound
+	case err != nil:
+		span.SetError(err)
+		return JournalEntry{}, err
+	}
+
+	rows, err := db.conn.QueryContext(ctx, journalPostingsGetSQL, id)
+	if err != nil {
+		span.SetError(err)
+		return JournalEntry{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p JournalPosting
+		if err := rows.Scan(&p.Account, &p.Amount); err != nil {
+			span.SetError(err)
+			return JournalEntry{}, err
+		}
+		e.Postings = append(e.Postings, p)
+	}
+	if err := rows.Err(); err != nil {
+		span.SetError(err)
+		return JournalEntry{}, err
+	}
+
+	return e, nil
+}
+
+// AccountBalance returns the sum of account postings in entries with time <=
+// asOf.
+func (db *DB) AccountBalance(ctx context.Context, account string, asOf time.Time) (int, error) {
+	ctx, span := startSpan(ctx, "account.balance", accountBalanceSQL)
+	defer span.Finish()
+
+	var n int
+	err := db.conn.QueryRowContext(ctx, accountBalanceSQL, account, asOf).Scan(&n)
+	span.SetError(err)
+	return n, err
+}
+
+// EndRide updates an ended ride and posts its journal entries in one
+// transaction, events are added to the outbox. If quoteID isn't "" it's marked
+// used by the ride, EndRide returns ErrQuoteUsed if another ride used it.
+func (db *DB) EndRide(ctx context.Context, r Ride, quoteID string, entries []JournalEntry, events ...OutboxEvent) error {
+	ctx, span := startSpan(ctx, "ride.end", updateSQL)
+	defer span.Finish()
+
+	err := db.inTx(ctx, func(tx *sql.Tx) error {
+		if err := updateRide(ctx, tx, r); err != nil {
+			return err
+		}
+		if quoteID != "" {
+			if err := useQuote(ctx, tx, quoteID, r.ID, r.End); err != nil {
+				return err
+			}
+		}
+		for _, e := range entries {
+			if err := addJournalEntry(ctx, tx, e); err != nil {
+				return err
+			}
+		}
+		return addOutbox(ctx, tx, events)
+	})
+	span.SetError(err)
+	return err
+}
@@ -0,0 +1,73 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+	"time"
+)
+
+var (
+	//go:embed sql/leg_upsert.sql
+	legUpsertSQL string
+
+	//go:embed sql/leg_list.sql
+	legListSQL string
+)
+
+// Leg is a rider's part of a shared ride.
+type Leg struct {
+	Rider    string
+	Pickup   time.Time
+	Dropoff  time.Time // zero while the rider is on board
+	Distance float64
+	Fare     int // ¢, set when the ride ends
+}
+
+// nullTime returns NULL for the zero time.
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+// upsertLegs adds or updates ride legs, the leg riders are linked to the
+// ride.
+func upsertLegs(ctx context.Context, tx *sql.Tx, rideID string, legs []Leg) error {
+	for _, l := range legs {
+		if err := addRideRiders(ctx, tx, rideID, []string{l.Rider}); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, legUpsertSQL,
+			rideID, l.Rider, l.Pickup, nullTime(l.Dropoff), l.Distance, l.Fare)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Legs returns ride legs ordered by pickup time.
+func (db *DB) Legs(ctx context.Context, rideID string) ([]Leg, error) {
+	ctx, span := startSpan(ctx, "leg.list", legListSQL)
+	defer span.Finish()
+
+	rows, err := db.conn.QueryContext(ctx, legListSQL, rideID)
+	if err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var legs []Leg
+	for rows.Next() {
+		var l Leg
+		var dropoff sql.NullTime
+		if err := rows.Scan(&l.Rider, &l.Pickup, &dropoff, &l.Distance, &l.Fare); err != nil {
+			span.SetError(err)
+			return nil, err
+		}
+		l.Dropoff = dropoff.Time
+		legs = append(legs, l)
+	}
+	span.SetError(rows.Err())
+	return legs, rows.Err()
+}
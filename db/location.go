@@ -0,0 +1,70 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+	"time"
+)
+
+var (
+	//go:embed sql/location_insert.sql
+	locationInsertSQL string
+
+	//go:embed sql/location_list.sql
+	locationListSQL string
+)
+
+type Location struct {
+	Lat  float64
+	Lon  float64
+	Time time.Time
+}
+
+// AddLocations adds a batch of ride locations in one transaction.
+func (db *DB) AddLocations(ctx context.Context, rideID string, locs []Location) error {
+	ctx, span := startSpan(ctx, "location.insert", locationInsertSQL)
+	defer span.Finish()
+
+	err := db.inTx(ctx, func(tx *sql.Tx) error {
+		stmt, err := tx.PrepareContext(ctx, locationInsertSQL)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		for _, l := range locs {
+			if _, err := stmt.ExecContext(ctx, rideID, l.Time, l.Lat, l.Lon); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	span.SetError(err)
+	return err
+}
+
+// Locations returns ride locations ordered by time.
+func (db *DB) Locations(ctx context.Context, rideID string) ([]Location, error) {
+	ctx, span := startSpan(ctx, "location.list", locationListSQL)
+	defer span.Finish()
+
+	rows, err := db.conn.QueryContext(ctx, locationListSQL, rideID)
+	if err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var locs []Location
+	for rows.Next() {
+		var l Location
+		if err := rows.Scan(&l.Time, &l.Lat, &l.Lon); err != nil {
+			span.SetError(err)
+			return nil, err
+		}
+		locs = append(locs, l)
+	}
+	span.SetError(rows.Err())
+	return locs, rows.Err()
+}
@@ -0,0 +1,149 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var (
+	//go:embed sql/outbox_insert.sql
+	outboxInsertSQL string
+
+	//go:embed sql/outbox_claim.sql
+	outboxClaimSQL string
+
+	//go:embed sql/outbox_published.sql
+	outboxPublishedSQL string
+
+	//go:embed sql/outbox_failed.sql
+	outboxFailedSQL string
+
+	//go:embed sql/outbox_purge.sql
+	outboxPurgeSQL string
+
+	//go:embed sql/outbox_dead.sql
+	outboxDeadSQL string
+
+	//go:embed sql/outbox_revive.sql
+	outboxReviveSQL string
+)
+
+// OutboxEvent is an event written in the same transaction as a ride change.
+type OutboxEvent struct {
+	ID       int64 // set by the database
+	DedupID  string
+	Type     string
+	Payload  []byte
+	Created  time.Time
+	Attempts int
+	Sent     []string // sinks that accepted the event
+}
+
+// inTx runs fn in a transaction, it's committed if fn returns nil.
+func (db *DB) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		tx.Rollback() //#nosec G104 - returning the original error
+		return err
+	}
+	return tx.Commit()
+}
+
+func addOutbox(ctx context.Context, tx *sql.Tx, events []OutboxEvent) error {
+	for _, e := range events {
+		if _, err := tx.ExecContext(ctx, outboxInsertSQL, e.DedupID, e.Type, e.Payload, e.Created); err != nil {
+			return fmt.Errorf("outbox %s: %w", e.DedupID, err)
+		}
+	}
+	return nil
+}
+
+// ClaimOutbox returns up to limit unpublished live events due at now, and moves
+// their next attempt to now+lease.
+func (db *DB) ClaimOutbox(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]OutboxEvent, error) {
+	ctx, span := startSpan(ctx, "outbox.claim", outboxClaimSQL)
+	defer span.Finish()
+
+	rows, err := db.conn.QueryContext(ctx, outboxClaimSQL, now, now.Add(lease), limit)
+	if err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []OutboxEvent
+	for rows.Next() {
+		var e OutboxEvent
+		if err := rows.Scan(&e.ID, &e.DedupID, &e.Type, &e.Payload, &e.Created, &e.Attempts, pq.Array(&e.Sent)); err != nil {
+			span.SetError(err)
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	span.SetError(rows.Err())
+	return events, rows.Err()
+}
+
+func (db *DB) MarkOutboxPublished(ctx context.Context, id int64, t time.Time) error {
+	ctx, span := startSpan(ctx, "outbox.published", outboxPublishedSQL)
+	defer span.Finish()
+
+	_, err := db.conn.ExecContext(ctx, outboxPublishedSQL, id, t)
+	span.SetError(err)
+	return err
+}
+
+func (db *DB) MarkOutboxFailed(ctx context.Context, id int64, sent []string, reason string, next time.Time) error {
+	ctx, span := startSpan(ctx, "outbox.failed", outboxFailedSQL)
+	defer span.Finish()
+
+	_, err := db.conn.ExecContext(ctx, outboxFailedSQL, id, reason, next, pq.Array(nonNil(sent)))
+	span.SetError(err)
+	return err
+}
+
+// MarkOutboxDead records the last failed attempt, dead events aren't claimed.
+func (db *DB) MarkOutboxDead(ctx context.Context, id int64, sent []string, reason string, t time.Time) error {
+	ctx, span := startSpan(ctx, "outbox.dead", outboxDeadSQL)
+	defer span.Finish()
+
+	_, err := db.conn.ExecContext(ctx, outboxDeadSQL, id, reason, pq.Array(nonNil(sent)), t)
+	span.SetError(err)
+	return err
+}
+
+// ReviveOutbox makes a dead event due at now, it returns ErrNotFound if
+// there's no dead event with id.
+func (db *DB) ReviveOutbox(ctx context.Context, id int64, now time.Time) error {
+	return db.exec(ctx, "outbox.revive", outboxReviveSQL, id, now)
+}
+
+// nonNil returns an empty slice for nil, NOT NULL array columns.
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
+// PurgeOutbox deletes events published before t.
+func (db *DB) PurgeOutbox(ctx context.Context, before time.Time) (int64, error) {
+	ctx, span := startSpan(ctx, "outbox.purge", outboxPurgeSQL)
+	defer span.Finish()
+
+	res, err := db.conn.ExecContext(ctx, outboxPurgeSQL, before)
+	if err != nil {
+		span.SetError(err)
+		return 0, err
+	}
+	return res.RowsAffected()
+}
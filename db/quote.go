@@ -0,0 +1,107 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	//go:embed sql/quote_insert.sql
+	quoteInsertSQL string
+
+	//go:embed sql/quote_get.sql
+	quoteGetSQL string
+
+	//go:embed sql/ride_speeds.sql
+	rideSpeedsSQL string
+
+	//go:embed sql/quote_use.sql
+	quoteUseSQL string
+)
+
+type Quote struct {
+	ID       string
+	Rider    string
+	Kind     string
+	From     Position
+	To       Position
+	Distance float64
+	Duration time.Duration
+	Low      int
+	High     int
+	Created  time.Time
+	Expires  time.Time
+	RideID   string // "" until used
+}
+
+func (db *DB) AddQuote(ctx context.Context, q Quote) error {
+	ctx, span := startSpan(ctx, "quote.insert", quoteInsertSQL)
+	defer span.Finish()
+
+	_, err := db.conn.ExecContext(ctx, quoteInsertSQL,
+		q.ID, q.Rider, q.Kind, q.From.Lat, q.From.Lon, q.To.Lat, q.To.Lon,
+		q.Distance, q.Duration.Seconds(), q.Low, q.High, q.Created, q.Expires)
+	span.SetError(err)
+	return err
+}
+
+func (db *DB) Quote(ctx context.Context, id string) (Quote, error) {
+	ctx, span := startSpan(ctx, "quote.get", quoteGetSQL)
+	defer span.Finish()
+
+	var q Quote
+	var duration float64
+	err := db.conn.QueryRowContext(ctx, quoteGetSQL, id).Scan(
+		&q.ID, &q.Rider, &q.Kind, &q.From.Lat, &q.From.Lon, &q.To.Lat, &q.To.Lon,
+		&q.Distance, &duration, &q.Low, &q.High, &q.Created, &q.Expires, &q.RideID)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return Quote{}, ErrNotFound
+	case err != nil:
+		span.SetError(err)
+		return Quote{}, err
+	}
+	q.Duration = time.Duration(duration * float64(time.Second))
+
+	return q, nil
+}
+
+// ErrQuoteUsed is returned when another ride used the quote.
+var ErrQuoteUsed = errors.New("quote used by another ride")
+
+// useQuote marks quote id used by ride rideID at t.
+func useQuote(ctx context.Context, tx *sql.Tx, id, rideID string, t time.Time) error {
+	res, err := tx.ExecContext(ctx, quoteUseSQL, id, rideID, t)
+	if err != nil {
+		return fmt.Errorf("quote %s: %w", id, err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("quote %s: %w", id, ErrQuoteUsed)
+	}
+	return nil
+}
+
+// Speeds are ride speed (mph) percentiles.
+type Speeds struct {
+	Count  int
+	P25    float64
+	Median float64
+	P75    float64
+}
+
+// RideSpeeds returns the speeds of rides since with distance in [minDist,
+// maxDist] that started within an hour (UTC) of hour.
+func (db *DB) RideSpeeds(ctx context.Context, minDist, maxDist float64, since time.Time, hour int) (Speeds, error) {
+	ctx, span := startSpan(ctx, "ride.speeds", rideSpeedsSQL)
+	defer span.Finish()
+
+	var s Speeds
+	err := db.conn.QueryRowContext(ctx, rideSpeedsSQL, minDist, maxDist, since, hour).Scan(
+		&s.Count, &s.P25, &s.Median, &s.P75)
+	span.SetError(err)
+	return s, err
+}
@@ -0,0 +1,127 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var (
+	//go:embed sql/rating_insert.sql
+	ratingInsertSQL string
+
+	//go:embed sql/rating_driver.sql
+	ratingDriverSQL string
+
+	//go:embed sql/driver_rides_count.sql
+	driverRidesCountSQL string
+
+	//go:embed sql/driver_review.sql
+	driverReviewSQL string
+
+	//go:embed sql/driver_review_list.sql
+	driverReviewListSQL string
+)
+
+var ErrExists = errors.New("already exists")
+
+type Rating struct {
+	RideID  string
+	Rater   string
+	Ratee   string
+	ByRider bool
+	Stars   int
+	Tags    []string
+	Comment string
+	Created time.Time
+}
+
+// AddRating inserts a rating, it returns ErrExists if the rater already rated
+// the ratee on the ride.
+func (db *DB) AddRating(ctx context.Context, r Rating) error {
+	tags := r.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	err := db.exec(ctx, "rating.insert", ratingInsertSQL,
+		r.RideID, r.Rater, r.Ratee, r.ByRider, r.Stars, pq.Array(tags), r.Comment, r.Created)
+	if errors.Is(err, ErrNotFound) {
+		return ErrExists
+	}
+	return err
+}
+
+// DriverStars returns the stars of the last limit rider ratings of a driver,
+// newest first.
+func (db *DB) DriverStars(ctx context.Context, login string, limit int) ([]int, error) {
+	ctx, span := startSpan(ctx, "rating.driver", ratingDriverSQL)
+	defer span.Finish()
+
+	rows, err := db.conn.QueryContext(ctx, ratingDriverSQL, login, limit)
+	if err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stars []int
+	for rows.Next() {
+		var n int
+		if err := rows.Scan(&n); err != nil {
+			span.SetError(err)
+			return nil, err
+		}
+		stars = append(stars, n)
+	}
+	span.SetError(rows.Err())
+	return stars, rows.Err()
+}
+
+// DriverRides returns the number of completed rides of a driver.
+func (db *DB) DriverRides(ctx context.Context, login string) (int, error) {
+	ctx, span := startSpan(ctx, "driver.rides", driverRidesCountSQL)
+	defer span.Finish()
+
+	var n int
+	err := db.conn.QueryRowContext(ctx, driverRidesCountSQL, login).Scan(&n)
+	span.SetError(err)
+	return n, err
+}
+
+// SetDriverReview flags or clears a driver for review, an existing flag keeps
+// its original time.
+func (db *DB) SetDriverReview(ctx context.Context, login string, review bool, t time.Time) error {
+	return db.exec(ctx, "driver.review", driverReviewSQL, login, review, t)
+}
+
+// DriversForReview returns drivers flagged for review, oldest flag first.
+// Only Login, Name and ReviewSince are set.
+func (db *DB) DriversForReview(ctx context.Context) ([]Driver, error) {
+	ctx, span := startSpan(ctx, "driver.review_list", driverReviewListSQL)
+	defer span.Finish()
+
+	rows, err := db.conn.QueryContext(ctx, driverReviewListSQL)
+	if err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var drivers []Driver
+	for rows.Next() {
+		var d Driver
+		var since sql.NullTime
+		if err := rows.Scan(&d.Login, &d.Name, &since); err != nil {
+			span.SetError(err)
+			return nil, err
+		}
+		d.ReviewSince = since.Time
+		drivers = append(drivers, d)
+	}
+	span.SetError(rows.Err())
+	return drivers, rows.Err()
+}
@@ -0,0 +1,117 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+	"errors"
+	"time"
+)
+
+var (
+	//go:embed sql/rider_insert.sql
+	riderInsertSQL string
+
+	//go:embed sql/rider_get.sql
+	riderGetSQL string
+
+	//go:embed sql/rider_password.sql
+	riderPasswordSQL string
+
+	//go:embed sql/ride_rider_insert.sql
+	rideRiderInsertSQL string
+
+	//go:embed sql/rider_rides.sql
+	riderRidesSQL string
+)
+
+type Rider struct {
+	Login   string
+	Name    string
+	Email   string
+	Phone   string
+	Created time.Time
+}
+
+// AddRider inserts a rider with a password hash ("" for no password login), it
+// returns ErrExists if the login exists.
+func (db *DB) AddRider(ctx context.Context, r Rider, passwordHash string) error {
+	err := db.exec(ctx, "rider.insert", riderInsertSQL, r.Login, r.Name, r.Email, r.Phone, r.Created, passwordHash)
+	if errors.Is(err, ErrNotFound) {
+		return ErrExists
+	}
+	return err
+}
+
+// RiderPassword returns the rider password hash.
+func (db *DB) RiderPassword(ctx context.Context, login string) (string, error) {
+	ctx, span := startSpan(ctx, "rider.password", riderPasswordSQL)
+	defer span.Finish()
+
+	var hash string
+	err := db.conn.QueryRowContext(ctx, riderPasswordSQL, login).Scan(&hash)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return "", ErrNotFound
+	case err != nil:
+		span.SetError(err)
+		return "", err
+	}
+
+	return hash, nil
+}
+
+func (db *DB) Rider(ctx context.Context, login string) (Rider, error) {
+	ctx, span := startSpan(ctx, "rider.get", riderGetSQL)
+	defer span.Finish()
+
+	var r Rider
+	err := db.conn.QueryRowContext(ctx, riderGetSQL, login).Scan(&r.Login, &r.Name, &r.Email, &r.Phone, &r.Created)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return Rider{}, ErrNotFound
+	case err != nil:
+		span.SetError(err)
+		return Rider{}, err
+	}
+
+	return r, nil
+}
+
+// addRideRiders links riders to a ride, riders already linked are skipped.
+func addRideRiders(ctx context.Context, tx *sql.Tx, rideID string, riders []string) error {
+	for _, login := range riders {
+		if _, err := tx.ExecContext(ctx, rideRiderInsertSQL, rideID, login); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RiderRides returns the last limit rides of a rider, newest first. Only
+// summary fields are set.
+func (db *DB) RiderRides(ctx context.Context, login string, limit int) ([]Ride, error) {
+	ctx, span := startSpan(ctx, "rider.rides", riderRidesSQL)
+	defer span.Finish()
+
+	rows, err := db.conn.QueryContext(ctx, riderRidesSQL, login, limit)
+	if err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rides []Ride
+	for rows.Next() {
+		var rd Ride
+		err := rows.Scan(&rd.ID, &rd.Driver, &rd.Kind, &rd.Start, &rd.End, &rd.Distance, &rd.Cancelled,
+			&rd.StartZone, &rd.EndZone)
+		if err != nil {
+			span.SetError(err)
+			return nil, err
+		}
+		rides = append(rides, rd)
+	}
+	span.SetError(rows.Err())
+	return rides, rows.Err()
+}
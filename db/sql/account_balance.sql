@@ -0,0 +1,8 @@
+SELECT
+    COALESCE(sum(p.amount), 0)
+FROM journal_postings AS p
+JOIN journal_entries AS e ON e.id = p.entry_id
+WHERE
+    p.account = $1
+    AND e.time <= $2
+;
@@ -0,0 +1,2 @@
+-- Held until the end of the transaction
+SELECT pg_advisory_xact_lock(hashtext($1));
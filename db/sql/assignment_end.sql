@@ -0,0 +1,6 @@
+UPDATE vehicle_assignments
+SET end_time = $3
+WHERE
+    (driver = $1 OR vehicle_id = $2)
+    AND end_time IS NULL
+;
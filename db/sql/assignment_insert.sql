@@ -0,0 +1,6 @@
+INSERT INTO vehicle_assignments (
+    vehicle_id, driver, start_time
+) VALUES (
+    $1, $2, $3
+)
+;
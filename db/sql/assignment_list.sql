@@ -0,0 +1,6 @@
+SELECT
+    vehicle_id, driver, start_time, end_time
+FROM vehicle_assignments
+WHERE vehicle_id = $1
+ORDER BY start_time DESC
+;
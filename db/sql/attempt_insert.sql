@@ -0,0 +1,6 @@
+INSERT INTO webhook_attempts (
+    delivery_id, n, time, status_code, error, duration_ms
+) VALUES (
+    $1, $2, $3, $4, $5, $6
+)
+;
@@ -0,0 +1,5 @@
+SELECT delivery_id, n, time, status_code, error, duration_ms
+FROM webhook_attempts
+WHERE delivery_id = $1
+ORDER BY id
+;
@@ -0,0 +1,4 @@
+SELECT 1
+FROM rides
+LIMIT 1
+;
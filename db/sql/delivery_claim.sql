@@ -0,0 +1,18 @@
+-- SKIP LOCKED lets several replicas claim different deliveries
+UPDATE webhook_deliveries
+SET next_attempt = $2
+WHERE id IN (
+    SELECT id
+    FROM webhook_deliveries
+    WHERE
+        status = 'pending'
+        AND
+        next_attempt <= $1
+    ORDER BY next_attempt
+    LIMIT $3
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING
+    id, webhook_id, event_id, event_type, payload, status,
+    attempts, next_attempt, last_error, created, updated
+;
@@ -0,0 +1,6 @@
+SELECT
+    id, webhook_id, event_id, event_type, payload, status,
+    attempts, next_attempt, last_error, created, updated
+FROM webhook_deliveries
+WHERE id = $1
+;
@@ -0,0 +1,8 @@
+INSERT INTO webhook_deliveries (
+    id, webhook_id, event_id, event_type, payload, status,
+    attempts, next_attempt, last_error, created, updated
+) VALUES (
+    $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11
+)
+ON CONFLICT (id) DO NOTHING
+;
@@ -0,0 +1,11 @@
+SELECT
+    id, webhook_id, event_id, event_type, payload, status,
+    attempts, next_attempt, last_error, created, updated
+FROM webhook_deliveries
+WHERE
+    webhook_id = $1
+    AND
+    ($2::TEXT = '' OR status = $2)
+ORDER BY created DESC
+LIMIT $3
+;
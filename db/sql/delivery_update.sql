@@ -0,0 +1,10 @@
+UPDATE webhook_deliveries
+SET
+    status = $2,
+    attempts = $3,
+    next_attempt = $4,
+    last_error = $5,
+    updated = $6
+WHERE
+    id = $1
+;
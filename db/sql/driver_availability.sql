@@ -0,0 +1,4 @@
+UPDATE drivers
+SET availability = $2
+WHERE login = $1
+;
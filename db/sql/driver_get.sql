@@ -0,0 +1,6 @@
+SELECT
+    login, name, phone, license_number, license_expires, vehicle,
+    state, availability, last_seen, lat, lon, review_since
+FROM drivers
+WHERE login = $1
+;
@@ -0,0 +1,9 @@
+-- Keep the last position if the heartbeat has none
+UPDATE drivers
+SET
+    availability = $2,
+    last_seen = $3,
+    lat = COALESCE($4, lat),
+    lon = COALESCE($5, lon)
+WHERE login = $1
+;
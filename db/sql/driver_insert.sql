@@ -0,0 +1,7 @@
+INSERT INTO drivers (
+    login, name, phone, license_number, license_expires, vehicle,
+    state, availability, created
+) VALUES (
+    $1, $2, $3, $4, $5, $6, $7, $8, $9
+)
+;
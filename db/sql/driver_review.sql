@@ -0,0 +1,4 @@
+UPDATE drivers
+SET review_since = CASE WHEN $2 THEN COALESCE(review_since, $3) ELSE NULL END
+WHERE login = $1
+;
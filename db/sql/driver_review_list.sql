@@ -0,0 +1,5 @@
+SELECT login, name, review_since
+FROM drivers
+WHERE review_since IS NOT NULL
+ORDER BY review_since
+;
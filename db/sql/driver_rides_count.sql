@@ -0,0 +1,4 @@
+SELECT count(*)
+FROM rides
+WHERE driver = $1 AND NOT cancelled AND end_time > start_time
+;
@@ -0,0 +1,4 @@
+UPDATE drivers
+SET state = $2
+WHERE login = $1
+;
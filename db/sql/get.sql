@@ -1,4 +1,13 @@
-SELECT id, driver, kind, start_time, end_time, distance
+SELECT
+    id, driver, kind, start_time, end_time, distance, cancelled,
+    reported_distance, distance_flag,
+    start_lat, start_lon, start_zone, end_lat, end_lon, end_zone, car_id,
+    fare, fare_details, quote_id,
+    ARRAY(
+        SELECT rider_id FROM ride_riders
+        WHERE ride_id = rides.id
+        ORDER BY added, rider_id
+    ) AS riders
 FROM rides
 WHERE id = $1
 ;
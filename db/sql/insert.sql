@@ -1,6 +1,7 @@
 INSERT INTO rides (
-    id, driver, kind, start_time, end_time, distance
+    id, driver, kind, start_time, end_time, distance,
+    start_lat, start_lon, start_zone, car_id, quote_id
 ) VALUES (
-    $1, $2, $3, $4, $5, $6
+    $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11
 )
 ;
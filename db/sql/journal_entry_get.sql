@@ -0,0 +1,5 @@
+SELECT
+    id, memo, time, COALESCE(reverses, '')
+FROM journal_entries
+WHERE id = $1
+;
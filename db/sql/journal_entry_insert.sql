@@ -0,0 +1,7 @@
+INSERT INTO journal_entries (
+    id, memo, time, reverses
+) VALUES (
+    $1, $2, $3, NULLIF($4, '')
+)
+ON CONFLICT DO NOTHING
+;
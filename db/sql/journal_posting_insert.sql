@@ -0,0 +1,6 @@
+INSERT INTO journal_postings (
+    entry_id, n, account, amount
+) VALUES (
+    $1, $2, $3, $4
+)
+;
@@ -0,0 +1,6 @@
+SELECT
+    account, amount
+FROM journal_postings
+WHERE entry_id = $1
+ORDER BY n
+;
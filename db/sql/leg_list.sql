@@ -0,0 +1,6 @@
+SELECT
+    rider_id, pickup_time, dropoff_time, distance, fare
+FROM ride_legs
+WHERE ride_id = $1
+ORDER BY pickup_time, rider_id
+;
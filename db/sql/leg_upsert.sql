@@ -0,0 +1,12 @@
+INSERT INTO ride_legs (
+    ride_id, rider_id, pickup_time, dropoff_time, distance, fare
+) VALUES (
+    $1, $2, $3, $4, $5, $6
+)
+ON CONFLICT (ride_id, rider_id) DO UPDATE
+SET
+    pickup_time = EXCLUDED.pickup_time,
+    dropoff_time = EXCLUDED.dropoff_time,
+    distance = EXCLUDED.distance,
+    fare = EXCLUDED.fare
+;
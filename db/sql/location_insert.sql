@@ -0,0 +1,6 @@
+INSERT INTO locations (
+    ride_id, time, lat, lon
+) VALUES (
+    $1, $2, $3, $4
+)
+;
@@ -0,0 +1,5 @@
+SELECT time, lat, lon
+FROM locations
+WHERE ride_id = $1
+ORDER BY time
+;
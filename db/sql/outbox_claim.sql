@@ -0,0 +1,17 @@
+UPDATE outbox
+SET next_attempt = $2
+WHERE id IN (
+    SELECT id
+    FROM outbox
+    WHERE
+        published IS NULL
+        AND
+        dead IS NULL
+        AND
+        next_attempt <= $1
+    ORDER BY id
+    LIMIT $3
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING id, dedup_id, event_type, payload, created, attempts, sent
+;
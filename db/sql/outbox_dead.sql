@@ -0,0 +1,9 @@
+UPDATE outbox
+SET
+    attempts = attempts + 1,
+    last_error = $2,
+    sent = $3,
+    dead = $4
+WHERE
+    id = $1
+;
@@ -0,0 +1,9 @@
+UPDATE outbox
+SET
+    attempts = attempts + 1,
+    last_error = $2,
+    next_attempt = $3,
+    sent = $4
+WHERE
+    id = $1
+;
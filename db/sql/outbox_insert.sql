@@ -0,0 +1,8 @@
+-- Same dedup ID means same event (e.g. a retried request)
+INSERT INTO outbox (
+    dedup_id, event_type, payload, created, next_attempt
+) VALUES (
+    $1, $2, $3, $4, $4
+)
+ON CONFLICT (dedup_id) DO NOTHING
+;
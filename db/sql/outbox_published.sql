@@ -0,0 +1,8 @@
+UPDATE outbox
+SET
+    published = $2,
+    attempts = attempts + 1,
+    last_error = ''
+WHERE
+    id = $1
+;
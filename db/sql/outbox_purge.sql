@@ -0,0 +1,6 @@
+DELETE FROM outbox
+WHERE
+    published IS NOT NULL
+    AND
+    published < $1
+;
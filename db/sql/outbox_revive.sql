@@ -0,0 +1,10 @@
+UPDATE outbox
+SET
+    attempts = 0,
+    dead = NULL,
+    next_attempt = $2
+WHERE
+    id = $1
+    AND
+    dead IS NOT NULL
+;
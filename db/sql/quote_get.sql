@@ -0,0 +1,6 @@
+SELECT
+    id, rider, kind, from_lat, from_lon, to_lat, to_lon,
+    distance, duration, low, high, created, expires, ride_id
+FROM quotes
+WHERE id = $1
+;
@@ -0,0 +1,7 @@
+INSERT INTO quotes (
+    id, rider, kind, from_lat, from_lon, to_lat, to_lon,
+    distance, duration, low, high, created, expires
+) VALUES (
+    $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13
+)
+;
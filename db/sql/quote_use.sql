@@ -0,0 +1,10 @@
+-- A quote caps one ride, using it again for the same ride is OK
+UPDATE quotes
+SET
+    ride_id = $2,
+    used = COALESCE(used, $3)
+WHERE
+    id = $1
+    AND
+    ride_id IN ('', $2)
+;
@@ -0,0 +1,6 @@
+SELECT stars
+FROM ratings
+WHERE ratee = $1 AND by_rider
+ORDER BY created DESC
+LIMIT $2
+;
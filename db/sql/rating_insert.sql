@@ -0,0 +1,7 @@
+INSERT INTO ratings (
+    ride_id, rater, ratee, by_rider, stars, tags, comment, created
+) VALUES (
+    $1, $2, $3, $4, $5, $6, $7, $8
+)
+ON CONFLICT DO NOTHING
+;
@@ -0,0 +1,7 @@
+INSERT INTO ride_riders (
+    ride_id, rider_id
+) VALUES (
+    $1, $2
+)
+ON CONFLICT DO NOTHING
+;
@@ -0,0 +1,20 @@
+-- Speed (mph) percentiles of ended rides with distance in [$1, $2] that
+-- started since $3 within an hour of the day of hour $4
+SELECT
+    count(*),
+    COALESCE(percentile_cont(0.25) WITHIN GROUP (ORDER BY speed), 0),
+    COALESCE(percentile_cont(0.5) WITHIN GROUP (ORDER BY speed), 0),
+    COALESCE(percentile_cont(0.75) WITHIN GROUP (ORDER BY speed), 0)
+FROM (
+    SELECT
+        distance / (EXTRACT(EPOCH FROM end_time - start_time) / 3600) AS speed,
+        abs(EXTRACT(HOUR FROM start_time) - $4) AS hours
+    FROM rides
+    WHERE
+        NOT cancelled
+        AND end_time > start_time
+        AND distance BETWEEN $1 AND $2
+        AND start_time >= $3
+) r
+WHERE LEAST(hours, 24 - hours) <= 1
+;
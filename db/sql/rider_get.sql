@@ -0,0 +1,5 @@
+SELECT
+    login, name, email, phone, created
+FROM riders
+WHERE login = $1
+;
@@ -0,0 +1,7 @@
+INSERT INTO riders (
+    login, name, email, phone, created, password_hash
+) VALUES (
+    $1, $2, $3, $4, $5, $6
+)
+ON CONFLICT DO NOTHING
+;
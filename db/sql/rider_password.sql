@@ -0,0 +1,5 @@
+SELECT
+    password_hash
+FROM riders
+WHERE login = $1
+;
@@ -0,0 +1,9 @@
+SELECT
+    r.id, r.driver, r.kind, r.start_time, r.end_time, r.distance, r.cancelled,
+    r.start_zone, r.end_zone
+FROM rides r
+JOIN ride_riders rr ON rr.ride_id = r.id
+WHERE rr.rider_id = $1
+ORDER BY r.start_time DESC
+LIMIT $2
+;
@@ -4,9 +4,282 @@ CREATE TABLE IF NOT EXISTS rides (
     kind TEXT NOT NULL,
     start_time TIMESTAMP NOT NULL,
     end_time TIMESTAMP,
-    distance FLOAT
+    distance FLOAT,
+    cancelled BOOLEAN NOT NULL DEFAULT FALSE,
+    reported_distance FLOAT NOT NULL DEFAULT 0,
+    distance_flag TEXT NOT NULL DEFAULT '',
+    start_lat FLOAT,
+    start_lon FLOAT,
+    start_zone TEXT NOT NULL DEFAULT '',
+    end_lat FLOAT,
+    end_lon FLOAT,
+    end_zone TEXT NOT NULL DEFAULT '',
+    car_id TEXT NOT NULL DEFAULT '',
+    fare INTEGER NOT NULL DEFAULT 0,
+    fare_details BYTEA,
+    quote_id TEXT NOT NULL DEFAULT ''
 );
 
+-- Existing databases
+ALTER TABLE rides ADD COLUMN IF NOT EXISTS cancelled BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE rides ADD COLUMN IF NOT EXISTS reported_distance FLOAT NOT NULL DEFAULT 0;
+ALTER TABLE rides ADD COLUMN IF NOT EXISTS distance_flag TEXT NOT NULL DEFAULT '';
+ALTER TABLE rides ADD COLUMN IF NOT EXISTS start_lat FLOAT;
+ALTER TABLE rides ADD COLUMN IF NOT EXISTS start_lon FLOAT;
+ALTER TABLE rides ADD COLUMN IF NOT EXISTS start_zone TEXT NOT NULL DEFAULT '';
+ALTER TABLE rides ADD COLUMN IF NOT EXISTS end_lat FLOAT;
+ALTER TABLE rides ADD COLUMN IF NOT EXISTS end_lon FLOAT;
+ALTER TABLE rides ADD COLUMN IF NOT EXISTS end_zone TEXT NOT NULL DEFAULT '';
+ALTER TABLE rides ADD COLUMN IF NOT EXISTS car_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE rides ADD COLUMN IF NOT EXISTS fare INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE rides ADD COLUMN IF NOT EXISTS fare_details BYTEA;
+ALTER TABLE rides ADD COLUMN IF NOT EXISTS quote_id TEXT NOT NULL DEFAULT '';
+
 CREATE INDEX IF NOT EXISTS rides_start ON rides(start_time);
 CREATE INDEX IF NOT EXISTS rides_end ON rides(end_time);
+CREATE INDEX IF NOT EXISTS rides_start_zone ON rides(start_zone);
+
+CREATE TABLE IF NOT EXISTS webhooks (
+    id TEXT PRIMARY KEY,
+    url TEXT NOT NULL,
+    secret TEXT NOT NULL,
+    events TEXT[] NOT NULL DEFAULT '{}',
+    created TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id TEXT PRIMARY KEY,
+    webhook_id TEXT NOT NULL,
+    event_id BIGINT NOT NULL,
+    event_type TEXT NOT NULL,
+    payload BYTEA NOT NULL,
+    status TEXT NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt TIMESTAMP NOT NULL,
+    last_error TEXT NOT NULL DEFAULT '',
+    created TIMESTAMP NOT NULL,
+    updated TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_due ON webhook_deliveries(next_attempt) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS webhook_deliveries_webhook ON webhook_deliveries(webhook_id, created);
+
+CREATE TABLE IF NOT EXISTS webhook_attempts (
+    id SERIAL PRIMARY KEY,
+    delivery_id TEXT NOT NULL,
+    n INTEGER NOT NULL,
+    time TIMESTAMP NOT NULL,
+    status_code INTEGER NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT '',
+    duration_ms BIGINT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS webhook_attempts_delivery ON webhook_attempts(delivery_id);
+
+-- Transactional outbox, written with the change it describes
+CREATE TABLE IF NOT EXISTS outbox (
+    id BIGSERIAL PRIMARY KEY,
+    dedup_id TEXT NOT NULL UNIQUE,
+    event_type TEXT NOT NULL,
+    payload BYTEA NOT NULL,
+    created TIMESTAMP NOT NULL,
+    published TIMESTAMP,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt TIMESTAMP NOT NULL,
+    last_error TEXT NOT NULL DEFAULT '',
+    sent TEXT[] NOT NULL DEFAULT '{}', -- sinks that accepted the event
+    dead TIMESTAMP -- set after the last failed attempt
+);
+
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS sent TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS dead TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS outbox_pending ON outbox(next_attempt) WHERE published IS NULL;
+
+-- GPS breadcrumbs
+CREATE TABLE IF NOT EXISTS locations (
+    ride_id TEXT NOT NULL,
+    time TIMESTAMP NOT NULL,
+    lat FLOAT NOT NULL,
+    lon FLOAT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS locations_ride ON locations(ride_id, time);
+
+CREATE TABLE IF NOT EXISTS drivers (
+    login TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    phone TEXT NOT NULL DEFAULT '',
+    license_number TEXT NOT NULL,
+    license_expires TIMESTAMP NOT NULL,
+    vehicle TEXT NOT NULL DEFAULT '',
+    state TEXT NOT NULL,
+    availability TEXT NOT NULL,
+    last_seen TIMESTAMP,
+    lat FLOAT,
+    lon FLOAT,
+    review_since TIMESTAMP,
+    created TIMESTAMP NOT NULL
+);
+
+ALTER TABLE drivers ADD COLUMN IF NOT EXISTS review_since TIMESTAMP;
+
+CREATE TABLE IF NOT EXISTS riders (
+    login TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    email TEXT NOT NULL DEFAULT '',
+    phone TEXT NOT NULL DEFAULT '',
+    created TIMESTAMP NOT NULL,
+    password_hash TEXT NOT NULL DEFAULT '' -- '' can't log in with a password
+);
+
+ALTER TABLE riders ADD COLUMN IF NOT EXISTS password_hash TEXT NOT NULL DEFAULT '';
+
+-- Ride passengers, several for shared rides
+CREATE TABLE IF NOT EXISTS ride_riders (
+    ride_id TEXT NOT NULL,
+    rider_id TEXT NOT NULL,
+    added TIMESTAMP NOT NULL DEFAULT now(),
+    PRIMARY KEY (ride_id, rider_id)
+);
+
+CREATE INDEX IF NOT EXISTS ride_riders_rider ON ride_riders(rider_id);
+
+-- Shared ride legs, one per rider
+CREATE TABLE IF NOT EXISTS ride_legs (
+    ride_id TEXT NOT NULL,
+    rider_id TEXT NOT NULL,
+    pickup_time TIMESTAMP NOT NULL,
+    dropoff_time TIMESTAMP,
+    distance FLOAT NOT NULL DEFAULT 0,
+    fare INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (ride_id, rider_id)
+);
+
+CREATE TABLE IF NOT EXISTS vehicles (
+    id TEXT PRIMARY KEY,
+    plate TEXT NOT NULL UNIQUE,
+    model TEXT NOT NULL DEFAULT '',
+    capacity INTEGER NOT NULL,
+    class TEXT NOT NULL,
+    inspection_expires TIMESTAMP NOT NULL,
+    created TIMESTAMP NOT NULL
+);
+
+-- Driver vehicle history, end_time is NULL for the current assignment
+CREATE TABLE IF NOT EXISTS vehicle_assignments (
+    id SERIAL PRIMARY KEY,
+    vehicle_id TEXT NOT NULL,
+    driver TEXT NOT NULL,
+    start_time TIMESTAMP NOT NULL,
+    end_time TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS vehicle_assignments_driver ON vehicle_assignments(driver) WHERE end_time IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS vehicle_assignments_vehicle ON vehicle_assignments(vehicle_id) WHERE end_time IS NULL;
+
+-- Ride ratings, one per rater and ratee per ride (drivers rate each rider of a
+-- shared ride)
+CREATE TABLE IF NOT EXISTS ratings (
+    ride_id TEXT NOT NULL,
+    rater TEXT NOT NULL,
+    ratee TEXT NOT NULL,
+    by_rider BOOLEAN NOT NULL,
+    stars INTEGER NOT NULL,
+    tags TEXT[] NOT NULL DEFAULT '{}',
+    comment TEXT NOT NULL DEFAULT '',
+    created TIMESTAMP NOT NULL,
+    PRIMARY KEY (ride_id, rater, ratee)
+);
+
+DO $$
+BEGIN
+    IF (SELECT array_length(conkey, 1) FROM pg_constraint WHERE conname = 'ratings_pkey') = 2 THEN
+        ALTER TABLE ratings DROP CONSTRAINT ratings_pkey;
+        ALTER TABLE ratings ADD CONSTRAINT ratings_pkey PRIMARY KEY (ride_id, rater, ratee);
+    END IF;
+END
+$$;
+
+CREATE INDEX IF NOT EXISTS ratings_ratee ON ratings(ratee, created);
+
+-- Fare estimates, rides started with a quote are capped at high
+CREATE TABLE IF NOT EXISTS quotes (
+    id TEXT PRIMARY KEY,
+    rider TEXT NOT NULL,
+    kind TEXT NOT NULL,
+    from_lat FLOAT NOT NULL,
+    from_lon FLOAT NOT NULL,
+    to_lat FLOAT NOT NULL,
+    to_lon FLOAT NOT NULL,
+    distance FLOAT NOT NULL,
+    duration FLOAT NOT NULL, -- seconds
+    low INTEGER NOT NULL,
+    high INTEGER NOT NULL,
+    created TIMESTAMP NOT NULL,
+    expires TIMESTAMP NOT NULL,
+    ride_id TEXT NOT NULL DEFAULT '', -- the ride the quote capped
+    used TIMESTAMP
+);
+
+ALTER TABLE quotes ADD COLUMN IF NOT EXISTS ride_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE quotes ADD COLUMN IF NOT EXISTS used TIMESTAMP;
+
+-- Double-entry ledger (see ledger package), amounts in ¢, debit > 0
+CREATE TABLE IF NOT EXISTS journal_entries (
+    id TEXT PRIMARY KEY,
+    memo TEXT NOT NULL DEFAULT '',
+    time TIMESTAMP NOT NULL,
+    reverses TEXT REFERENCES journal_entries(id),
+    created TIMESTAMP NOT NULL DEFAULT now()
+);
+
+-- An entry is reversed at most once
+CREATE UNIQUE INDEX IF NOT EXISTS journal_entries_reverses ON journal_entries(reverses);
+CREATE INDEX IF NOT EXISTS journal_entries_time ON journal_entries(time);
+
+CREATE TABLE IF NOT EXISTS journal_postings (
+    entry_id TEXT NOT NULL REFERENCES journal_entries(id),
+    n INTEGER NOT NULL,
+    account TEXT NOT NULL,
+    amount INTEGER NOT NULL CHECK (amount <> 0),
+    PRIMARY KEY (entry_id, n)
+);
+
+CREATE INDEX IF NOT EXISTS journal_postings_account ON journal_postings(account);
+
+-- Entries are immutable
+CREATE OR REPLACE FUNCTION journal_immutable() RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'journal is append only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS journal_entries_immutable ON journal_entries;
+CREATE TRIGGER journal_entries_immutable
+    BEFORE UPDATE OR DELETE ON journal_entries
+    FOR EACH ROW EXECUTE FUNCTION journal_immutable();
+
+DROP TRIGGER IF EXISTS journal_postings_immutable ON journal_postings;
+CREATE TRIGGER journal_postings_immutable
+    BEFORE UPDATE OR DELETE ON journal_postings
+    FOR EACH ROW EXECUTE FUNCTION journal_immutable();
+
+-- Entries balance, checked at commit after all postings are in
+CREATE OR REPLACE FUNCTION journal_balanced() RETURNS TRIGGER AS $$
+DECLARE
+    total BIGINT;
+BEGIN
+    SELECT sum(amount) INTO total FROM journal_postings WHERE entry_id = NEW.entry_id;
+    IF total <> 0 THEN
+        RAISE EXCEPTION 'journal entry % is unbalanced: %', NEW.entry_id, total;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
 
+DROP TRIGGER IF EXISTS journal_postings_balanced ON journal_postings;
+CREATE CONSTRAINT TRIGGER journal_postings_balanced
+    AFTER INSERT ON journal_postings
+    DEFERRABLE INITIALLY DEFERRED
+    FOR EACH ROW EXECUTE FUNCTION journal_balanced();
@@ -4,7 +4,20 @@ SET
     kind = $3,
     start_time = $4,
     end_time = $5,
-    distance = $6
+    distance = $6,
+    cancelled = $7,
+    reported_distance = $8,
+    distance_flag = $9,
+    start_lat = $10,
+    start_lon = $11,
+    start_zone = $12,
+    end_lat = $13,
+    end_lon = $14,
+    end_zone = $15,
+    car_id = $16,
+    fare = $17,
+    fare_details = $18,
+    quote_id = $19
 WHERE
     id = $1
 ;
@@ -0,0 +1,6 @@
+SELECT
+    v.id, v.plate, v.model, v.capacity, v.class, v.inspection_expires, v.created
+FROM vehicles v
+JOIN vehicle_assignments a ON a.vehicle_id = v.id
+WHERE a.driver = $1 AND a.end_time IS NULL
+;
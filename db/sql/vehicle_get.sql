@@ -0,0 +1,5 @@
+SELECT
+    id, plate, model, capacity, class, inspection_expires, created
+FROM vehicles
+WHERE id = $1
+;
@@ -0,0 +1,6 @@
+INSERT INTO vehicles (
+    id, plate, model, capacity, class, inspection_expires, created
+) VALUES (
+    $1, $2, $3, $4, $5, $6, $7
+)
+;
@@ -0,0 +1,3 @@
+DELETE FROM webhooks
+WHERE id = $1
+;
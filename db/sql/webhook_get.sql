@@ -0,0 +1,4 @@
+SELECT id, url, secret, events, created
+FROM webhooks
+WHERE id = $1
+;
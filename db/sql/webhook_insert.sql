@@ -0,0 +1,6 @@
+INSERT INTO webhooks (
+    id, url, secret, events, created
+) VALUES (
+    $1, $2, $3, $4, $5
+)
+;
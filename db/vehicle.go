@@ -0,0 +1,131 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+	"errors"
+	"time"
+)
+
+var (
+	//go:embed sql/vehicle_insert.sql
+	vehicleInsertSQL string
+
+	//go:embed sql/vehicle_get.sql
+	vehicleGetSQL string
+
+	//go:embed sql/vehicle_driver.sql
+	vehicleDriverSQL string
+
+	//go:embed sql/assignment_end.sql
+	assignmentEndSQL string
+
+	//go:embed sql/assignment_insert.sql
+	assignmentInsertSQL string
+
+	//go:embed sql/assignment_list.sql
+	assignmentListSQL string
+)
+
+type Vehicle struct {
+	ID                string
+	Plate             string
+	Model             string
+	Capacity          int
+	Class             string
+	InspectionExpires time.Time
+	Created           time.Time
+}
+
+type Assignment struct {
+	VehicleID string
+	Driver    string
+	Start     time.Time
+	End       time.Time // zero for the current assignment
+}
+
+func (db *DB) AddVehicle(ctx context.Context, v Vehicle) error {
+	ctx, span := startSpan(ctx, "vehicle.insert", vehicleInsertSQL)
+	defer span.Finish()
+
+	_, err := db.conn.ExecContext(ctx, vehicleInsertSQL,
+		v.ID, v.Plate, v.Model, v.Capacity, v.Class, v.InspectionExpires, v.Created)
+	span.SetError(err)
+	return err
+}
+
+func scanVehicle(s scanner) (Vehicle, error) {
+	var v Vehicle
+	err := s.Scan(&v.ID, &v.Plate, &v.Model, &v.Capacity, &v.Class, &v.InspectionExpires, &v.Created)
+	return v, err
+}
+
+func (db *DB) queryVehicle(ctx context.Context, name, query string, arg string) (Vehicle, error) {
+	ctx, span := startSpan(ctx, name, query)
+	defer span.Finish()
+
+	v, err := scanVehicle(db.conn.QueryRowContext(ctx, query, arg))
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return Vehicle{}, ErrNotFound
+	case err != nil:
+		span.SetError(err)
+		return Vehicle{}, err
+	}
+
+	return v, nil
+}
+
+func (db *DB) Vehicle(ctx context.Context, id string) (Vehicle, error) {
+	return db.queryVehicle(ctx, "vehicle.get", vehicleGetSQL, id)
+}
+
+// DriverVehicle returns the vehicle currently assigned to driver.
+func (db *DB) DriverVehicle(ctx context.Context, driver string) (Vehicle, error) {
+	return db.queryVehicle(ctx, "vehicle.driver", vehicleDriverSQL, driver)
+}
+
+// AssignVehicle assigns a vehicle to driver at t, the current assignments of
+// the driver and of the vehicle end.
+func (db *DB) AssignVehicle(ctx context.Context, vehicleID, driver string, t time.Time) error {
+	ctx, span := startSpan(ctx, "vehicle.assign", assignmentInsertSQL)
+	defer span.Finish()
+
+	err := db.inTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, assignmentEndSQL, driver, vehicleID, t); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, assignmentInsertSQL, vehicleID, driver, t)
+		return err
+	})
+	span.SetError(err)
+	return err
+}
+
+// Assignments returns the assignment history of a vehicle, newest first.
+func (db *DB) Assignments(ctx context.Context, vehicleID string) ([]Assignment, error) {
+	ctx, span := startSpan(ctx, "vehicle.assignments", assignmentListSQL)
+	defer span.Finish()
+
+	rows, err := db.conn.QueryContext(ctx, assignmentListSQL, vehicleID)
+	if err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var as []Assignment
+	for rows.Next() {
+		var a Assignment
+		var end sql.NullTime
+		if err := rows.Scan(&a.VehicleID, &a.Driver, &a.Start, &end); err != nil {
+			span.SetError(err)
+			return nil, err
+		}
+		a.End = end.Time
+		as = append(as, a)
+	}
+	span.SetError(rows.Err())
+	return as, rows.Err()
+}
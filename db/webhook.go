@@ -0,0 +1,270 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var (
+	//go:embed sql/webhook_insert.sql
+	webhookInsertSQL string
+
+	//go:embed sql/webhook_get.sql
+	webhookGetSQL string
+
+	//go:embed sql/webhook_list.sql
+	webhookListSQL string
+
+	//go:embed sql/webhook_delete.sql
+	webhookDeleteSQL string
+
+	//go:embed sql/delivery_insert.sql
+	deliveryInsertSQL string
+
+	//go:embed sql/delivery_get.sql
+	deliveryGetSQL string
+
+	//go:embed sql/delivery_update.sql
+	deliveryUpdateSQL string
+
+	//go:embed sql/delivery_list.sql
+	deliveryListSQL string
+
+	//go:embed sql/delivery_claim.sql
+	deliveryClaimSQL string
+
+	//go:embed sql/attempt_insert.sql
+	attemptInsertSQL string
+
+	//go:embed sql/attempt_list.sql
+	attemptListSQL string
+)
+
+type Webhook struct {
+	ID      string
+	URL     string
+	Secret  string
+	Events  []string
+	Created time.Time
+}
+
+type WebhookDelivery struct {
+	ID          string
+	WebhookID   string
+	EventID     int64
+	EventType   string
+	Payload     []byte
+	Status      string
+	Attempts    int
+	NextAttempt time.Time
+	LastError   string
+	Created     time.Time
+	Updated     time.Time
+}
+
+type WebhookAttempt struct {
+	DeliveryID string
+	N          int
+	Time       time.Time
+	StatusCode int
+	Error      string
+	Duration   time.Duration
+}
+
+func (db *DB) AddWebhook(ctx context.Context, w Webhook) error {
+	ctx, span := startSpan(ctx, "webhook.insert", webhookInsertSQL)
+	defer span.Finish()
+
+	_, err := db.conn.ExecContext(ctx, webhookInsertSQL,
+		w.ID, w.URL, w.Secret, pq.Array(w.Events), w.Created)
+	span.SetError(err)
+	return err
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanWebhook(s scanner) (Webhook, error) {
+	var w Webhook
+	err := s.Scan(&w.ID, &w.URL, &w.Secret, pq.Array(&w.Events), &w.Created)
+	return w, err
+}
+
+func (db *DB) Webhook(ctx context.Context, id string) (Webhook, error) {
+	ctx, span := startSpan(ctx, "webhook.get", webhookGetSQL)
+	defer span.Finish()
+
+	w, err := scanWebhook(db.conn.QueryRowContext(ctx, webhookGetSQL, id))
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return Webhook{}, ErrNotFound
+	case err != nil:
+		span.SetError(err)
+		return Webhook{}, err
+	}
+	return w, nil
+}
+
+func (db *DB) Webhooks(ctx context.Context) ([]Webhook, error) {
+	ctx, span := startSpan(ctx, "webhook.list", webhookListSQL)
+	defer span.Finish()
+
+	rows, err := db.conn.QueryContext(ctx, webhookListSQL)
+	if err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ws []Webhook
+	for rows.Next() {
+		w, err := scanWebhook(rows)
+		if err != nil {
+			span.SetError(err)
+			return nil, err
+		}
+		ws = append(ws, w)
+	}
+	span.SetError(rows.Err())
+	return ws, rows.Err()
+}
+
+func (db *DB) DeleteWebhook(ctx context.Context, id string) error {
+	ctx, span := startSpan(ctx, "webhook.delete", webhookDeleteSQL)
+	defer span.Finish()
+
+	res, err := db.conn.ExecContext(ctx, webhookDeleteSQL, id)
+	if err != nil {
+		span.SetError(err)
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (db *DB) AddDelivery(ctx context.Context, d WebhookDelivery) error {
+	ctx, span := startSpan(ctx, "delivery.insert", deliveryInsertSQL)
+	defer span.Finish()
+
+	_, err := db.conn.ExecContext(ctx, deliveryInsertSQL,
+		d.ID, d.WebhookID, d.EventID, d.EventType, d.Payload, d.Status,
+		d.Attempts, d.NextAttempt, d.LastError, d.Created, d.Updated)
+	span.SetError(err)
+	return err
+}
+
+func scanDelivery(s scanner) (WebhookDelivery, error) {
+	var d WebhookDelivery
+	err := s.Scan(
+		&d.ID, &d.WebhookID, &d.EventID, &d.EventType, &d.Payload, &d.Status,
+		&d.Attempts, &d.NextAttempt, &d.LastError, &d.Created, &d.Updated)
+	return d, err
+}
+
+func (db *DB) Delivery(ctx context.Context, id string) (WebhookDelivery, error) {
+	ctx, span := startSpan(ctx, "delivery.get", deliveryGetSQL)
+	defer span.Finish()
+
+	d, err := scanDelivery(db.conn.QueryRowContext(ctx, deliveryGetSQL, id))
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return WebhookDelivery{}, ErrNotFound
+	case err != nil:
+		span.SetError(err)
+		return WebhookDelivery{}, err
+	}
+	return d, nil
+}
+
+func (db *DB) UpdateDelivery(ctx context.Context, d WebhookDelivery) error {
+	ctx, span := startSpan(ctx, "delivery.update", deliveryUpdateSQL)
+	defer span.Finish()
+
+	_, err := db.conn.ExecContext(ctx, deliveryUpdateSQL,
+		d.ID, d.Status, d.Attempts, d.NextAttempt, d.LastError, d.Updated)
+	span.SetError(err)
+	return err
+}
+
+func (db *DB) queryDeliveries(ctx context.Context, query string, args ...any) ([]WebhookDelivery, error) {
+	rows, err := db.conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ds []WebhookDelivery
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		ds = append(ds, d)
+	}
+	return ds, rows.Err()
+}
+
+// Deliveries returns the newest deliveries of a webhook, empty status means all.
+func (db *DB) Deliveries(ctx context.Context, webhookID, status string, limit int) ([]WebhookDelivery, error) {
+	ctx, span := startSpan(ctx, "delivery.list", deliveryListSQL)
+	defer span.Finish()
+
+	ds, err := db.queryDeliveries(ctx, deliveryListSQL, webhookID, status, limit)
+	span.SetError(err)
+	return ds, err
+}
+
+// ClaimDue returns up to limit pending deliveries due at now and moves their
+// next attempt to now+lease.
+func (db *DB) ClaimDue(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]WebhookDelivery, error) {
+	ctx, span := startSpan(ctx, "delivery.claim", deliveryClaimSQL)
+	defer span.Finish()
+
+	ds, err := db.queryDeliveries(ctx, deliveryClaimSQL, now, now.Add(lease), limit)
+	span.SetError(err)
+	return ds, err
+}
+
+func (db *DB) AddAttempt(ctx context.Context, a WebhookAttempt) error {
+	ctx, span := startSpan(ctx, "attempt.insert", attemptInsertSQL)
+	defer span.Finish()
+
+	_, err := db.conn.ExecContext(ctx, attemptInsertSQL,
+		a.DeliveryID, a.N, a.Time, a.StatusCode, a.Error, a.Duration.Milliseconds())
+	span.SetError(err)
+	return err
+}
+
+func (db *DB) Attempts(ctx context.Context, deliveryID string) ([]WebhookAttempt, error) {
+	ctx, span := startSpan(ctx, "attempt.list", attemptListSQL)
+	defer span.Finish()
+
+	rows, err := db.conn.QueryContext(ctx, attemptListSQL, deliveryID)
+	if err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var as []WebhookAttempt
+	for rows.Next() {
+		var a WebhookAttempt
+		var ms int64
+		if err := rows.Scan(&a.DeliveryID, &a.N, &a.Time, &a.StatusCode, &a.Error, &ms); err != nil {
+			span.SetError(err)
+			return nil, err
+		}
+		a.Duration = time.Duration(ms) * time.Millisecond
+		as = append(as, a)
+	}
+	span.SetError(rows.Err())
+	return as, rows.Err()
+}
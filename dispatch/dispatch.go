@@ -0,0 +1,360 @@
+// Package dispatch matches ride requests to the nearest available drivers.
+//
+// A request is offered to one driver at a time, nearest first. If the driver
+// declines or doesn't answer in OfferTimeout, the offer goes to the next
+// candidate. When a driver accepts, OnAccept creates the ride.
+//
+// State is in memory, a Matcher serves a single replica.
+package dispatch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/353solutions/unter"
+	"github.com/353solutions/unter/geo"
+)
+
+type Status uint8
+
+const (
+	Pending   Status = iota + 1 // looking for a driver
+	Offered                     // waiting for a driver to accept
+	Accepted                    // ride created
+	Unmatched                   // no driver accepted
+	Cancelled                   // cancelled by the rider
+)
+
+func (s Status) String() string {
+	switch s {
+	case Pending:
+		return "pending"
+	case Offered:
+		return "offered"
+	case Accepted:
+		return "accepted"
+	case Unmatched:
+		return "unmatched"
+	case Cancelled:
+		return "cancelled"
+	}
+
+	return fmt.Sprintf("<Status %d>", s)
+}
+
+// Done returns true if s is final.
+func (s Status) Done() bool {
+	return s == Accepted || s == Unmatched || s == Cancelled
+}
+
+type Request struct {
+	ID      string
+	Rider   string
+	Kind    unter.Kind
+	Pickup  geo.Point // Time is the request time
+	Created time.Time
+	QuoteID string // fare estimate, "" if none
+
+	Status  Status
+	Driver  string    // offered or accepted driver
+	Expires time.Time // offer expiry
+	Tried   []string  // drivers offered, in order
+	RideID  string    // set when accepted
+	Updated time.Time
+}
+
+func (r Request) Validate() error {
+	if r.Rider == "" {
+		return fmt.Errorf("missing rider")
+	}
+
+	if r.Kind <= 0 || r.Kind > unter.Private {
+		return fmt.Errorf("bad kind: %d", r.Kind)
+	}
+
+	return r.Pickup.Validate()
+}
+
+// Offer is a request offered to a driver.
+type Offer struct {
+	RequestID string
+	Driver    string
+	Kind      unter.Kind
+	Pickup    geo.Point
+	Distance  float64 // miles from driver to pickup
+	Expires   time.Time
+}
+
+var (
+	ErrNotFound = errors.New("request not found")
+	ErrNoOffer  = errors.New("no offer for driver")
+	ErrDone     = errors.New("request done")
+)
+
+// AcceptFunc creates the ride for an accepted request and returns its ID.
+type AcceptFunc func(ctx context.Context, r Request) (string, error)
+
+type Matcher struct {
+	OfferTimeout time.Duration // time a driver has to accept
+	Radius       float64       // miles around pickup
+	MaxOffers    int           // offers before a request is unmatched
+	TTL          time.Duration // drivers without a location update are ignored
+	Retention    time.Duration // done requests are kept for status queries
+	OnAccept     AcceptFunc
+
+	mu       sync.Mutex
+	drivers  *geo.Index
+	requests map[string]*Request
+	offers   map[string]*Offer // driver -> offer
+}
+
+// NewMatcher returns a matcher indexing drivers with geohash precision, see
+// geo.NewIndex.
+func NewMatcher(precision int, onAccept AcceptFunc) *Matcher {
+	m := Matcher{
+		OfferTimeout: 15 * time.Second,
+		Radius:       5,
+		MaxOffers:    5,
+		TTL:          2 * time.Minute,
+		Retention:    time.Hour,
+		OnAccept:     onAccept,
+
+		drivers:  geo.NewIndex(precision),
+		requests: make(map[string]*Request),
+		offers:   make(map[string]*Offer),
+	}
+	return &m
+}
+
+// SetAvailable marks driver as available at p, p.Time is the update time.
+func (m *Matcher) SetAvailable(driver string, p geo.Point) {
+	m.drivers.Set(driver, p)
+}
+
+// SetUnavailable removes driver from matching, an outstanding offer stays
+// until it's answered or expires.
+func (m *Matcher) SetUnavailable(driver string) {
+	m.drivers.Remove(driver)
+}
+
+// Request adds a request and offers it to the nearest driver.
+func (m *Matcher) Request(r Request) (Request, error) {
+	if err := r.Validate(); err != nil {
+		return Request{}, err
+	}
+	if r.ID == "" {
+		r.ID = unter.NewID()
+	}
+	r.Status, r.Driver, r.Tried, r.RideID = Pending, "", nil, ""
+	r.Updated = r.Created
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.requests[r.ID]; ok {
+		return Request{}, fmt.Errorf("%s: duplicate request", r.ID)
+	}
+	m.requests[r.ID] = &r
+	m.offerNext(&r, r.Created)
+	return m.copy(&r), nil
+}
+
+// Get returns the request with id.
+func (m *Matcher) Get(id string) (Request, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	r, ok := m.requests[id]
+	if !ok {
+		return Request{}, ErrNotFound
+	}
+	return m.copy(r), nil
+}
+
+// Offer returns the current offer for driver.
+func (m *Matcher) Offer(driver string) (Offer, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	o, ok := m.offers[driver]
+	if !ok {
+		return Offer{}, false
+	}
+	return *o, true
+}
+
+// Accept accepts the request offer for driver, OnAccept creates the ride. If
+// OnAccept fails the request is offered to the next driver.
+func (m *Matcher) Accept(ctx context.Context, id, driver string, now time.Time) (Request, error) {
+	m.mu.Lock()
+	r, err := m.offered(id, driver, now)
+	if err != nil {
+		m.mu.Unlock()
+		return Request{}, err
+	}
+	// Hold the offer while the ride is created, Expire skips it
+	r.Expires = time.Time{}
+	m.offers[driver].Expires = time.Time{}
+	req := m.copy(r)
+	m.mu.Unlock()
+
+	rideID, err := m.OnAccept(ctx, req)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.offers, driver)
+	r.Updated = now
+	if err != nil {
+		m.offerNext(r, now)
+		return Request{}, err
+	}
+
+	m.drivers.Remove(driver)
+	r.Status, r.RideID = Accepted, rideID
+	return m.copy(r), nil
+}
+
+// Decline declines the request offer for driver, the request goes to the next
+// driver.
+func (m *Matcher) Decline(id, driver string, now time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	r, err := m.offered(id, driver, now)
+	if err != nil {
+		return err
+	}
+
+	delete(m.offers, driver)
+	m.offerNext(r, now)
+	return nil
+}
+
+// Cancel cancels a request that's not done.
+func (m *Matcher) Cancel(id string, now time.Time) (Request, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	r, ok := m.requests[id]
+	if !ok {
+		return Request{}, ErrNotFound
+	}
+	if r.Status.Done() {
+		return Request{}, ErrDone
+	}
+	if r.Status == Offered && r.Expires.IsZero() {
+		return Request{}, fmt.Errorf("%s: being accepted", id) // OnAccept is running
+	}
+
+	if r.Status == Offered {
+		delete(m.offers, r.Driver)
+	}
+	r.Status, r.Driver, r.Updated = Cancelled, "", now
+	return m.copy(r), nil
+}
+
+// Expire moves expired offers to the next driver and drops old done
+// requests.
+func (m *Matcher) Expire(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for driver, o := range m.offers {
+		if o.Expires.IsZero() || now.Before(o.Expires) {
+			continue
+		}
+		delete(m.offers, driver)
+		m.offerNext(m.requests[o.RequestID], now)
+	}
+
+	for id, r := range m.requests {
+		if r.Status.Done() && now.Sub(r.Updated) > m.Retention {
+			delete(m.requests, id)
+		}
+	}
+}
+
+// Run expires offers every interval until ctx is done.
+func (m *Matcher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			m.Expire(now)
+		}
+	}
+}
+
+// offered returns the request with id if it's offered to driver.
+func (m *Matcher) offered(id, driver string, now time.Time) (*Request, error) {
+	r, ok := m.requests[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if r.Status.Done() {
+		return nil, ErrDone
+	}
+
+	o, ok := m.offers[driver]
+	if !ok || o.RequestID != id || o.Expires.IsZero() || !now.Before(o.Expires) {
+		return nil, ErrNoOffer
+	}
+	return r, nil
+}
+
+// offerNext offers r to the nearest driver that wasn't offered yet, or marks
+// it as unmatched.
+func (m *Matcher) offerNext(r *Request, now time.Time) {
+	r.Status, r.Driver, r.Expires, r.Updated = Pending, "", time.Time{}, now
+	if len(r.Tried) >= m.MaxOffers {
+		r.Status = Unmatched
+		return
+	}
+
+	skip := func(driver string, p geo.Point) bool {
+		if now.Sub(p.Time) > m.TTL {
+			return true
+		}
+		if _, ok := m.offers[driver]; ok {
+			return true
+		}
+		for _, d := range r.Tried {
+			if d == driver {
+				return true
+			}
+		}
+		return false
+	}
+	near := m.drivers.Nearest(r.Pickup.Lat, r.Pickup.Lon, m.Radius, 1, skip)
+	if len(near) == 0 {
+		r.Status = Unmatched
+		return
+	}
+
+	n := near[0]
+	o := Offer{
+		RequestID: r.ID,
+		Driver:    n.ID,
+		Kind:      r.Kind,
+		Pickup:    r.Pickup,
+		Distance:  n.Distance,
+		Expires:   now.Add(m.OfferTimeout),
+	}
+	m.offers[n.ID] = &o
+	r.Status, r.Driver, r.Expires = Offered, n.ID, o.Expires
+	r.Tried = append(r.Tried, n.ID)
+}
+
+func (m *Matcher) copy(r *Request) Request {
+	c := *r
+	c.Tried = append([]string(nil), r.Tried...)
+	return c
+}
@@ -0,0 +1,154 @@
+package dispatch
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/353solutions/unter"
+	"github.com/353solutions/unter/geo"
+)
+
+var (
+	now    = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	pickup = geo.Point{Lat: 32.08, Lon: 34.78, Time: now}
+)
+
+// newMatcher returns a matcher with drivers at increasing distance (~0.7
+// miles apart) from pickup, rides are created with the driver as ID.
+func newMatcher(drivers ...string) *Matcher {
+	m := NewMatcher(6, func(ctx context.Context, r Request) (string, error) {
+		return "ride-" + r.Driver, nil
+	})
+	for i, d := range drivers {
+		m.SetAvailable(d, geo.Point{Lat: pickup.Lat, Lon: pickup.Lon + float64(i+1)*0.01, Time: now})
+	}
+	return m
+}
+
+func newRequest(t *testing.T, m *Matcher) Request {
+	r, err := m.Request(Request{Rider: "m", Kind: unter.Private, Pickup: pickup, Created: now})
+	require.NoError(t, err)
+	return r
+}
+
+func TestMatcherAccept(t *testing.T) {
+	require := require.New(t)
+	m := newMatcher("bond", "q")
+
+	r := newRequest(t, m)
+	require.Equal(Offered, r.Status)
+	require.Equal("bond", r.Driver, "nearest")
+
+	_, ok := m.Offer("q")
+	require.False(ok)
+	o, ok := m.Offer("bond")
+	require.True(ok)
+	require.Equal(r.ID, o.RequestID)
+
+	_, err := m.Accept(context.Background(), r.ID, "q", now)
+	require.ErrorIs(err, ErrNoOffer)
+
+	r, err = m.Accept(context.Background(), r.ID, "bond", now.Add(time.Second))
+	require.NoError(err)
+	require.Equal(Accepted, r.Status)
+	require.Equal("ride-bond", r.RideID)
+
+	_, ok = m.Offer("bond")
+	require.False(ok)
+	_, ok = m.drivers.Get("bond")
+	require.False(ok, "on trip")
+}
+
+func TestMatcherFallThrough(t *testing.T) {
+	require := require.New(t)
+	m := newMatcher("bond", "q", "m")
+
+	r := newRequest(t, m)
+	require.NoError(m.Decline(r.ID, "bond", now))
+	r, err := m.Get(r.ID)
+	require.NoError(err)
+	require.Equal("q", r.Driver)
+
+	// q doesn't answer
+	m.Expire(now.Add(m.OfferTimeout - time.Second))
+	r, _ = m.Get(r.ID)
+	require.Equal("q", r.Driver)
+	m.Expire(now.Add(m.OfferTimeout))
+	r, _ = m.Get(r.ID)
+	require.Equal("m", r.Driver)
+
+	_, err = m.Accept(context.Background(), r.ID, "q", now.Add(m.OfferTimeout))
+	require.ErrorIs(err, ErrNoOffer, "expired")
+
+	require.NoError(m.Decline(r.ID, "m", now.Add(m.OfferTimeout)))
+	r, _ = m.Get(r.ID)
+	require.Equal(Unmatched, r.Status)
+	require.Equal([]string{"bond", "q", "m"}, r.Tried)
+}
+
+func TestMatcherAcceptError(t *testing.T) {
+	require := require.New(t)
+	m := newMatcher("bond", "q")
+	m.OnAccept = func(ctx context.Context, r Request) (string, error) {
+		if r.Driver == "bond" {
+			return "", fmt.Errorf("suspended")
+		}
+		return "ride-q", nil
+	}
+
+	r := newRequest(t, m)
+	_, err := m.Accept(context.Background(), r.ID, "bond", now)
+	require.Error(err)
+
+	r, _ = m.Get(r.ID)
+	require.Equal("q", r.Driver)
+}
+
+func TestMatcherSkip(t *testing.T) {
+	require := require.New(t)
+	m := newMatcher("bond", "q")
+	m.MaxOffers = 1
+
+	// bond has an offer, second request goes to q
+	r1 := newRequest(t, m)
+	r2 := newRequest(t, m)
+	require.Equal("bond", r1.Driver)
+	require.Equal("q", r2.Driver)
+
+	// Stale location
+	m = newMatcher("bond")
+	m.TTL = time.Minute
+	r, err := m.Request(Request{Rider: "m", Kind: unter.Shared, Pickup: pickup, Created: now.Add(2 * time.Minute)})
+	require.NoError(err)
+	require.Equal(Unmatched, r.Status)
+
+	// Too far
+	m = newMatcher("bond")
+	m.Radius = 0.5
+	r = newRequest(t, m)
+	require.Equal(Unmatched, r.Status)
+}
+
+func TestMatcherCancel(t *testing.T) {
+	require := require.New(t)
+	m := newMatcher("bond")
+
+	r := newRequest(t, m)
+	r, err := m.Cancel(r.ID, now)
+	require.NoError(err)
+	require.Equal(Cancelled, r.Status)
+
+	_, ok := m.Offer("bond")
+	require.False(ok)
+	_, err = m.Cancel(r.ID, now)
+	require.ErrorIs(err, ErrDone)
+
+	// Done requests are dropped after Retention
+	m.Expire(now.Add(m.Retention + time.Second))
+	_, err = m.Get(r.ID)
+	require.ErrorIs(err, ErrNotFound)
+}
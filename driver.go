@@ -0,0 +1,129 @@
+package unter
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+type DriverState uint8
+
+const (
+	Active DriverState = iota + 1
+	Suspended
+	maxDriverState
+)
+
+func (s DriverState) String() string {
+	switch s {
+	case Active:
+		return "active"
+	case Suspended:
+		return "suspended"
+	}
+
+	return fmt.Sprintf("<DriverState %d>", s)
+}
+
+type Availability uint8
+
+const (
+	Offline Availability = iota + 1
+	Online
+	OnTrip
+	maxAvailability
+)
+
+func (a Availability) String() string {
+	switch a {
+	case Offline:
+		return "offline"
+	case Online:
+		return "online"
+	case OnTrip:
+		return "on_trip"
+	}
+
+	return fmt.Sprintf("<Availability %d>", a)
+}
+
+type License struct {
+	Number  string
+	Expires time.Time
+}
+
+type Driver struct {
+	Login   string // same as the user login
+	Name    string
+	Phone   string
+	License License
+	Vehicle string // e.g. "Aston Martin DB5 (BMT 216A)"
+
+	State        DriverState
+	Availability Availability
+	LastSeen     time.Time // last heartbeat
+}
+
+func (d Driver) Validate() error {
+	if d.Login == "" {
+		return fmt.Errorf("missing login")
+	}
+
+	if d.Name == "" {
+		return fmt.Errorf("missing name")
+	}
+
+	if d.License.Number == "" {
+		return fmt.Errorf("missing license number")
+	}
+
+	if d.License.Expires.Equal(zeroTime) {
+		return fmt.Errorf("missing license expiry")
+	}
+
+	if d.State <= 0 || d.State >= maxDriverState {
+		return fmt.Errorf("bad state: %d", d.State)
+	}
+
+	if d.Availability <= 0 || d.Availability >= maxAvailability {
+		return fmt.Errorf("bad availability: %d", d.Availability)
+	}
+
+	return nil
+}
+
+// Status returns the driver availability at now, drivers without a heartbeat
+// in the last ttl are offline.
+func (d Driver) Status(now time.Time, ttl time.Duration) Availability {
+	if d.Availability == Offline || now.Sub(d.LastSeen) > ttl {
+		return Offline
+	}
+	return d.Availability
+}
+
+var (
+	ErrSuspended      = errors.New("driver suspended")
+	ErrLicenseExpired = errors.New("driver license expired")
+	ErrOffline        = errors.New("driver offline")
+	ErrOnTrip         = errors.New("driver on trip")
+)
+
+// CanStart returns an error if the driver can't start a ride at now.
+func (d Driver) CanStart(now time.Time, ttl time.Duration) error {
+	if d.State != Active {
+		return ErrSuspended
+	}
+
+	if now.After(d.License.Expires) {
+		return ErrLicenseExpired
+	}
+
+	switch d.Status(now, ttl) {
+	case Offline:
+		return ErrOffline
+	case OnTrip:
+		return ErrOnTrip
+	}
+
+	return nil
+}
@@ -0,0 +1,53 @@
+package unter_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/353solutions/unter"
+)
+
+var (
+	now       = time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	heartbeat = 2 * time.Minute
+)
+
+func newDriver(state unter.DriverState, a unter.Availability, lastSeen time.Duration) unter.Driver {
+	return unter.Driver{
+		Login:        "Bond",
+		Name:         "James Bond",
+		License:      unter.License{Number: "007", Expires: now.Add(365 * 24 * time.Hour)},
+		State:        state,
+		Availability: a,
+		LastSeen:     now.Add(-lastSeen),
+	}
+}
+
+var canStartCases = []struct {
+	driver unter.Driver
+	err    error
+}{
+	{newDriver(unter.Active, unter.Online, time.Second), nil},
+	{newDriver(unter.Suspended, unter.Online, time.Second), unter.ErrSuspended},
+	{newDriver(unter.Active, unter.Offline, time.Second), unter.ErrOffline},
+	{newDriver(unter.Active, unter.Online, time.Hour), unter.ErrOffline}, // stale heartbeat
+	{newDriver(unter.Active, unter.OnTrip, time.Second), unter.ErrOnTrip},
+}
+
+func TestDriverCanStart(t *testing.T) {
+	for _, tc := range canStartCases {
+		name := fmt.Sprintf("%s-%s-%v", tc.driver.State, tc.driver.Availability, now.Sub(tc.driver.LastSeen))
+		t.Run(name, func(t *testing.T) {
+			require.NoError(t, tc.driver.Validate())
+			err := tc.driver.CanStart(now, heartbeat)
+			require.ErrorIs(t, err, tc.err)
+		})
+	}
+
+	d := newDriver(unter.Active, unter.Online, time.Second)
+	d.License.Expires = now.Add(-time.Hour)
+	require.ErrorIs(t, d.CanStart(now, heartbeat), unter.ErrLicenseExpired)
+}
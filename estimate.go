@@ -0,0 +1,119 @@
+package unter
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/353solutions/unter/geo"
+)
+
+const (
+	routeFactor = 1.3 // driving distance / straight line distance
+	routeSlack  = 0.2 // extra driving distance in the high estimate
+
+	// Fewer similar rides than this and DefaultSpeeds are used
+	minSpeedRides = 10
+
+	// The quote caps rides starting and ending this close (miles) to the
+	// quoted points that are at most quoteMaxDistance the quoted distance.
+	quoteRadius      = 0.5
+	quoteMaxDistance = 1.5
+)
+
+// SpeedStats are speed (mph) percentiles of past rides.
+type SpeedStats struct {
+	Count  int     // rides
+	Slow   float64 // 25th percentile
+	Median float64
+	Fast   float64 // 75th percentile
+}
+
+// DefaultSpeeds are city speeds, used when there are not enough past rides.
+var DefaultSpeeds = SpeedStats{Slow: 12, Median: 18, Fast: 25}
+
+// Quote is a fare estimate, the fare of a ride started with the quote is capped
+// at High.
+type Quote struct {
+	ID       string
+	Rider    string
+	Kind     Kind
+	From     geo.Point
+	To       geo.Point
+	Distance float64       // estimated driving miles
+	Duration time.Duration // expected
+	Low      int           // ¢
+	High     int
+	Created  time.Time
+	Expires  time.Time // rides must start before
+}
+
+// DrivingDistance returns the estimated driving distance between points
+// straight miles apart.
+func DrivingDistance(straight float64) float64 {
+	return straight * routeFactor
+}
+
+// Estimate returns a quote for a ride of straight line distance miles, ID,
+// Rider, points and times are not set.
+func Estimate(straight float64, k Kind, speeds SpeedStats) Quote {
+	if speeds.Count < minSpeedRides || speeds.Slow <= 0 || speeds.Fast < speeds.Slow {
+		speeds = DefaultSpeeds
+	}
+
+	hours := func(distance, mph float64) time.Duration {
+		return time.Duration(distance / mph * float64(time.Hour))
+	}
+
+	shared := k == Shared
+	distance := DrivingDistance(straight)
+	far := distance * (1 + routeSlack)
+	q := Quote{
+		Kind:     k,
+		Distance: distance,
+		Duration: hours(distance, speeds.Median).Round(time.Second),
+		Low:      RideFee(hours(distance, speeds.Fast), distance, shared),
+		High:     RideFee(hours(far, speeds.Slow), far, shared),
+	}
+	return q
+}
+
+var ErrQuoteExpired = errors.New("quote expired")
+
+// CanApply returns an error if q can't cap the fare of r.
+func (q Quote) CanApply(r Ride) error {
+	if q.Kind != r.Kind {
+		return fmt.Errorf("quote for a %s ride", q.Kind)
+	}
+
+	if !r.Start.Before(q.Expires) {
+		return ErrQuoteExpired
+	}
+
+	for _, login := range r.Riders {
+		if login == q.Rider {
+			return nil
+		}
+	}
+	return fmt.Errorf("quote rider %q not in ride", q.Rider)
+}
+
+var ErrQuoteRoute = errors.New("ride doesn't match quote")
+
+// Covers returns an error if a ride from pickup to dropoff of distance miles
+// is not the quoted ride.
+func (q Quote) Covers(pickup, dropoff geo.Point, distance float64) error {
+	if d := geo.Haversine(q.From, pickup); d > quoteRadius {
+		return fmt.Errorf("%w: pickup %.2f miles from quoted", ErrQuoteRoute, d)
+	}
+
+	if d := geo.Haversine(q.To, dropoff); d > quoteRadius {
+		return fmt.Errorf("%w: drop-off %.2f miles from quoted", ErrQuoteRoute, d)
+	}
+
+	if limit := q.Distance * quoteMaxDistance; distance > limit {
+		return fmt.Errorf("%w: %.2f miles, quoted %.2f", ErrQuoteRoute, distance, q.Distance)
+	}
+
+	return nil
+}
@@ -0,0 +1,106 @@
+package unter_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/353solutions/unter"
+	"github.com/353solutions/unter/geo"
+)
+
+func TestEstimate(t *testing.T) {
+	require := require.New(t)
+
+	q := unter.Estimate(10, unter.Private, unter.SpeedStats{})
+	require.InDelta(13, q.Distance, 0.001)
+	require.Equal(13*time.Hour/18, q.Duration.Round(time.Second)) // DefaultSpeeds.Median
+	require.Equal(3250, q.Low)
+	require.Less(q.Low, q.High)
+
+	// Slow history
+	slow := unter.SpeedStats{Count: 100, Slow: 2, Median: 3, Fast: 4}
+	qs := unter.Estimate(10, unter.Private, slow)
+	require.Greater(qs.Duration, q.Duration)
+	require.Greater(qs.High, q.High) // time component wins
+
+	// Shared is cheaper
+	qs = unter.Estimate(10, unter.Shared, unter.SpeedStats{})
+	require.Less(qs.High, q.High)
+
+	// Short rides pay the minimum
+	q = unter.Estimate(0.1, unter.Private, unter.SpeedStats{})
+	require.Equal(minFee, q.Low)
+}
+
+func TestQuoteCanApply(t *testing.T) {
+	require := require.New(t)
+
+	q := unter.Quote{Rider: "Moneypenny", Kind: unter.Private, Expires: now.Add(time.Minute)}
+	r := ride(unter.Private, time.Minute, 1)
+	r.Riders = []string{"Moneypenny"}
+	require.NoError(q.CanApply(r))
+
+	r.Riders = []string{"Q"}
+	require.Error(q.CanApply(r), "rider")
+
+	r.Riders, r.Kind = []string{"Moneypenny"}, unter.Shared
+	require.Error(q.CanApply(r), "kind")
+
+	r.Kind, r.Start = unter.Private, q.Expires
+	require.ErrorIs(q.CanApply(r), unter.ErrQuoteExpired)
+}
+
+var coversCases = []struct {
+	name     string
+	pickup   geo.Point
+	dropoff  geo.Point
+	distance float64
+	ok       bool
+}{
+	{"quoted", geo.Point{Lat: 32.08, Lon: 34.78}, geo.Point{Lat: 32.11, Lon: 34.80}, 3, true},
+	{"near", geo.Point{Lat: 32.083, Lon: 34.78}, geo.Point{Lat: 32.11, Lon: 34.803}, 3.5, true},
+	{"far pickup", geo.Point{Lat: 32.00, Lon: 34.78}, geo.Point{Lat: 32.11, Lon: 34.80}, 3, false},
+	{"far drop-off", geo.Point{Lat: 32.08, Lon: 34.78}, geo.Point{Lat: 32.31, Lon: 34.80}, 3, false},
+	{"long", geo.Point{Lat: 32.08, Lon: 34.78}, geo.Point{Lat: 32.11, Lon: 34.80}, 10, false},
+}
+
+func TestQuoteCovers(t *testing.T) {
+	q := unter.Quote{
+		From:     geo.Point{Lat: 32.08, Lon: 34.78},
+		To:       geo.Point{Lat: 32.11, Lon: 34.80},
+		Distance: 3,
+	}
+	for _, tc := range coversCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := q.Covers(tc.pickup, tc.dropoff, tc.distance)
+			if tc.ok {
+				require.NoError(t, err)
+			} else {
+				require.ErrorIs(t, err, unter.ErrQuoteRoute)
+			}
+		})
+	}
+}
+
+func TestRideFareCap(t *testing.T) {
+	require := require.New(t)
+
+	r := ride(unter.Private, 3*time.Minute, 3)
+	f := unter.RideFare(r, unter.Extras{Cap: 700, TaxRate: 0.1})
+	require.Equal(50, f.QuoteDiscount)
+	require.Equal(700, f.Fare())
+	require.Equal(770, f.Total)
+	require.Equal(f, unter.RideFare(r, f.Extras()))
+
+	f = unter.RideFare(r, unter.Extras{Cap: 1000})
+	require.Equal(0, f.QuoteDiscount)
+
+	// Shared, only the quote rider leg is capped
+	r = sharedRide(4, [3]float64{0, 10, 4}, [3]float64{2, 4, 1})
+	f = unter.RideFare(r, unter.Extras{Cap: 150, CapRider: "r1"})
+	require.Equal([]int{800, 150}, f.Legs)
+	require.Equal(50, f.QuoteDiscount)
+	require.Equal(950, f.Fare())
+}
@@ -0,0 +1,226 @@
+// Package events distributes ride events to subscribers across replicas.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+type Type string
+
+const (
+	RideStarted   Type = "ride.started"
+	RideEnded     Type = "ride.ended"
+	RideCancelled Type = "ride.cancelled"
+)
+
+// Types are all the event types.
+var Types = []Type{RideStarted, RideEnded, RideCancelled}
+
+type Event struct {
+	ID int64 `json:"id"`
+	// DedupID is the same for redeliveries of the same event
+	DedupID string    `json:"dedup_id,omitempty"`
+	Type    Type      `json:"type"`
+	RideID  string    `json:"ride_id"`
+	Driver  string    `json:"driver"`
+	Riders  []string  `json:"riders,omitempty"` // logins
+	Time    time.Time `json:"time"`
+}
+
+// Subscription receives events matching its filter.
+type Subscription struct {
+	ch     chan Event
+	filter func(Event) bool
+	once   sync.Once
+}
+
+// C returns the events channel, it's closed when the subscription ends
+// (Close, broker closed or subscriber too slow).
+func (s *Subscription) C() <-chan Event {
+	return s.ch
+}
+
+func (s *Subscription) close() {
+	s.once.Do(func() { close(s.ch) })
+}
+
+// Broker fans out events to local subscribers and keeps recent events so
+// clients can resume from the last event they saw.
+type Broker struct {
+	mu      sync.Mutex
+	subs    map[*Subscription]bool
+	history []Event // ring buffer, oldest first
+	size    int
+	closed  bool
+	bufSize int
+}
+
+func NewBroker(historySize int) *Broker {
+	return &Broker{
+		subs:    make(map[*Subscription]bool),
+		size:    historySize,
+		bufSize: 64,
+	}
+}
+
+// Deliver sends e to all matching subscribers. Subscribers that can't keep up
+// are dropped.
+func (b *Broker) Deliver(e Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return
+	}
+
+	b.history = append(b.history, e)
+	if len(b.history) > b.size {
+		b.history = b.history[len(b.history)-b.size:]
+	}
+
+	for s := range b.subs {
+		if s.filter != nil && !s.filter(e) {
+			continue
+		}
+		select {
+		case s.ch <- e:
+		default: // too slow
+			delete(b.subs, s)
+			s.close()
+		}
+	}
+}
+
+// Subscribe returns a new subscription and the events after lastID that
+// match filter (lastID 0 means no replay). filter can be nil.
+func (b *Broker) Subscribe(lastID int64, filter func(Event) bool) (*Subscription, []Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s := Subscription{
+		ch:     make(chan Event, b.bufSize),
+		filter: filter,
+	}
+	if b.closed {
+		s.close()
+		return &s, nil
+	}
+	b.subs[&s] = true
+
+	var missed []Event
+	if lastID > 0 {
+		for _, e := range b.history {
+			if e.ID > lastID && (filter == nil || filter(e)) {
+				missed = append(missed, e)
+			}
+		}
+	}
+
+	return &s, missed
+}
+
+// Unsubscribe ends s.
+func (b *Broker) Unsubscribe(s *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.subs, s)
+	s.close()
+}
+
+// Close ends all subscriptions, used on shutdown.
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for s := range b.subs {
+		s.close()
+	}
+	b.subs = make(map[*Subscription]bool)
+}
+
+// PubSub is a message bus shared by all replicas (e.g. redis).
+type PubSub interface {
+	Publish(ctx context.Context, channel string, data []byte) error
+	// Subscribe returns a channel of messages, closed when ctx is done.
+	Subscribe(ctx context.Context, channel string) (<-chan []byte, error)
+	// Incr returns the next value of a global counter.
+	Incr(ctx context.Context, key string) (int64, error)
+}
+
+// Bus publishes events to all replicas, and delivers events from all
+// replicas to the local broker.
+type Bus struct {
+	ps      PubSub
+	broker  *Broker
+	channel string
+}
+
+const (
+	defaultChannel = "unter:events"
+	idKey          = "unter:events:id"
+)
+
+func NewBus(ps PubSub, broker *Broker) *Bus {
+	return &Bus{
+		ps:      ps,
+		broker:  broker,
+		channel: defaultChannel,
+	}
+}
+
+func (b *Bus) Broker() *Broker {
+	return b.broker
+}
+
+// Publish publishes e and returns the published event. Events without an ID
+// (e.g. not from the outbox) get a global one.
+func (b *Bus) Publish(ctx context.Context, e Event) (Event, error) {
+	if e.ID == 0 {
+		id, err := b.ps.Incr(ctx, idKey)
+		if err != nil {
+			return Event{}, fmt.Errorf("event ID: %w", err)
+		}
+		e.ID = id
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return Event{}, err
+	}
+
+	if err := b.ps.Publish(ctx, b.channel, data); err != nil {
+		return Event{}, err
+	}
+	return e, nil
+}
+
+// Run delivers published events to the broker until ctx is done.
+// Bad messages are passed to onError (which can be nil).
+func (b *Bus) Run(ctx context.Context, onError func(error)) error {
+	msgs, err := b.ps.Subscribe(ctx, b.channel)
+	if err != nil {
+		return err
+	}
+
+	for data := range msgs {
+		var e Event
+		if err := json.Unmarshal(data, &e); err != nil {
+			if onError != nil {
+				onError(fmt.Errorf("bad event: %w", err))
+			}
+			continue
+		}
+		b.broker.Deliver(e)
+	}
+
+	return ctx.Err()
+}
@@ -0,0 +1,134 @@
+package events
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBrokerReplay(t *testing.T) {
+	require := require.New(t)
+
+	b := NewBroker(3)
+	for i := int64(1); i <= 5; i++ {
+		b.Deliver(Event{ID: i, Type: RideStarted, Driver: "Bond"})
+	}
+
+	// Only the last 3 are kept
+	_, missed := b.Subscribe(1, nil)
+	require.Len(missed, 3)
+	require.Equal(int64(3), missed[0].ID)
+
+	_, missed = b.Subscribe(4, nil)
+	require.Len(missed, 1)
+	require.Equal(int64(5), missed[0].ID)
+
+	_, missed = b.Subscribe(0, nil)
+	require.Empty(missed)
+}
+
+func TestBrokerFilter(t *testing.T) {
+	require := require.New(t)
+
+	b := NewBroker(10)
+	sub, _ := b.Subscribe(0, func(e Event) bool { return e.Driver == "Bond" })
+	b.Deliver(Event{ID: 1, Driver: "Q"})
+	b.Deliver(Event{ID: 2, Driver: "Bond"})
+
+	e := <-sub.C()
+	require.Equal(int64(2), e.ID)
+
+	b.Close()
+	_, ok := <-sub.C()
+	require.False(ok, "closed")
+}
+
+func TestBrokerSlow(t *testing.T) {
+	b := NewBroker(10)
+	sub, _ := b.Subscribe(0, nil)
+	for i := 0; i < b.bufSize+1; i++ {
+		b.Deliver(Event{ID: int64(i + 1)})
+	}
+
+	n := 0
+	for range sub.C() {
+		n++
+	}
+	require.Equal(t, b.bufSize, n)
+}
+
+// memPubSub is an in memory PubSub.
+type memPubSub struct {
+	mu   sync.Mutex
+	id   int64
+	subs []chan []byte
+}
+
+func (m *memPubSub) Publish(ctx context.Context, channel string, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, ch := range m.subs {
+		ch <- data
+	}
+	return nil
+}
+
+func (m *memPubSub) Subscribe(ctx context.Context, channel string) (<-chan []byte, error) {
+	ch := make(chan []byte, 10)
+	m.mu.Lock()
+	m.subs = append(m.subs, ch)
+	m.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		close(ch)
+	}()
+	return ch, nil
+}
+
+func (m *memPubSub) Incr(ctx context.Context, key string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.id++
+	return m.id, nil
+}
+
+func TestBus(t *testing.T) {
+	require := require.New(t)
+
+	// Two replicas on the same pub/sub
+	var ps memPubSub
+	b1, b2 := NewBus(&ps, NewBroker(10)), NewBus(&ps, NewBroker(10))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sub, _ := b2.Broker().Subscribe(0, nil)
+	for _, b := range []*Bus{b1, b2} {
+		b := b
+		go b.Run(ctx, nil) //#nosec G104
+	}
+	require.Eventually(func() bool {
+		ps.mu.Lock()
+		defer ps.mu.Unlock()
+		return len(ps.subs) == 2
+	}, time.Second, 10*time.Millisecond)
+
+	pub, err := b1.Publish(ctx, Event{Type: RideEnded, RideID: "r1", Driver: "Bond"})
+	require.NoError(err)
+	require.Equal(int64(1), pub.ID)
+
+	select {
+	case e := <-sub.C():
+		require.Equal(int64(1), e.ID)
+		require.Equal(RideEnded, e.Type)
+		require.Equal("r1", e.RideID)
+		require.False(e.Time.IsZero())
+	case <-time.After(time.Second):
+		require.Fail("timeout")
+	}
+}
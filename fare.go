@@ -0,0 +1,184 @@
+package unter
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// FeeComponent is a part of the ride fee, the fee is the largest component.
+type FeeComponent uint8
+
+const (
+	MinimumFee FeeComponent = iota + 1
+	DistanceFee
+	TimeFee
+)
+
+// String implement fmt.Stringer
+func (c FeeComponent) String() string {
+	switch c {
+	case MinimumFee:
+		return "minimum"
+	case DistanceFee:
+		return "distance"
+	case TimeFee:
+		return "time"
+	}
+
+	return fmt.Sprintf("<FeeComponent %d>", c)
+}
+
+// Surcharge is a named charge on top of the fee (booking fee, airport ...).
+type Surcharge struct {
+	Name   string
+	Amount int // ¢
+}
+
+// Extras are charges on top of the ride fare.
+type Extras struct {
+	Surcharges []Surcharge
+	Tip        int     // ¢, not taxed
+	TaxRate    float64 // of the fare and surcharges
+
+	// Quoted maximum fare (see Quote), 0 for none. On shared rides with legs
+	// it caps the leg of CapRider.
+	Cap      int
+	CapRider string
+}
+
+func (x Extras) Validate() error {
+	for _, s := range x.Surcharges {
+		if s.Name == "" || s.Amount < 0 {
+			return fmt.Errorf("bad surcharge: %+v", s)
+		}
+	}
+
+	if x.Tip < 0 {
+		return fmt.Errorf("negative tip: %d", x.Tip)
+	}
+
+	if x.TaxRate < 0 || x.TaxRate >= 1 {
+		return fmt.Errorf("tax rate %f out of range [0,1)", x.TaxRate)
+	}
+
+	if x.Cap < 0 {
+		return fmt.Errorf("negative cap: %d", x.Cap)
+	}
+
+	return nil
+}
+
+// FareBreakdown itemizes a ride fare, amounts are in ¢.
+type FareBreakdown struct {
+	// Fee components, the ride alone
+	Minimum  int
+	Distance int
+	Time     int // by whole hours
+	Winner   FeeComponent
+	Fee      int // the Winner component
+
+	SharedDiscount int
+	Cap            int // quoted maximum, see Extras
+	CapRider       string
+	QuoteDiscount  int   // over Cap
+	Legs           []int // shared ride leg fares, they add up to Fare
+
+	Surcharges []Surcharge
+	Tip        int
+	TaxRate    float64
+	Tax        int
+	Total      int
+}
+
+// Fare returns the ride fare before extras.
+func (f FareBreakdown) Fare() int {
+	return f.Fee - f.SharedDiscount - f.QuoteDiscount
+}
+
+// Extras returns the extras f was priced with, RideFare(r, f.Extras())
+// reproduces f.
+func (f FareBreakdown) Extras() Extras {
+	return Extras{
+		Surcharges: append([]Surcharge(nil), f.Surcharges...),
+		Tip:        f.Tip,
+		TaxRate:    f.TaxRate,
+		Cap:        f.Cap,
+		CapRider:   f.CapRider,
+	}
+}
+
+// feeBreakdown returns the fee components of a ride alone with the shared
+// discount.
+func feeBreakdown(duration time.Duration, distance float64, shared bool) FareBreakdown {
+	m := perMile * distance
+	h := perHour * float64(duration/time.Minute/60)
+
+	f := FareBreakdown{
+		Minimum:  minFee,
+		Distance: int(m),
+		Time:     int(h),
+		Winner:   MinimumFee,
+	}
+	fee := float64(minFee)
+	if m > fee {
+		fee, f.Winner = m, DistanceFee
+	}
+	if h > fee {
+		fee, f.Winner = h, TimeFee
+	}
+
+	f.Fee = int(fee)
+	if shared {
+		f.SharedDiscount = f.Fee - int(sharedRate*fee)
+	}
+	return f
+}
+
+// RideFare returns the itemized fare of an ended ride. Shared rides with legs
+// are the sum of the leg fares (see SplitFare).
+func RideFare(r Ride, x Extras) FareBreakdown {
+	f := feeBreakdown(r.End.Sub(r.Start), r.Distance, r.Kind == Shared)
+	if r.Kind == Shared && len(r.Legs) > 0 {
+		f.Legs = SplitFare(r)
+		paid := 0
+		for _, fare := range f.Legs {
+			paid += fare
+		}
+		f.SharedDiscount = f.Fee - paid
+	}
+	f.Cap, f.CapRider = x.Cap, x.CapRider
+	f.applyCap(r.Legs)
+
+	f.Surcharges = append([]Surcharge(nil), x.Surcharges...)
+	f.Tip, f.TaxRate = x.Tip, x.TaxRate
+
+	taxable := f.Fare()
+	for _, s := range f.Surcharges {
+		taxable += s.Amount
+	}
+	f.Tax = int(math.Round(float64(taxable) * f.TaxRate))
+	f.Total = taxable + f.Tax + f.Tip
+	return f
+}
+
+// applyCap lowers the fare, or the leg fare of CapRider, to Cap.
+func (f *FareBreakdown) applyCap(legs []Leg) {
+	if f.Cap == 0 {
+		return
+	}
+
+	if len(f.Legs) == 0 {
+		if over := f.Fare() - f.Cap; over > 0 {
+			f.QuoteDiscount = over
+		}
+		return
+	}
+
+	for i, l := range legs {
+		if l.Rider == f.CapRider && f.Legs[i] > f.Cap {
+			f.QuoteDiscount = f.Legs[i] - f.Cap
+			f.Legs[i] = f.Cap
+		}
+	}
+}
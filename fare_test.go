@@ -0,0 +1,97 @@
+package unter_test
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/353solutions/unter"
+)
+
+// ride returns an ended ride starting at now.
+func ride(kind unter.Kind, duration time.Duration, distance float64) unter.Ride {
+	return unter.Ride{
+		ID:       unter.NewID(),
+		Driver:   "Bond",
+		Kind:     kind,
+		Start:    now,
+		End:      now.Add(duration),
+		Distance: distance,
+	}
+}
+
+var rideFareCases = []struct {
+	ride     unter.Ride
+	winner   unter.FeeComponent
+	fee      int
+	discount int
+}{
+	{ride(unter.Private, time.Second, 0.1), unter.MinimumFee, minFee, 0},
+	{ride(unter.Private, 3*time.Minute, 3), unter.DistanceFee, 750, 0},
+	{ride(unter.Private, 7*time.Hour, 3), unter.TimeFee, 7 * perHour, 0},
+	{ride(unter.Shared, 3*time.Minute, 3), unter.DistanceFee, 750, 75},
+}
+
+func TestRideFare(t *testing.T) {
+	for _, tc := range rideFareCases {
+		name := fmt.Sprintf("%s/%v/%v", tc.ride.Kind, tc.ride.End.Sub(tc.ride.Start), tc.ride.Distance)
+		t.Run(name, func(t *testing.T) {
+			f := unter.RideFare(tc.ride, unter.Extras{})
+			require.Equal(t, tc.winner, f.Winner)
+			require.Equal(t, tc.fee, f.Fee)
+			require.Equal(t, tc.discount, f.SharedDiscount)
+			require.Equal(t, f.Fare(), f.Total)
+		})
+	}
+}
+
+func TestRideFareMatchesRideFee(t *testing.T) {
+	rnd := rand.New(rand.NewSource(7)) //#nosec G404
+	for i := 0; i < 10_000; i++ {
+		k := unter.Kind(rnd.Intn(2) + 1)
+		r := ride(k, time.Duration(rnd.Intn(300))*time.Minute, rnd.Float64()*100)
+		f := unter.RideFare(r, unter.Extras{})
+		fee := unter.RideFee(r.End.Sub(r.Start), r.Distance, k == unter.Shared)
+		require.Equal(t, fee, f.Fare(), "%+v", r)
+	}
+}
+
+func TestRideFareExtras(t *testing.T) {
+	require := require.New(t)
+
+	x := unter.Extras{
+		Surcharges: []unter.Surcharge{{"booking", 99}},
+		Tip:        200,
+		TaxRate:    0.17,
+	}
+	require.NoError(x.Validate())
+
+	r := ride(unter.Private, 3*time.Minute, 3)
+	f := unter.RideFare(r, x)
+	require.Equal(144, f.Tax) // (750 + 99) * 0.17 = 144.33
+	require.Equal(750+99+144+200, f.Total)
+
+	// Reproducible
+	require.Equal(f, unter.RideFare(r, f.Extras()))
+
+	x.Tip = -1
+	require.Error(x.Validate())
+}
+
+func TestRideFareLegs(t *testing.T) {
+	require := require.New(t)
+
+	r := sharedRide(4, [3]float64{0, 10, 4}, [3]float64{2, 4, 1})
+	f := unter.RideFare(r, unter.Extras{})
+	require.Equal(unter.SplitFare(r), f.Legs)
+
+	paid := 0
+	for _, fare := range f.Legs {
+		paid += fare
+	}
+	require.Equal(paid, f.Fare())
+	require.GreaterOrEqual(f.SharedDiscount, 0)
+}
@@ -0,0 +1,106 @@
+// Package geo computes distances from GPS points.
+package geo
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+const earthRadius = 3958.8 // miles
+
+type Point struct {
+	Lat  float64   `json:"lat"`
+	Lon  float64   `json:"lon"`
+	Time time.Time `json:"time"`
+}
+
+func (p Point) Validate() error {
+	if math.IsNaN(p.Lat) || p.Lat < -90 || p.Lat > 90 {
+		return fmt.Errorf("bad latitude: %v", p.Lat)
+	}
+	if math.IsNaN(p.Lon) || p.Lon < -180 || p.Lon > 180 {
+		return fmt.Errorf("bad longitude: %v", p.Lon)
+	}
+	if p.Time.IsZero() {
+		return fmt.Errorf("missing time")
+	}
+	return nil
+}
+
+func radians(deg float64) float64 {
+	return deg * math.Pi / 180
+}
+
+// Haversine returns the great-circle distance between a and b in miles.
+func Haversine(a, b Point) float64 {
+	lat1, lat2 := radians(a.Lat), radians(b.Lat)
+	dLat := lat2 - lat1
+	dLon := radians(b.Lon - a.Lon)
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// Track is the result of Distance.
+type Track struct {
+	Distance float64 // miles
+	Used     int     // points used
+	Dropped  int     // invalid, duplicate or outlier points
+}
+
+// Distance returns the distance along points (in any order). Points that
+// would require moving faster than maxSpeed (mph) from the previous accepted
+// point are GPS jumps and are dropped. A leading point that's a jump from its
+// successor, while the successor agrees with the point after it, is dropped
+// so a bad first fix won't drop the whole track.
+func Distance(points []Point, maxSpeed float64) Track {
+	pts := make([]Point, 0, len(points))
+	var t Track
+	for _, p := range points {
+		if p.Validate() != nil {
+			t.Dropped++
+			continue
+		}
+		pts = append(pts, p)
+	}
+	sort.SliceStable(pts, func(i, j int) bool { return pts[i].Time.Before(pts[j].Time) })
+
+	possible := func(a, b Point) bool {
+		dt := b.Time.Sub(a.Time).Hours()
+		return dt > 0 && Haversine(a, b)/dt <= maxSpeed
+	}
+	for len(pts) > 2 && !possible(pts[0], pts[1]) && possible(pts[1], pts[2]) {
+		pts = pts[1:]
+		t.Dropped++
+	}
+
+	var last Point
+	for i, p := range pts {
+		if i == 0 {
+			last = p
+			t.Used++
+			continue
+		}
+
+		dt := p.Time.Sub(last.Time).Hours()
+		if dt <= 0 { // same timestamp
+			t.Dropped++
+			continue
+		}
+
+		d := Haversine(last, p)
+		if d/dt > maxSpeed {
+			t.Dropped++
+			continue
+		}
+
+		t.Distance += d
+		t.Used++
+		last = p
+	}
+
+	return t
+}
@@ -0,0 +1,85 @@
+package geo
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	sf = Point{Lat: 37.7749, Lon: -122.4194}
+	la = Point{Lat: 34.0522, Lon: -118.2437}
+)
+
+var haversineCases = []struct {
+	a, b     Point
+	expected float64
+}{
+	{sf, sf, 0},
+	{sf, la, 347.4},
+	{Point{0, 0, time.Time{}}, Point{0, 1, time.Time{}}, 69.1},
+}
+
+func TestHaversine(t *testing.T) {
+	for _, tc := range haversineCases {
+		name := fmt.Sprintf("%v->%v", tc.a, tc.b)
+		t.Run(name, func(t *testing.T) {
+			require.InDelta(t, tc.expected, Haversine(tc.a, tc.b), 0.5)
+			require.InDelta(t, tc.expected, Haversine(tc.b, tc.a), 0.5)
+		})
+	}
+}
+
+func TestDistance(t *testing.T) {
+	require := require.New(t)
+
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	at := func(lat, lon float64, min int) Point {
+		return Point{lat, lon, start.Add(time.Duration(min) * time.Minute)}
+	}
+	// ~0.69 miles per 0.01 degree longitude at the equator
+	points := []Point{
+		at(0, 0.02, 2), // out of order
+		at(0, 0, 0),
+		at(0, 0.01, 1),
+		at(10, 10, 2),  // jump
+		at(0, 0.02, 2), // duplicate time
+		at(91, 0, 3),   // invalid
+		at(0, 0.03, 3),
+	}
+
+	tr := Distance(points, 120)
+	require.InDelta(3*0.691, tr.Distance, 0.01)
+	require.Equal(4, tr.Used)
+	require.Equal(3, tr.Dropped)
+
+	require.Zero(Distance(nil, 120).Distance)
+}
+
+func TestDistanceFirstOutlier(t *testing.T) {
+	require := require.New(t)
+
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	at := func(lat, lon float64, min int) Point {
+		return Point{lat, lon, start.Add(time.Duration(min) * time.Minute)}
+	}
+	points := []Point{
+		at(10, 10, 0), // bad first fix
+		at(0, 0, 1),
+		at(0, 0.01, 2),
+		at(0, 0.02, 3),
+	}
+
+	tr := Distance(points, 120)
+	require.InDelta(2*0.691, tr.Distance, 0.01)
+	require.Equal(3, tr.Used)
+	require.Equal(1, tr.Dropped)
+
+	// Jump on the second point keeps the first
+	points[0], points[1] = at(0, 0, 0), at(10, 10, 1)
+	tr = Distance(points, 120)
+	require.InDelta(2*0.691, tr.Distance, 0.01)
+	require.Equal(3, tr.Used)
+}
@@ -0,0 +1,220 @@
+package geo
+
+import (
+	"math"
+	"sort"
+	"sync"
+)
+
+const geohashBase32 = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// Geohash returns the geohash of lat/lon with precision characters.
+func Geohash(lat, lon float64, precision int) string {
+	latMin, latMax := -90.0, 90.0
+	lonMin, lonMax := -180.0, 180.0
+
+	hash := make([]byte, 0, precision)
+	even := true // longitude first
+	bit, ch := 0, 0
+	for len(hash) < precision {
+		if even {
+			mid := (lonMin + lonMax) / 2
+			if lon >= mid {
+				ch |= 1 << (4 - bit)
+				lonMin = mid
+			} else {
+				lonMax = mid
+			}
+		} else {
+			mid := (latMin + latMax) / 2
+			if lat >= mid {
+				ch |= 1 << (4 - bit)
+				latMin = mid
+			} else {
+				latMax = mid
+			}
+		}
+		even = !even
+
+		if bit < 4 {
+			bit++
+			continue
+		}
+		hash = append(hash, geohashBase32[ch])
+		bit, ch = 0, 0
+	}
+	return string(hash)
+}
+
+// cellSize returns the height and width (degrees) of a geohash cell.
+func cellSize(precision int) (float64, float64) {
+	bits := 5 * precision
+	lonBits := (bits + 1) / 2
+	latBits := bits / 2
+	return 180 / math.Exp2(float64(latBits)), 360 / math.Exp2(float64(lonBits))
+}
+
+// milesPerDegree is the length of a latitude degree.
+const milesPerDegree = earthRadius * math.Pi / 180
+
+// maxScanCells is the number of cells above which Nearest scans everything.
+const maxScanCells = 1024
+
+// Neighbor is a result of Index.Nearest.
+type Neighbor struct {
+	ID       string
+	Point    Point
+	Distance float64 // miles
+}
+
+// Index is an in-memory index of points by ID. Points are bucketed by
+// geohash so nearest lookups only look at cells around the query.
+type Index struct {
+	mu        sync.RWMutex
+	precision int
+	cells     map[string]map[string]Point // geohash -> id -> point
+	ids       map[string]string           // id -> geohash
+}
+
+// NewIndex returns an index with geohash cells of precision characters, 6 is
+// about 0.75x0.38 miles.
+func NewIndex(precision int) *Index {
+	ix := Index{
+		precision: precision,
+		cells:     make(map[string]map[string]Point),
+		ids:       make(map[string]string),
+	}
+	return &ix
+}
+
+// Set adds or moves id to p.
+func (ix *Index) Set(id string, p Point) {
+	hash := Geohash(p.Lat, p.Lon, ix.precision)
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	ix.remove(id)
+	cell, ok := ix.cells[hash]
+	if !ok {
+		cell = make(map[string]Point)
+		ix.cells[hash] = cell
+	}
+	cell[id] = p
+	ix.ids[id] = hash
+}
+
+// Remove removes id from the index, it's a no-op if id is not in the index.
+func (ix *Index) Remove(id string) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	ix.remove(id)
+}
+
+func (ix *Index) remove(id string) {
+	hash, ok := ix.ids[id]
+	if !ok {
+		return
+	}
+	delete(ix.ids, id)
+	delete(ix.cells[hash], id)
+	if len(ix.cells[hash]) == 0 {
+		delete(ix.cells, hash)
+	}
+}
+
+// Get returns the point of id.
+func (ix *Index) Get(id string) (Point, bool) {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	hash, ok := ix.ids[id]
+	if !ok {
+		return Point{}, false
+	}
+	return ix.cells[hash][id], true
+}
+
+func (ix *Index) Len() int {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	return len(ix.ids)
+}
+
+// Nearest returns up to k points within radius (miles) of lat/lon, nearest
+// first. Points where skip returns true are ignored, skip can be nil.
+func (ix *Index) Nearest(lat, lon, radius float64, k int, skip func(id string, p Point) bool) []Neighbor {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	var out []Neighbor
+	add := func(cell map[string]Point) {
+		for id, p := range cell {
+			if skip != nil && skip(id, p) {
+				continue
+			}
+			d := Haversine(Point{Lat: lat, Lon: lon}, p)
+			if d > radius {
+				continue
+			}
+			out = append(out, Neighbor{id, p, d})
+		}
+	}
+
+	for _, hash := range ix.scanCells(lat, lon, radius) {
+		add(ix.cells[hash])
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Distance != out[j].Distance {
+			return out[i].Distance < out[j].Distance
+		}
+		return out[i].ID < out[j].ID
+	})
+	if len(out) > k {
+		out = out[:k]
+	}
+	return out
+}
+
+// scanCells returns the cells that can hold points within radius of lat/lon.
+func (ix *Index) scanCells(lat, lon, radius float64) []string {
+	h, w := cellSize(ix.precision)
+	dLat := radius / milesPerDegree
+	dLon := 360.0
+	if c := math.Cos(radians(lat)); c > 0.01 {
+		dLon = math.Min(dLon, dLat/c)
+	}
+	nLat, nLon := int(math.Ceil(dLat/h)), int(math.Ceil(dLon/w))
+
+	if (2*nLat+1)*(2*nLon+1) > maxScanCells || (2*nLat+1)*(2*nLon+1) > 2*len(ix.cells) {
+		hashes := make([]string, 0, len(ix.cells))
+		for hash := range ix.cells {
+			hashes = append(hashes, hash)
+		}
+		return hashes
+	}
+
+	seen := make(map[string]bool)
+	var hashes []string
+	for i := -nLat; i <= nLat; i++ {
+		clat := lat + float64(i)*h
+		if clat < -90 || clat > 90 {
+			continue
+		}
+		for j := -nLon; j <= nLon; j++ {
+			clon := math.Mod(lon+float64(j)*w+540, 360) - 180 // wrap
+			hash := Geohash(clat, clon, ix.precision)
+			if seen[hash] {
+				continue
+			}
+			seen[hash] = true
+			if _, ok := ix.cells[hash]; ok {
+				hashes = append(hashes, hash)
+			}
+		}
+	}
+	return hashes
+}
@@ -0,0 +1,75 @@
+package geo
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var geohashCases = []struct {
+	lat, lon  float64
+	precision int
+	hash      string
+}{
+	{42.6, -5.6, 5, "ezs42"},
+	{57.64911, 10.40744, 11, "u4pruydqqvj"},
+}
+
+func TestGeohash(t *testing.T) {
+	for _, tc := range geohashCases {
+		t.Run(tc.hash, func(t *testing.T) {
+			require.Equal(t, tc.hash, Geohash(tc.lat, tc.lon, tc.precision))
+		})
+	}
+}
+
+func TestIndexNearest(t *testing.T) {
+	require := require.New(t)
+
+	// Random points around Tel Aviv
+	rnd := rand.New(rand.NewSource(7)) //#nosec G404
+	ix := NewIndex(6)
+	points := make(map[string]Point)
+	for i := 0; i < 500; i++ {
+		id := fmt.Sprintf("d%03d", i)
+		p := Point{Lat: 32 + rnd.Float64()*0.2, Lon: 34.7 + rnd.Float64()*0.2}
+		ix.Set(id, p)
+		points[id] = p
+	}
+	// Moving keeps one entry
+	ix.Set("d000", points["d000"])
+	require.Equal(len(points), ix.Len())
+
+	center := Point{Lat: 32.1, Lon: 34.8}
+	var expected []string
+	for id, p := range points {
+		if Haversine(center, p) <= 1 {
+			expected = append(expected, id)
+		}
+	}
+	sort.Slice(expected, func(i, j int) bool {
+		return Haversine(center, points[expected[i]]) < Haversine(center, points[expected[j]])
+	})
+	require.NotEmpty(expected)
+
+	out := ix.Nearest(center.Lat, center.Lon, 1, 5, nil)
+	require.Len(out, 5)
+	for i, n := range out {
+		require.Equal(expected[i], n.ID)
+	}
+
+	skip := func(id string, p Point) bool { return id == expected[0] }
+	out = ix.Nearest(center.Lat, center.Lon, 1, 1, skip)
+	require.Equal(expected[1], out[0].ID)
+
+	ix.Remove(expected[0])
+	_, ok := ix.Get(expected[0])
+	require.False(ok)
+	out = ix.Nearest(center.Lat, center.Lon, 1, len(points), nil)
+	require.Len(out, len(expected)-1)
+
+	require.Empty(ix.Nearest(0, 0, 10, 5, nil))
+}
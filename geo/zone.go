@@ -0,0 +1,234 @@
+package geo
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+)
+
+// Ring is a closed polygon ring of [lon, lat] positions (GeoJSON order).
+type Ring [][2]float64
+
+// Polygon is an outer ring followed by holes.
+type Polygon []Ring
+
+type BBox struct {
+	MinLat, MinLon, MaxLat, MaxLon float64
+}
+
+func (b BBox) Contains(lat, lon float64) bool {
+	return lat >= b.MinLat && lat <= b.MaxLat && lon >= b.MinLon && lon <= b.MaxLon
+}
+
+func ringBBox(r Ring) BBox {
+	b := BBox{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+	for _, p := range r {
+		b.MinLon, b.MaxLon = math.Min(b.MinLon, p[0]), math.Max(b.MaxLon, p[0])
+		b.MinLat, b.MaxLat = math.Min(b.MinLat, p[1]), math.Max(b.MaxLat, p[1])
+	}
+	return b
+}
+
+// inRing uses ray casting, points on the edge may go either way.
+func inRing(r Ring, lat, lon float64) bool {
+	in := false
+	for i, j := 0, len(r)-1; i < len(r); j, i = i, i+1 {
+		xi, yi := r[i][0], r[i][1]
+		xj, yj := r[j][0], r[j][1]
+		if (yi > lat) != (yj > lat) && lon < (xj-xi)*(lat-yi)/(yj-yi)+xi {
+			in = !in
+		}
+	}
+	return in
+}
+
+// ringArea returns the planar area in square degrees, good enough to order
+// zones by size.
+func ringArea(r Ring) float64 {
+	var a float64
+	for i, j := 0, len(r)-1; i < len(r); j, i = i, i+1 {
+		a += (r[j][0] + r[i][0]) * (r[j][1] - r[i][1])
+	}
+	return math.Abs(a / 2)
+}
+
+type polygon struct {
+	Polygon
+	bbox BBox
+}
+
+func (p polygon) contains(lat, lon float64) bool {
+	if !p.bbox.Contains(lat, lon) || !inRing(p.Polygon[0], lat, lon) {
+		return false
+	}
+	for _, hole := range p.Polygon[1:] {
+		if inRing(hole, lat, lon) {
+			return false
+		}
+	}
+	return true
+}
+
+type Zone struct {
+	ID   string
+	Name string
+
+	polygons []polygon
+	bbox     BBox
+	area     float64
+}
+
+// Contains returns true if lat/lon is in z.
+func (z *Zone) Contains(lat, lon float64) bool {
+	if !z.bbox.Contains(lat, lon) {
+		return false
+	}
+	for _, p := range z.polygons {
+		if p.contains(lat, lon) {
+			return true
+		}
+	}
+	return false
+}
+
+func newZone(id, name string, polygons []Polygon) (*Zone, error) {
+	z := Zone{
+		ID:   id,
+		Name: name,
+		bbox: BBox{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)},
+	}
+	for _, p := range polygons {
+		if len(p) == 0 || len(p[0]) < 4 {
+			return nil, fmt.Errorf("zone %q: polygon needs at least 4 positions", id)
+		}
+		b := ringBBox(p[0])
+		z.polygons = append(z.polygons, polygon{p, b})
+		z.bbox.MinLat, z.bbox.MinLon = math.Min(z.bbox.MinLat, b.MinLat), math.Min(z.bbox.MinLon, b.MinLon)
+		z.bbox.MaxLat, z.bbox.MaxLon = math.Max(z.bbox.MaxLat, b.MaxLat), math.Max(z.bbox.MaxLon, b.MaxLon)
+		z.area += ringArea(p[0])
+	}
+	if len(z.polygons) == 0 {
+		return nil, fmt.Errorf("zone %q: no polygons", id)
+	}
+	return &z, nil
+}
+
+// Zones is a set of zones. Zones can overlap (e.g. an airport in a city),
+// Lookup returns the smallest one.
+type Zones struct {
+	zones []*Zone // by area, smallest first
+}
+
+func NewZones(zones ...*Zone) *Zones {
+	zs := Zones{zones: zones}
+	sort.SliceStable(zs.zones, func(i, j int) bool { return zs.zones[i].area < zs.zones[j].area })
+	return &zs
+}
+
+// Lookup returns the most specific zone containing lat/lon.
+func (zs *Zones) Lookup(lat, lon float64) (*Zone, bool) {
+	for _, z := range zs.zones {
+		if z.Contains(lat, lon) {
+			return z, true
+		}
+	}
+	return nil, false
+}
+
+func (zs *Zones) Len() int {
+	return len(zs.zones)
+}
+
+/* GeoJSON
+
+A FeatureCollection of Polygon or MultiPolygon features, the zone ID is the
+"id" property (or the feature id) and the name is the "name" property.
+*/
+
+type feature struct {
+	ID         any            `json:"id"`
+	Properties map[string]any `json:"properties"`
+	Geometry   struct {
+		Type        string          `json:"type"`
+		Coordinates json.RawMessage `json:"coordinates"`
+	} `json:"geometry"`
+}
+
+// ReadZones reads zones from a GeoJSON FeatureCollection.
+func ReadZones(r io.Reader) (*Zones, error) {
+	var fc struct {
+		Type     string    `json:"type"`
+		Features []feature `json:"features"`
+	}
+	if err := json.NewDecoder(r).Decode(&fc); err != nil {
+		return nil, err
+	}
+	if fc.Type != "FeatureCollection" {
+		return nil, fmt.Errorf("expected FeatureCollection, got %q", fc.Type)
+	}
+
+	seen := make(map[string]bool)
+	var zones []*Zone
+	for i, f := range fc.Features {
+		id := propString(f.Properties, "id")
+		if id == "" && f.ID != nil {
+			id = fmt.Sprint(f.ID)
+		}
+		if id == "" {
+			return nil, fmt.Errorf("feature %d: missing id", i)
+		}
+		if seen[id] {
+			return nil, fmt.Errorf("feature %d: duplicate id %q", i, id)
+		}
+		seen[id] = true
+
+		var polygons []Polygon
+		switch f.Geometry.Type {
+		case "Polygon":
+			var p Polygon
+			if err := json.Unmarshal(f.Geometry.Coordinates, &p); err != nil {
+				return nil, fmt.Errorf("zone %q: %w", id, err)
+			}
+			polygons = []Polygon{p}
+		case "MultiPolygon":
+			if err := json.Unmarshal(f.Geometry.Coordinates, &polygons); err != nil {
+				return nil, fmt.Errorf("zone %q: %w", id, err)
+			}
+		default:
+			return nil, fmt.Errorf("zone %q: unsupported geometry %q", id, f.Geometry.Type)
+		}
+
+		z, err := newZone(id, propString(f.Properties, "name"), polygons)
+		if err != nil {
+			return nil, err
+		}
+		zones = append(zones, z)
+	}
+
+	return NewZones(zones...), nil
+}
+
+func propString(props map[string]any, key string) string {
+	if v, ok := props[key]; ok && v != nil {
+		return fmt.Sprint(v)
+	}
+	return ""
+}
+
+// LoadZones loads zones from a GeoJSON file.
+func LoadZones(path string) (*Zones, error) {
+	file, err := os.Open(path) //#nosec G304
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	zs, err := ReadZones(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return zs, nil
+}
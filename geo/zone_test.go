@@ -0,0 +1,55 @@
+package geo
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var lookupCases = []struct {
+	lat, lon float64
+	zone     string
+}{
+	{32.05, 34.76, "tlv"},
+	{32.095, 34.775, "tlv-port"}, // inside tlv, smallest wins
+	{32.095, 34.795, ""},         // hole (park)
+	{32.00, 34.88, "tlv-airport"},
+	{31.992, 34.915, "tlv-airport"}, // second polygon
+	{31.998, 34.912, ""},            // outside the triangle, inside its bbox
+	{40.71, -74.00, ""},
+}
+
+func TestZonesLookup(t *testing.T) {
+	zs, err := LoadZones("testdata/zones.geojson")
+	require.NoError(t, err)
+	require.Equal(t, 3, zs.Len())
+
+	for _, tc := range lookupCases {
+		name := fmt.Sprintf("%v,%v", tc.lat, tc.lon)
+		t.Run(name, func(t *testing.T) {
+			z, ok := zs.Lookup(tc.lat, tc.lon)
+			if tc.zone == "" {
+				require.False(t, ok)
+				return
+			}
+			require.True(t, ok)
+			require.Equal(t, tc.zone, z.ID)
+		})
+	}
+}
+
+var badZonesCases = []string{
+	`{"type": "Feature"}`,
+	`{"type": "FeatureCollection", "features": [{"properties": {}, "geometry": {"type": "Polygon", "coordinates": [[[0,0],[1,0],[1,1],[0,0]]]}}]}`,
+	`{"type": "FeatureCollection", "features": [{"id": "a", "geometry": {"type": "Point", "coordinates": [0,0]}}]}`,
+	`{"type": "FeatureCollection", "features": [{"id": "a", "geometry": {"type": "Polygon", "coordinates": [[[0,0],[1,0],[0,0]]]}}]}`,
+}
+
+func TestReadZonesErrors(t *testing.T) {
+	for _, data := range badZonesCases {
+		_, err := ReadZones(strings.NewReader(data))
+		require.Error(t, err, data)
+	}
+}
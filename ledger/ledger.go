@@ -0,0 +1,270 @@
+// Package ledger records money movements as double-entry journal entries.
+//
+// An entry posts amounts (¢) to accounts, debits are positive and credits
+// negative. Every entry sums to zero so the ledger as a whole always
+// balances. Entries are immutable, a mistake or a refund is undone with a
+// reversal entry.
+//
+// Ended rides credit the driver payable account (see RideEntry), payouts debit
+// it and credit the platform bank.
+package ledger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type AccountType string
+
+const (
+	RiderReceivable AccountType = "rider_receivable" // riders owe the platform
+	CashReceivable  AccountType = "cash_receivable"  // fares of rides without riders
+	DriverPayable   AccountType = "driver_payable"   // the platform owes drivers
+	PlatformRevenue AccountType = "platform_revenue"
+	TaxPayable      AccountType = "tax_payable"
+	PlatformBank    AccountType = "platform_bank" // payouts are paid from it
+)
+
+// Account is an account ID, "type:owner" for rider and driver accounts.
+type Account string
+
+const (
+	Cash    = Account(CashReceivable)
+	Revenue = Account(PlatformRevenue)
+	Tax     = Account(TaxPayable)
+	Bank    = Account(PlatformBank)
+)
+
+func RiderAccount(login string) Account {
+	return Account(string(RiderReceivable) + ":" + login)
+}
+
+func DriverAccount(login string) Account {
+	return Account(string(DriverPayable) + ":" + login)
+}
+
+// Type returns the account type.
+func (a Account) Type() AccountType {
+	typ, _, _ := strings.Cut(string(a), ":")
+	return AccountType(typ)
+}
+
+// Owner returns the rider or driver login, "" for platform accounts.
+func (a Account) Owner() string {
+	_, owner, _ := strings.Cut(string(a), ":")
+	return owner
+}
+
+func (a Account) Validate() error {
+	switch a.Type() {
+	case RiderReceivable, DriverPayable:
+		if a.Owner() == "" {
+			return fmt.Errorf("%q: missing owner", a)
+		}
+	case CashReceivable, PlatformRevenue, TaxPayable, PlatformBank:
+		if a != Account(a.Type()) {
+			return fmt.Errorf("%q: platform account with owner", a)
+		}
+	default:
+		return fmt.Errorf("%q: unknown account type", a)
+	}
+
+	return nil
+}
+
+type Posting struct {
+	Account Account
+	Amount  int // ¢, debit > 0, credit < 0
+}
+
+type Entry struct {
+	ID       string // unique, posting the same ID twice fails
+	Memo     string
+	Time     time.Time // balances as of Time include the entry
+	Reverses string    // ID of the reversed entry, "" if none
+	Postings []Posting
+}
+
+var (
+	ErrNotFound   = errors.New("entry not found")
+	ErrDuplicate  = errors.New("duplicate entry")
+	ErrUnbalanced = errors.New("unbalanced entry")
+	ErrReversed   = errors.New("entry already reversed")
+	ErrNoBalance  = errors.New("insufficient balance")
+)
+
+func (e Entry) Validate() error {
+	if e.ID == "" {
+		return fmt.Errorf("missing ID")
+	}
+
+	if e.Time.IsZero() {
+		return fmt.Errorf("missing time")
+	}
+
+	if len(e.Postings) < 2 {
+		return fmt.Errorf("%w: %d postings", ErrUnbalanced, len(e.Postings))
+	}
+
+	sum := 0
+	for i, p := range e.Postings {
+		if err := p.Account.Validate(); err != nil {
+			return fmt.Errorf("posting %d: %w", i, err)
+		}
+		if p.Amount == 0 {
+			return fmt.Errorf("posting %d: zero amount", i)
+		}
+		sum += p.Amount
+	}
+	if sum != 0 {
+		return fmt.Errorf("%w: sum is %d¢", ErrUnbalanced, sum)
+	}
+
+	return nil
+}
+
+// amount returns the sum of account postings in e.
+func (e Entry) amount(account Account) int {
+	sum := 0
+	for _, p := range e.Postings {
+		if p.Account == account {
+			sum += p.Amount
+		}
+	}
+	return sum
+}
+
+// ReversalID returns the ID of the reversal of entry id, an entry is reversed
+// at most once.
+func ReversalID(id string) string {
+	return "reversal:" + id
+}
+
+// Reversal returns an entry undoing e at t.
+func (e Entry) Reversal(t time.Time, memo string) Entry {
+	r := Entry{
+		ID:       ReversalID(e.ID),
+		Memo:     memo,
+		Time:     t,
+		Reverses: e.ID,
+		Postings: make([]Posting, len(e.Postings)),
+	}
+	for i, p := range e.Postings {
+		r.Postings[i] = Posting{Account: p.Account, Amount: -p.Amount}
+	}
+	return r
+}
+
+// Store persists entries, entries are never updated or deleted.
+type Store interface {
+	// AddEntry adds an entry, it returns ErrDuplicate if the ID exists.
+	AddEntry(ctx context.Context, e Entry) error
+	Entry(ctx context.Context, id string) (Entry, error)
+	// Balance returns the sum of account postings in entries with Time <=
+	// asOf.
+	Balance(ctx context.Context, account Account, asOf time.Time) (int, error)
+	// AddPayout adds payout e to account if it doesn't make the account
+	// Balance as of e.Time positive, it returns ErrNoBalance otherwise. The
+	// check and add are atomic.
+	AddPayout(ctx context.Context, e Entry, account Account) error
+}
+
+type Ledger struct {
+	store Store
+}
+
+func New(store Store) *Ledger {
+	return &Ledger{store: store}
+}
+
+// Post validates and adds e, an empty ID gets a new one.
+func (l *Ledger) Post(ctx context.Context, e Entry) (Entry, error) {
+	if e.ID == "" {
+		e.ID = uuid.NewString()
+	}
+	if err := e.Validate(); err != nil {
+		return Entry{}, err
+	}
+
+	if err := l.store.AddEntry(ctx, e); err != nil {
+		return Entry{}, err
+	}
+	return e, nil
+}
+
+// Reverse posts the reversal of entry id at t.
+func (l *Ledger) Reverse(ctx context.Context, id string, t time.Time, memo string) (Entry, error) {
+	e, err := l.store.Entry(ctx, id)
+	if err != nil {
+		return Entry{}, err
+	}
+
+	if e.Reverses != "" {
+		return Entry{}, fmt.Errorf("%s: can't reverse a reversal", id)
+	}
+	if t.Before(e.Time) {
+		return Entry{}, fmt.Errorf("%s: reversal before entry (%v < %v)", id, t, e.Time)
+	}
+
+	r, err := l.Post(ctx, e.Reversal(t, memo))
+	if errors.Is(err, ErrDuplicate) {
+		return Entry{}, fmt.Errorf("%s: %w", id, ErrReversed)
+	}
+	return r, err
+}
+
+// Payout posts a payout of amount ¢ from the platform bank to driver at t,
+// amount 0 pays what the platform owes the driver. It returns ErrNoBalance if
+// amount is more than that.
+func (l *Ledger) Payout(ctx context.Context, driver string, amount int, t time.Time) (Entry, error) {
+	if amount < 0 {
+		return Entry{}, fmt.Errorf("negative amount: %d", amount)
+	}
+
+	account := DriverAccount(driver)
+	b, err := l.Balance(ctx, account, t)
+	if err != nil {
+		return Entry{}, err
+	}
+	owed := -b
+	if amount == 0 {
+		amount = owed
+	}
+	if amount == 0 || amount > owed {
+		return Entry{}, fmt.Errorf("%w: %s is owed %d¢", ErrNoBalance, driver, owed)
+	}
+
+	e := Entry{
+		ID:   "payout:" + uuid.NewString(),
+		Memo: fmt.Sprintf("payout to %s", driver),
+		Time: t,
+		Postings: []Posting{
+			{account, amount},
+			{Bank, -amount},
+		},
+	}
+	if err := e.Validate(); err != nil {
+		return Entry{}, err
+	}
+	// The balance might change since we read it, the store checks it again
+	if err := l.store.AddPayout(ctx, e, account); err != nil {
+		if errors.Is(err, ErrNoBalance) {
+			return Entry{}, fmt.Errorf("%w: %s is owed less than %d¢", ErrNoBalance, driver, amount)
+		}
+		return Entry{}, err
+	}
+	return e, nil
+}
+
+// Balance returns the account balance as of asOf.
+func (l *Ledger) Balance(ctx context.Context, account Account, asOf time.Time) (int, error) {
+	if err := account.Validate(); err != nil {
+		return 0, err
+	}
+	return l.store.Balance(ctx, account, asOf)
+}
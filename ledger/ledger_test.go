@@ -0,0 +1,370 @@
+package ledger
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var now = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+var accountCases = []struct {
+	account Account
+	ok      bool
+}{
+	{RiderAccount("Moneypenny"), true},
+	{DriverAccount("Bond"), true},
+	{Revenue, true},
+	{Tax, true},
+	{Cash, true},
+	{Bank, true},
+	{RiderAccount(""), false},
+	{"platform_revenue:Bond", false},
+	{"cash", false},
+}
+
+func TestAccountValidate(t *testing.T) {
+	for _, tc := range accountCases {
+		t.Run(string(tc.account), func(t *testing.T) {
+			err := tc.account.Validate()
+			if tc.ok {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+}
+
+var entryCases = []struct {
+	name     string
+	postings []Posting
+	ok       bool
+}{
+	{"balanced", []Posting{{RiderAccount("m"), 100}, {DriverAccount("bond"), -100}}, true},
+	{"unbalanced", []Posting{{RiderAccount("m"), 100}, {DriverAccount("bond"), -90}}, false},
+	{"single", []Posting{{RiderAccount("m"), 0}}, false},
+	{"zero", []Posting{{RiderAccount("m"), 0}, {DriverAccount("bond"), 0}}, false},
+	{"bad account", []Posting{{"cash", 100}, {DriverAccount("bond"), -100}}, false},
+}
+
+func TestEntryValidate(t *testing.T) {
+	for _, tc := range entryCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := Entry{ID: "e1", Time: now, Postings: tc.postings}
+			err := e.Validate()
+			if tc.ok {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+}
+
+var splitCases = []struct {
+	total    int
+	weights  []int
+	n        int
+	expected []int
+}{
+	{100, nil, 3, []int{34, 33, 33}},
+	{100, []int{0, 0}, 2, []int{50, 50}},
+	{1000, []int{800, 200}, 2, []int{800, 200}},
+	{1001, []int{1, 1}, 2, []int{501, 500}},
+	{10, []int{3, 0, 1}, 3, []int{8, 0, 2}},
+}
+
+func TestSplit(t *testing.T) {
+	for _, tc := range splitCases {
+		t.Run(fmt.Sprintf("%d/%v", tc.total, tc.weights), func(t *testing.T) {
+			require.Equal(t, tc.expected, Split(tc.total, tc.weights, tc.n))
+		})
+	}
+}
+
+func TestRideEntry(t *testing.T) {
+	require := require.New(t)
+
+	r := Ride{
+		ID:         "r1",
+		Driver:     "Bond",
+		Time:       now,
+		Riders:     []string{"Moneypenny", "Q"},
+		Shares:     []int{800, 200},
+		Total:      1300, // 1000 fare + 100 booking + 100 tax + 100 tip
+		Tax:        100,
+		Tip:        100,
+		Commission: 130, // 30 + booking
+	}
+	e, err := RideEntry(r)
+	require.NoError(err)
+	require.Equal(RideEntryID("r1"), e.ID)
+
+	amounts := make(map[Account]int)
+	for _, p := range e.Postings {
+		amounts[p.Account] += p.Amount
+	}
+	require.Equal(map[Account]int{
+		RiderAccount("Moneypenny"): 1040,
+		RiderAccount("Q"):          260,
+		Tax:                        -100,
+		Revenue:                    -130,
+		DriverAccount("Bond"):      -1070,
+	}, amounts)
+
+	r.Commission = 1200 // more than the fare
+	_, err = RideEntry(r)
+	require.Error(err)
+
+	// No riders
+	r.Commission, r.Riders, r.Shares = 130, nil, nil
+	e, err = RideEntry(r)
+	require.NoError(err)
+	require.Equal(1300, postings(e)[Cash])
+}
+
+// postings returns entry amounts by account.
+func postings(e Entry) map[Account]int {
+	m := make(map[Account]int)
+	for _, p := range e.Postings {
+		m[p.Account] += p.Amount
+	}
+	return m
+}
+
+func TestPayout(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+	l := New(NewMemStore())
+
+	e, err := RideEntry(Ride{ID: "r1", Driver: "Bond", Time: now, Riders: []string{"m"}, Total: 1000, Commission: 30})
+	require.NoError(err)
+	_, err = l.Post(ctx, e)
+	require.NoError(err)
+
+	_, err = l.Payout(ctx, "Bond", 1000, now)
+	require.ErrorIs(err, ErrNoBalance)
+	_, err = l.Payout(ctx, "Bond", -1, now)
+	require.Error(err)
+	_, err = l.Payout(ctx, "Q", 0, now)
+	require.ErrorIs(err, ErrNoBalance)
+
+	p, err := l.Payout(ctx, "Bond", 500, now)
+	require.NoError(err)
+	require.Equal(map[Account]int{DriverAccount("Bond"): 500, Bank: -500}, postings(p))
+
+	p, err = l.Payout(ctx, "Bond", 0, now.Add(time.Hour)) // the rest
+	require.NoError(err)
+	require.Equal(470, postings(p)[DriverAccount("Bond")])
+
+	b, err := l.Balance(ctx, DriverAccount("Bond"), now.Add(time.Hour))
+	require.NoError(err)
+	require.Equal(0, b)
+	_, err = l.Payout(ctx, "Bond", 0, now.Add(time.Hour))
+	require.ErrorIs(err, ErrNoBalance)
+}
+
+func TestPayoutConcurrent(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+	l := New(NewMemStore())
+
+	e, err := RideEntry(Ride{ID: "r1", Driver: "Bond", Time: now, Riders: []string{"m"}, Total: 1000, Commission: 30})
+	require.NoError(err)
+	_, err = l.Post(ctx, e)
+	require.NoError(err)
+
+	const n = 20
+	errs := make(chan error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := l.Payout(ctx, "Bond", 970, now)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	paid := 0
+	for err := range errs {
+		if err == nil {
+			paid++
+			continue
+		}
+		require.ErrorIs(err, ErrNoBalance)
+	}
+	require.Equal(1, paid)
+
+	b, err := l.Balance(ctx, DriverAccount("Bond"), now)
+	require.NoError(err)
+	require.Equal(0, b)
+}
+
+func TestReverse(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+	l := New(NewMemStore())
+
+	e, err := l.Post(ctx, Entry{
+		Time:     now,
+		Postings: []Posting{{RiderAccount("m"), 500}, {DriverAccount("bond"), -500}},
+	})
+	require.NoError(err)
+	require.NotEmpty(e.ID)
+
+	_, err = l.Post(ctx, e)
+	require.ErrorIs(err, ErrDuplicate)
+
+	_, err = l.Reverse(ctx, e.ID, now.Add(-time.Second), "refund")
+	require.Error(err, "before entry")
+
+	r, err := l.Reverse(ctx, e.ID, now.Add(time.Hour), "refund")
+	require.NoError(err)
+	require.Equal(e.ID, r.Reverses)
+
+	_, err = l.Reverse(ctx, e.ID, now.Add(time.Hour), "refund")
+	require.ErrorIs(err, ErrReversed)
+	_, err = l.Reverse(ctx, r.ID, now.Add(time.Hour), "refund")
+	require.Error(err, "reversal of reversal")
+	_, err = l.Reverse(ctx, "nope", now, "refund")
+	require.ErrorIs(err, ErrNotFound)
+
+	// As of
+	for asOf, expected := range map[time.Time]int{
+		now.Add(-time.Second):            0,
+		now:                              500,
+		now.Add(time.Hour - time.Second): 500,
+		now.Add(time.Hour):               0,
+	} {
+		b, err := l.Balance(ctx, RiderAccount("m"), asOf)
+		require.NoError(err)
+		require.Equal(expected, b, asOf)
+	}
+}
+
+func TestStoreImmutable(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+	s := NewMemStore()
+
+	e := Entry{ID: "e1", Time: now, Postings: []Posting{{RiderAccount("m"), 1}, {Revenue, -1}}}
+	require.NoError(s.AddEntry(ctx, e))
+	e.Postings[0].Amount = 100
+
+	out, err := s.Entry(ctx, "e1")
+	require.NoError(err)
+	require.Equal(1, out.Postings[0].Amount)
+	out.Postings[0].Amount = 100
+
+	b, err := s.Balance(ctx, RiderAccount("m"), now)
+	require.NoError(err)
+	require.Equal(1, b)
+}
+
+// TestInvariants posts random rides and refunds, the ledger must balance at
+// any time and a refund must undo its ride.
+func TestInvariants(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+	l := New(NewMemStore())
+	rnd := rand.New(rand.NewSource(7)) //#nosec G404
+
+	riders := []string{"m", "q", "felix", "vesper"}
+	drivers := []string{"bond", "trevelyan"}
+	accounts := []Account{Revenue, Tax, Cash, Bank}
+	for _, login := range riders {
+		accounts = append(accounts, RiderAccount(login))
+	}
+	for _, login := range drivers {
+		accounts = append(accounts, DriverAccount(login))
+	}
+
+	balances := func(asOf time.Time) map[Account]int {
+		out := make(map[Account]int)
+		for _, a := range accounts {
+			b, err := l.Balance(ctx, a, asOf)
+			require.NoError(err)
+			out[a] = b
+		}
+		return out
+	}
+
+	var posted []Entry
+	for i := 0; i < 200; i++ {
+		n := rnd.Intn(3) // 0 riders posts to Cash
+		perm := rnd.Perm(len(riders))[:n]
+		r := Ride{
+			ID:     fmt.Sprintf("r%d", i),
+			Driver: drivers[rnd.Intn(len(drivers))],
+			Time:   now.Add(time.Duration(i) * time.Minute),
+			Tip:    rnd.Intn(3) * 100,
+		}
+		shares := make([]int, n)
+		for j, k := range perm {
+			r.Riders = append(r.Riders, riders[k])
+			shares[j] = rnd.Intn(1000)
+		}
+		r.Shares = shares
+		fare := 250 + rnd.Intn(5000)
+		r.Tax = fare * 17 / 100
+		r.Commission = 30
+		r.Total = fare + r.Tax + r.Tip
+
+		e, err := RideEntry(r)
+		require.NoError(err)
+		_, err = l.Post(ctx, e)
+		require.NoError(err)
+		posted = append(posted, e)
+
+		if i%20 == 19 {
+			_, err := l.Payout(ctx, r.Driver, 0, r.Time)
+			require.NoError(err)
+		}
+	}
+	end := now.Add(200 * time.Minute)
+
+	// Refund some rides, their accounts go back to what they were without them
+	before := balances(end)
+	refunded := make(map[Account]int)
+	for i := 0; i < 20; i++ {
+		e := posted[rnd.Intn(len(posted))]
+		if _, err := l.Reverse(ctx, e.ID, end.Add(time.Hour), "refund"); err != nil {
+			require.ErrorIs(err, ErrReversed)
+			continue
+		}
+		for _, p := range e.Postings {
+			refunded[p.Account] += p.Amount
+		}
+	}
+	after := balances(end.Add(time.Hour))
+	for _, a := range accounts {
+		require.Equal(before[a]-refunded[a], after[a], a)
+	}
+
+	// Balanced at any time
+	for _, asOf := range []time.Time{now, now.Add(time.Hour), end, end.Add(time.Hour)} {
+		sum := 0
+		for a, b := range balances(asOf) {
+			sum += b
+			if asOf.After(end) {
+				continue // refunds after a payout leave drivers owing the platform
+			}
+			switch a.Type() {
+			case RiderReceivable, CashReceivable:
+				require.GreaterOrEqual(b, 0, a)
+			default:
+				require.LessOrEqual(b, 0, a)
+			}
+		}
+		require.Equal(0, sum, asOf)
+	}
+}
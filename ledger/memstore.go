@@ -0,0 +1,74 @@
+package ledger
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemStore is an in memory Store, for tests.
+type MemStore struct {
+	mu      sync.Mutex
+	entries map[string]Entry
+}
+
+func NewMemStore() *MemStore {
+	s := MemStore{
+		entries: make(map[string]Entry),
+	}
+	return &s
+}
+
+func (m *MemStore) AddEntry(_ context.Context, e Entry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.entries[e.ID]; ok {
+		return ErrDuplicate
+	}
+	m.entries[e.ID] = copyEntry(e)
+	return nil
+}
+
+func (m *MemStore) AddPayout(_ context.Context, e Entry, account Account) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.entries[e.ID]; ok {
+		return ErrDuplicate
+	}
+	if m.balance(account, e.Time)+e.amount(account) > 0 {
+		return ErrNoBalance
+	}
+	m.entries[e.ID] = copyEntry(e)
+	return nil
+}
+
+func (m *MemStore) Entry(_ context.Context, id string) (Entry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.entries[id]
+	if !ok {
+		return Entry{}, ErrNotFound
+	}
+	return copyEntry(e), nil
+}
+
+func (m *MemStore) Balance(_ context.Context, account Account, asOf time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.balance(account, asOf), nil
+}
+
+func (m *MemStore) balance(account Account, asOf time.Time) int {
+	balance := 0
+	for _, e := range m.entries {
+		if !e.Time.After(asOf) {
+			balance += e.amount(account)
+		}
+	}
+	return balance
+}
+
+func copyEntry(e Entry) Entry {
+	e.Postings = append([]Posting(nil), e.Postings...)
+	return e
+}
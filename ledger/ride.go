@@ -0,0 +1,107 @@
+package ledger
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Ride is what an ended ride moves, amounts are in ¢.
+type Ride struct {
+	ID     string
+	Driver string
+	Time   time.Time // ride end
+	Riders []string  // none for rides started by drivers, see Cash
+	Shares []int     // rider weights (e.g. leg fares), nil or all zero splits evenly
+
+	Total      int // what riders pay, including Tax and Tip
+	Tax        int
+	Tip        int // all to the driver
+	Commission int // platform part of the fare
+}
+
+// RideEntryID returns the entry ID of a ride, a ride is posted once.
+func RideEntryID(rideID string) string {
+	return "ride:" + rideID
+}
+
+// RideEntry returns the entry of an ended ride. Riders are charged Total, the
+// Cash account if the ride has no riders. The driver is owed Total minus Tax
+// and Commission.
+func RideEntry(r Ride) (Entry, error) {
+	if r.Shares != nil && len(r.Shares) != len(r.Riders) {
+		return Entry{}, fmt.Errorf("ride %s: %d shares for %d riders", r.ID, len(r.Shares), len(r.Riders))
+	}
+	if r.Tax < 0 || r.Tip < 0 || r.Commission < 0 || r.Commission > r.Total-r.Tax-r.Tip {
+		return Entry{}, fmt.Errorf("ride %s: bad amounts: %+v", r.ID, r)
+	}
+
+	e := Entry{
+		ID:   RideEntryID(r.ID),
+		Memo: fmt.Sprintf("ride %s", r.ID),
+		Time: r.Time,
+	}
+	add := func(a Account, amount int) {
+		if amount != 0 {
+			e.Postings = append(e.Postings, Posting{a, amount})
+		}
+	}
+
+	if len(r.Riders) == 0 {
+		add(Cash, r.Total)
+	}
+	for i, amount := range Split(r.Total, r.Shares, len(r.Riders)) {
+		add(RiderAccount(r.Riders[i]), amount)
+	}
+	add(Tax, -r.Tax)
+	add(Revenue, -r.Commission)
+	add(DriverAccount(r.Driver), -(r.Total - r.Tax - r.Commission))
+
+	if len(e.Postings) == 0 { // free ride
+		return Entry{}, fmt.Errorf("ride %s: nothing to post", r.ID)
+	}
+	if err := e.Validate(); err != nil {
+		return Entry{}, err
+	}
+	return e, nil
+}
+
+// Split splits total to n parts in proportion to weights, parts add up to
+// total. Nil or all zero weights split evenly.
+func Split(total int, weights []int, n int) []int {
+	if n == 0 {
+		return nil
+	}
+
+	w := make([]int, n)
+	sum := 0
+	for i := range w {
+		if i < len(weights) && weights[i] > 0 {
+			w[i] = weights[i]
+			sum += w[i]
+		}
+	}
+	if sum == 0 {
+		for i := range w {
+			w[i] = 1
+		}
+		sum = n
+	}
+
+	// Largest remainder
+	parts := make([]int, n)
+	rems := make([]int, n)
+	idx := make([]int, n)
+	left := total
+	for i := range parts {
+		parts[i] = total * w[i] / sum
+		rems[i] = total * w[i] % sum
+		left -= parts[i]
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(i, j int) bool { return rems[idx[i]] > rems[idx[j]] })
+	for i := 0; i < left; i++ {
+		parts[idx[i%n]]++
+	}
+	return parts
+}
@@ -1,22 +1,68 @@
 package logger
 
 import (
+	"bytes"
 	"io"
 	"log"
 	"os"
 )
 
-func New(prefix string, outFile string) (*log.Logger, error) {
+// New returns a logger writing to the standard logger output, and to outFile
+// if it's not empty. Any of secrets is masked in log lines.
+// Call the returned io.Closer when done.
+func New(prefix string, outFile string, secrets ...string) (*log.Logger, io.Closer, error) {
 	var w io.Writer = log.Writer()
+	var closer io.Closer = nopCloser{}
 	if outFile != "" {
 		flags := os.O_APPEND | os.O_CREATE | os.O_WRONLY
 		file, err := os.OpenFile(outFile, flags, 0600) //#nosec G304
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		w = io.MultiWriter(w, file)
+		closer = file
+	}
+
+	if len(secrets) > 0 {
+		w = NewMaskWriter(w, secrets...)
 	}
 
 	logger := log.New(w, prefix, log.LstdFlags|log.Lshortfile)
-	return logger, nil
+	return logger, closer, nil
+}
+
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
+
+// Masked replaces secrets in logs and configuration dumps.
+const Masked = "xxxxxx"
+
+// MaskWriter replaces secrets with Masked.
+// It works per Write, which is a full line for log.Logger.
+type MaskWriter struct {
+	w       io.Writer
+	secrets [][]byte
+}
+
+func NewMaskWriter(w io.Writer, secrets ...string) *MaskWriter {
+	mw := MaskWriter{w: w}
+	for _, s := range secrets {
+		if s != "" {
+			mw.secrets = append(mw.secrets, []byte(s))
+		}
+	}
+	return &mw
+}
+
+func (mw *MaskWriter) Write(data []byte) (int, error) {
+	out := data
+	for _, s := range mw.secrets {
+		out = bytes.ReplaceAll(out, s, []byte(Masked))
+	}
+
+	if _, err := mw.w.Write(out); err != nil {
+		return 0, err
+	}
+	return len(data), nil
 }
@@ -0,0 +1,229 @@
+// Package outbox relays messages written to the database (in the same
+// transaction as the change they describe) to sinks.
+//
+// Delivery is at-least-once: a message is marked published only after all
+// sinks accepted it, on retry only the sinks that failed get it again. A sink
+// may still get a message twice (e.g. the relay crashed before recording the
+// send), consumers should use DedupID to drop duplicates. After MaxAttempts
+// failures a message is dead (dead-letter) until retried with Relay.Retry.
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+type Message struct {
+	ID       int64
+	DedupID  string
+	Type     string
+	Payload  []byte
+	Created  time.Time
+	Attempts int
+	Sent     []string // names of sinks that accepted the message
+}
+
+var ErrNotFound = errors.New("message not found")
+
+// Sink receives messages.
+type Sink interface {
+	Name() string
+	Send(ctx context.Context, m Message) error
+}
+
+// Store is where the outbox is kept.
+type Store interface {
+	// Claim returns unpublished messages due at now and hides them from other
+	// relays for lease.
+	Claim(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]Message, error)
+	MarkPublished(ctx context.Context, id int64, t time.Time) error
+	// MarkFailed records a failed attempt, sent are the sinks that accepted
+	// the message so far.
+	MarkFailed(ctx context.Context, id int64, sent []string, reason string, next time.Time) error
+	// MarkDead records the last failed attempt, dead messages aren't claimed.
+	MarkDead(ctx context.Context, id int64, sent []string, reason string, t time.Time) error
+	// Revive makes a dead message due at now with a fresh set of attempts, it
+	// returns ErrNotFound if there's no dead message with id.
+	Revive(ctx context.Context, id int64, now time.Time) error
+	// Purge deletes messages published before t.
+	Purge(ctx context.Context, before time.Time) (int64, error)
+}
+
+// Relay publishes outbox messages to sinks.
+type Relay struct {
+	store Store
+	sinks []Sink
+
+	Lease       time.Duration
+	BatchSize   int
+	MaxAttempts int
+	// Backoff returns the delay after attempt n (1 based) failed.
+	Backoff func(n int) time.Duration
+	// Published messages are purged after Retention, 0 keeps them.
+	Retention time.Duration
+	OnError   func(error)
+}
+
+func NewRelay(store Store, sinks ...Sink) *Relay {
+	r := Relay{
+		store:       store,
+		sinks:       sinks,
+		Lease:       30 * time.Second,
+		BatchSize:   100,
+		MaxAttempts: 10,
+		Backoff: func(n int) time.Duration {
+			d := 5 * time.Minute
+			if n <= 10 && time.Second<<(n-1) < d {
+				d = time.Second << (n - 1)
+			}
+			return d
+		},
+		Retention: 24 * time.Hour,
+	}
+	return &r
+}
+
+func (r *Relay) onError(err error) {
+	if r.OnError != nil {
+		r.OnError(err)
+	}
+}
+
+// Run publishes messages every interval until ctx is done.
+func (r *Relay) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var lastPurge time.Time
+	for {
+		// Drain the backlog before waiting
+		for {
+			n, err := r.Process(ctx)
+			if err != nil {
+				r.onError(err)
+			}
+			if err != nil || n < r.BatchSize {
+				break
+			}
+		}
+
+		if r.Retention > 0 && time.Since(lastPurge) > time.Hour {
+			if _, err := r.store.Purge(ctx, time.Now().UTC().Add(-r.Retention)); err != nil {
+				r.onError(fmt.Errorf("purge: %w", err))
+			}
+			lastPurge = time.Now()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Process publishes one batch and returns the number of messages claimed.
+func (r *Relay) Process(ctx context.Context) (int, error) {
+	now := time.Now().UTC()
+	msgs, err := r.store.Claim(ctx, now, r.Lease, r.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, m := range msgs {
+		if err := r.publish(ctx, m); err != nil {
+			r.onError(fmt.Errorf("message %d (%s): %w", m.ID, m.DedupID, err))
+		}
+	}
+
+	return len(msgs), nil
+}
+
+func (r *Relay) publish(ctx context.Context, m Message) error {
+	sent := append([]string(nil), m.Sent...)
+	var errs []string
+	for _, s := range r.sinks {
+		if contains(m.Sent, s.Name()) {
+			continue
+		}
+		if err := s.Send(ctx, m); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", s.Name(), err))
+			continue
+		}
+		sent = append(sent, s.Name())
+	}
+
+	now := time.Now().UTC()
+	if len(errs) == 0 {
+		return r.store.MarkPublished(ctx, m.ID, now)
+	}
+
+	reason := strings.Join(errs, "; ")
+	attempts := m.Attempts + 1
+	if attempts >= r.MaxAttempts {
+		if err := r.store.MarkDead(ctx, m.ID, sent, reason, now); err != nil {
+			return err
+		}
+		return fmt.Errorf("dead after %d attempts: %s", attempts, reason)
+	}
+
+	if err := r.store.MarkFailed(ctx, m.ID, sent, reason, now.Add(r.Backoff(attempts))); err != nil {
+		return err
+	}
+	return errors.New(reason)
+}
+
+// Retry makes dead message id due now, only the sinks that failed get it.
+func (r *Relay) Retry(ctx context.Context, id int64) error {
+	return r.store.Revive(ctx, id, time.Now().UTC())
+}
+
+func contains(values []string, v string) bool {
+	for _, s := range values {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+// LogSink logs messages.
+type LogSink struct {
+	Log *log.Logger
+}
+
+func (LogSink) Name() string { return "log" }
+
+func (s LogSink) Send(_ context.Context, m Message) error {
+	s.Log.Printf("INFO: outbox %d %s (%s): %s", m.ID, m.Type, m.DedupID, m.Payload)
+	return nil
+}
+
+// StreamAdder appends entries to a stream (e.g. redis XADD), trimming it to
+// about maxLen entries.
+type StreamAdder interface {
+	StreamAdd(ctx context.Context, stream string, maxLen int64, fields map[string]any) error
+}
+
+// StreamSink appends messages to a stream.
+type StreamSink struct {
+	Stream string
+	MaxLen int64
+	Adder  StreamAdder
+}
+
+func (StreamSink) Name() string { return "stream" }
+
+func (s StreamSink) Send(ctx context.Context, m Message) error {
+	fields := map[string]any{
+		"id":       m.ID,
+		"dedup_id": m.DedupID,
+		"type":     m.Type,
+		"payload":  m.Payload,
+	}
+	return s.Adder.StreamAdd(ctx, s.Stream, s.MaxLen, fields)
+}
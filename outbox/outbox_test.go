@@ -0,0 +1,187 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type memStore struct {
+	mu        sync.Mutex
+	msgs      []Message
+	next      map[int64]time.Time
+	published map[int64]bool
+	dead      map[int64]bool
+}
+
+func newMemStore(msgs ...Message) *memStore {
+	return &memStore{
+		msgs:      msgs,
+		next:      make(map[int64]time.Time),
+		published: make(map[int64]bool),
+		dead:      make(map[int64]bool),
+	}
+}
+
+func (s *memStore) Claim(_ context.Context, now time.Time, lease time.Duration, limit int) ([]Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []Message
+	for _, m := range s.msgs {
+		if len(out) == limit {
+			break
+		}
+		if s.published[m.ID] || s.dead[m.ID] || s.next[m.ID].After(now) {
+			continue
+		}
+		s.next[m.ID] = now.Add(lease)
+		out = append(out, m)
+	}
+	return out, nil
+}
+
+func (s *memStore) MarkPublished(_ context.Context, id int64, t time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.published[id] = true
+	return nil
+}
+
+func (s *memStore) MarkFailed(_ context.Context, id int64, sent []string, reason string, next time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.msgs {
+		if s.msgs[i].ID == id {
+			s.msgs[i].Attempts++
+			s.msgs[i].Sent = sent
+		}
+	}
+	s.next[id] = next
+	return nil
+}
+
+func (s *memStore) MarkDead(ctx context.Context, id int64, sent []string, reason string, t time.Time) error {
+	if err := s.MarkFailed(ctx, id, sent, reason, t); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dead[id] = true
+	return nil
+}
+
+func (s *memStore) Revive(_ context.Context, id int64, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.dead[id] {
+		return ErrNotFound
+	}
+	for i := range s.msgs {
+		if s.msgs[i].ID == id {
+			s.msgs[i].Attempts = 0
+		}
+	}
+	s.dead[id] = false
+	s.next[id] = now
+	return nil
+}
+
+func (s *memStore) Purge(context.Context, time.Time) (int64, error) {
+	return 0, nil
+}
+
+// sink records dedup IDs and fails the first fails sends.
+type sink struct {
+	name  string
+	fails int
+	got   []string
+}
+
+func (s *sink) Name() string { return s.name }
+
+func (s *sink) Send(_ context.Context, m Message) error {
+	if s.fails > 0 {
+		s.fails--
+		return fmt.Errorf("oops")
+	}
+	s.got = append(s.got, m.DedupID)
+	return nil
+}
+
+func TestRelay(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	store := newMemStore(
+		Message{ID: 1, DedupID: "a"},
+		Message{ID: 2, DedupID: "b"},
+	)
+	ok, flaky := &sink{name: "ok"}, &sink{name: "flaky", fails: 1}
+	r := NewRelay(store, ok, flaky)
+	r.Backoff = func(int) time.Duration { return 0 }
+	var errs []error
+	r.OnError = func(err error) { errs = append(errs, err) }
+
+	n, err := r.Process(ctx)
+	require.NoError(err)
+	require.Equal(2, n)
+	require.Len(errs, 1)
+	require.True(store.published[2])
+	require.False(store.published[1])
+
+	// Retry, only the failed sink gets "a" again
+	n, err = r.Process(ctx)
+	require.NoError(err)
+	require.Equal(1, n)
+	require.True(store.published[1])
+	require.Equal([]string{"a", "b"}, ok.got)
+	require.Equal([]string{"b", "a"}, flaky.got)
+
+	n, err = r.Process(ctx)
+	require.NoError(err)
+	require.Equal(0, n)
+}
+
+func TestRelayDead(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	store := newMemStore(Message{ID: 1, DedupID: "a"})
+	ok, broken := &sink{name: "ok"}, &sink{name: "broken", fails: 4}
+	r := NewRelay(store, ok, broken)
+	r.Backoff = func(int) time.Duration { return 0 }
+	r.MaxAttempts = 3
+
+	for i := 0; i < 3; i++ {
+		n, err := r.Process(ctx)
+		require.NoError(err)
+		require.Equal(1, n)
+	}
+	require.True(store.dead[1])
+	require.False(store.published[1])
+
+	n, err := r.Process(ctx)
+	require.NoError(err)
+	require.Equal(0, n, "dead messages aren't claimed")
+
+	require.ErrorIs(r.Retry(ctx, 2), ErrNotFound)
+	require.NoError(r.Retry(ctx, 1))
+	for i := 0; i < 2; i++ {
+		_, err := r.Process(ctx)
+		require.NoError(err)
+	}
+	require.True(store.published[1])
+	require.Equal([]string{"a"}, ok.got)
+	require.Equal([]string{"a"}, broken.got)
+}
+
+func TestBackoff(t *testing.T) {
+	b := NewRelay(nil).Backoff
+	require.Equal(t, time.Second, b(1))
+	require.Equal(t, 8*time.Second, b(4))
+	require.Equal(t, 5*time.Minute, b(20))
+}
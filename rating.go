@@ -0,0 +1,119 @@
+package unter
+
+import (
+	"errors"
+	"fmt"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	MinStars = 1
+	MaxStars = 5
+
+	maxComment = 1000 // runes
+)
+
+// RatingTags are the tags a rating can have.
+var RatingTags = []string{
+	"clean", "friendly", "safe", "on_time", "navigation",
+	"dirty", "rude", "unsafe", "late", "no_show",
+}
+
+type Rating struct {
+	RideID  string
+	Rater   string // login
+	Ratee   string // login
+	ByRider bool   // rider rating the driver, otherwise driver rating the rider
+	Stars   int
+	Tags    []string
+	Comment string
+	Time    time.Time
+}
+
+func (r Rating) Validate() error {
+	if r.RideID == "" {
+		return fmt.Errorf("missing ride ID")
+	}
+
+	if r.Rater == "" || r.Ratee == "" || r.Rater == r.Ratee {
+		return fmt.Errorf("bad rater/ratee: %q/%q", r.Rater, r.Ratee)
+	}
+
+	if r.Stars < MinStars || r.Stars > MaxStars {
+		return fmt.Errorf("stars must be %d-%d, got %d", MinStars, MaxStars, r.Stars)
+	}
+
+	seen := make(map[string]bool)
+	for _, t := range r.Tags {
+		if seen[t] || !validTag(t) {
+			return fmt.Errorf("bad tag: %q", t)
+		}
+		seen[t] = true
+	}
+
+	if !utf8.ValidString(r.Comment) || utf8.RuneCountInString(r.Comment) > maxComment {
+		return fmt.Errorf("bad comment")
+	}
+
+	return nil
+}
+
+func validTag(tag string) bool {
+	for _, t := range RatingTags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	ErrNotEnded     = errors.New("ride not ended")
+	ErrRatingWindow = errors.New("rating window closed")
+)
+
+// CanRate returns an error if ride r can't be rated at now, ratings are
+// accepted for window after the ride ends.
+func (r Ride) CanRate(now time.Time, window time.Duration) error {
+	if r.End.Equal(zeroTime) {
+		return ErrNotEnded
+	}
+
+	if now.Sub(r.End) > window {
+		return ErrRatingWindow
+	}
+
+	return nil
+}
+
+// Score is a rolling rating average.
+type Score struct {
+	Average float64 // 0 if there are no ratings
+	Count   int     // ratings used
+}
+
+// RollingScore returns the average of the latest n stars (newest first).
+// Newer ratings weigh more, the newest has weight n and the oldest 1.
+func RollingScore(stars []int, n int) Score {
+	if len(stars) > n {
+		stars = stars[:n]
+	}
+	if len(stars) == 0 {
+		return Score{}
+	}
+
+	var total, weights float64
+	for i, s := range stars {
+		w := float64(n - i)
+		total += w * float64(s)
+		weights += w
+	}
+	return Score{Average: total / weights, Count: len(stars)}
+}
+
+// NeedsReview returns true if there are at least minCount ratings and the
+// average is below threshold.
+func (s Score) NeedsReview(threshold float64, minCount int) bool {
+	return s.Count >= minCount && s.Average < threshold
+}
@@ -0,0 +1,85 @@
+package unter_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/353solutions/unter"
+)
+
+var rollingScoreCases = []struct {
+	stars    []int
+	n        int
+	expected float64
+}{
+	{nil, 10, 0},
+	{[]int{5}, 10, 5},
+	{[]int{5, 5, 5}, 3, 5},
+	{[]int{1, 5}, 2, (2*1 + 1*5) / 3.0}, // newest weighs more
+	{[]int{5, 1, 1, 1}, 1, 5},           // only the latest n
+}
+
+func TestRollingScore(t *testing.T) {
+	for _, tc := range rollingScoreCases {
+		name := fmt.Sprintf("%v/%d", tc.stars, tc.n)
+		t.Run(name, func(t *testing.T) {
+			s := unter.RollingScore(tc.stars, tc.n)
+			require.InDelta(t, tc.expected, s.Average, 0.001)
+			require.LessOrEqual(t, s.Count, tc.n)
+		})
+	}
+}
+
+func TestNeedsReview(t *testing.T) {
+	s := unter.RollingScore([]int{1, 1}, 10)
+	require.False(t, s.NeedsReview(4, 3), "too few ratings")
+	require.True(t, s.NeedsReview(4, 2))
+}
+
+func TestCanRate(t *testing.T) {
+	r := unter.Ride{Start: now.Add(-time.Hour)}
+	require.ErrorIs(t, r.CanRate(now, time.Hour), unter.ErrNotEnded)
+
+	r.End = now.Add(-time.Hour)
+	require.NoError(t, r.CanRate(now, time.Hour))
+	require.ErrorIs(t, r.CanRate(now.Add(time.Second), time.Hour), unter.ErrRatingWindow)
+}
+
+var ratingValidateCases = []struct {
+	name string
+	fn   func(r *unter.Rating)
+	ok   bool
+}{
+	{"ok", func(r *unter.Rating) {}, true},
+	{"zero stars", func(r *unter.Rating) { r.Stars = 0 }, false},
+	{"six stars", func(r *unter.Rating) { r.Stars = 6 }, false},
+	{"unknown tag", func(r *unter.Rating) { r.Tags = []string{"fast"} }, false},
+	{"duplicate tag", func(r *unter.Rating) { r.Tags = []string{"clean", "clean"} }, false},
+	{"self", func(r *unter.Rating) { r.Ratee = r.Rater }, false},
+}
+
+func TestRatingValidate(t *testing.T) {
+	for _, tc := range ratingValidateCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := unter.Rating{
+				RideID:  "r1",
+				Rater:   "Moneypenny",
+				Ratee:   "Bond",
+				ByRider: true,
+				Stars:   5,
+				Tags:    []string{"friendly", "safe"},
+				Time:    now,
+			}
+			tc.fn(&r)
+			err := r.Validate()
+			if tc.ok {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+}
@@ -1,6 +1,11 @@
 package unter
 
-import "time"
+import (
+	"context"
+	"time"
+
+	"github.com/353solutions/unter/ledger"
+)
 
 const (
 	minFee  = 250 // ¢
@@ -8,34 +13,28 @@ const (
 	perHour = 3000
 )
 
-// RideFee returns the ride fee in ¢
-func RideFee(duration time.Duration, distance float64, shared bool) int {
-	m := perMile * distance
-	h := perHour * float64(duration/time.Minute/60)
-
-	fee := max(m, h)
-	fee = max(fee, minFee)
-	if shared {
-		fee = 0.9 * float64(fee)
-	}
-
-	return int(fee)
-}
+// RideCommission is the platform fee (¢) on every ride.
+const RideCommission = 30
 
-func max(a, b float64) float64 {
-	if a > b {
-		return a
-	}
-	return b
+// RideFee returns the ride fee in ¢, see RideFare for the breakdown.
+func RideFee(duration time.Duration, distance float64, shared bool) int {
+	return feeBreakdown(duration, distance, shared).Fare()
 }
 
 type Report struct {
 	Driver   string
 	NumRides int
-	Payment  int
+	Payment  int // what the platform owes the driver
+}
+
+// Balances returns ledger account balances, *ledger.Ledger implements it.
+type Balances interface {
+	Balance(ctx context.Context, account ledger.Account, asOf time.Time) (int, error)
 }
 
-func ByDriver(rides []Ride) []Report {
+// ByDriver returns the number of rides per driver and what the platform owes
+// them as of asOf, according to the driver payable balance in the ledger.
+func ByDriver(ctx context.Context, rides []Ride, b Balances, asOf time.Time) ([]Report, error) {
 	rs := make(map[string]*Report) // driver -> report
 	for _, r := range rides {
 		rp, ok := rs[r.Driver]
@@ -46,14 +45,16 @@ func ByDriver(rides []Ride) []Report {
 			rs[r.Driver] = rp
 		}
 		rp.NumRides++
-
-		duration := r.End.Sub(r.Start)
-		rp.Payment += RideFee(duration, r.Distance, r.Kind == Shared) - 30
 	}
 
 	reports := make([]Report, 0, len(rs))
 	for _, rp := range rs {
+		n, err := b.Balance(ctx, ledger.DriverAccount(rp.Driver), asOf)
+		if err != nil {
+			return nil, err
+		}
+		rp.Payment = -n // credit balance
 		reports = append(reports, *rp)
 	}
-	return reports
+	return reports, nil
 }
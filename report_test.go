@@ -1,6 +1,7 @@
 package unter_test
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
 	"testing"
@@ -9,6 +10,7 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/353solutions/unter"
+	"github.com/353solutions/unter/ledger"
 )
 
 // FIXME: Must be in sync with report.go
@@ -68,8 +70,16 @@ func init() {
 }
 
 func BenchmarkByDriver(b *testing.B) {
+	l := ledger.New(ledger.NewMemStore())
+	ctx := context.Background()
+	asOf := time.Now()
+	b.ResetTimer()
+
 	for i := 0; i < b.N; i++ {
-		rs := unter.ByDriver(rides)
+		rs, err := unter.ByDriver(ctx, rides, l, asOf)
+		if err != nil {
+			b.Fatal(err)
+		}
 		if len(rs) != nDrivers {
 			b.Fatal(rs)
 		}
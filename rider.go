@@ -0,0 +1,33 @@
+package unter
+
+import (
+	"fmt"
+	"net/mail"
+	"time"
+)
+
+type Rider struct {
+	Login   string // same as the user login
+	Name    string
+	Email   string
+	Phone   string
+	Created time.Time
+}
+
+func (r Rider) Validate() error {
+	if r.Login == "" {
+		return fmt.Errorf("missing login")
+	}
+
+	if r.Name == "" {
+		return fmt.Errorf("missing name")
+	}
+
+	if r.Email != "" {
+		if _, err := mail.ParseAddress(r.Email); err != nil {
+			return fmt.Errorf("bad email: %q", r.Email)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,52 @@
+package unter_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/353solutions/unter"
+)
+
+var rideRidersCases = []struct {
+	kind   unter.Kind
+	riders []string
+	ok     bool
+}{
+	{unter.Private, nil, true},
+	{unter.Private, []string{"m"}, true},
+	{unter.Private, []string{"m", "q"}, false},
+	{unter.Shared, []string{"m", "q"}, true},
+	{unter.Shared, []string{"m", "m"}, false},
+	{unter.Shared, []string{""}, false},
+}
+
+func TestRideRiders(t *testing.T) {
+	for _, tc := range rideRidersCases {
+		name := fmt.Sprintf("%s-%v", tc.kind, tc.riders)
+		t.Run(name, func(t *testing.T) {
+			r := unter.Ride{
+				ID:     unter.NewID(),
+				Driver: "Bond",
+				Kind:   tc.kind,
+				Start:  now,
+				Riders: tc.riders,
+			}
+			err := r.Validate()
+			if tc.ok {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestRiderValidate(t *testing.T) {
+	r := unter.Rider{Login: "m", Name: "Miss Moneypenny", Email: "penny@mi6.gov.uk"}
+	require.NoError(t, r.Validate())
+
+	r.Email = "penny"
+	require.Error(t, r.Validate())
+}
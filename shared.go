@@ -0,0 +1,95 @@
+package unter
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// sharedRate is the most a rider pays for a shared ride, as a fraction of
+// the same ride alone.
+const sharedRate = 0.9
+
+// Leg is a rider's part of a shared ride.
+type Leg struct {
+	Rider    string
+	Pickup   time.Time
+	Dropoff  time.Time // zero while the rider is on board
+	Distance float64
+}
+
+func (l Leg) Validate() error {
+	if l.Rider == "" {
+		return fmt.Errorf("missing rider")
+	}
+
+	if l.Pickup.Equal(zeroTime) {
+		return fmt.Errorf("missing pickup time")
+	}
+
+	if !l.Dropoff.Equal(zeroTime) && l.Dropoff.Before(l.Pickup) {
+		return fmt.Errorf("dropoff before pickup (%v < %v)", l.Dropoff, l.Pickup)
+	}
+
+	if l.Distance < 0 {
+		return fmt.Errorf("negative distance: %f", l.Distance)
+	}
+
+	return nil
+}
+
+// duration returns the leg duration, open legs end at end.
+func (l Leg) duration(end time.Time) time.Duration {
+	if l.Dropoff.Equal(zeroTime) {
+		return end.Sub(l.Pickup)
+	}
+	return l.Dropoff.Sub(l.Pickup)
+}
+
+// SplitFare returns the fare of each leg (in ¢) of a shared ride, in legs
+// order. Open legs end with the ride.
+//
+// Each leg is priced as a ride alone with the shared discount. When riders
+// overlap enough that this is more than the whole trip alone, the trip fare
+// is split in proportion to the leg prices instead.
+func SplitFare(r Ride) []int {
+	if len(r.Legs) == 0 {
+		return nil
+	}
+
+	alone := make([]float64, len(r.Legs))
+	fares := make([]int, len(r.Legs))
+	var aloneTotal float64
+	sharedTotal := 0
+	for i, l := range r.Legs {
+		d := l.duration(r.End)
+		alone[i] = float64(RideFee(d, l.Distance, false))
+		aloneTotal += alone[i]
+		fares[i] = RideFee(d, l.Distance, true)
+		sharedTotal += fares[i]
+	}
+
+	trip := RideFee(r.End.Sub(r.Start), r.Distance, false)
+	if trip >= sharedTotal {
+		return fares
+	}
+
+	// Largest remainder so fares add up to the trip fare
+	rem := make([]int, len(fares))
+	total := 0
+	fracs := make([]float64, len(fares))
+	for i := range fares {
+		share := float64(trip) * alone[i] / aloneTotal
+		fares[i] = int(math.Floor(share))
+		fracs[i] = share - float64(fares[i])
+		total += fares[i]
+		rem[i] = i
+	}
+	sort.SliceStable(rem, func(i, j int) bool { return fracs[rem[i]] > fracs[rem[j]] })
+	for i := 0; i < trip-total; i++ {
+		fares[rem[i%len(rem)]]++
+	}
+
+	return fares
+}
@@ -0,0 +1,130 @@
+package unter_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/353solutions/unter"
+	"github.com/353solutions/unter/ledger"
+)
+
+// sharedRide returns a 10 minute shared ride, legs are (start minute, end
+// minute, distance).
+func sharedRide(distance float64, legs ...[3]float64) unter.Ride {
+	r := unter.Ride{
+		ID:       unter.NewID(),
+		Driver:   "Bond",
+		Kind:     unter.Shared,
+		Start:    now,
+		End:      now.Add(10 * time.Minute),
+		Distance: distance,
+	}
+	for i, l := range legs {
+		rider := fmt.Sprintf("r%d", i)
+		r.Riders = append(r.Riders, rider)
+		r.Legs = append(r.Legs, unter.Leg{
+			Rider:    rider,
+			Pickup:   now.Add(time.Duration(l[0]) * time.Minute),
+			Dropoff:  now.Add(time.Duration(l[1]) * time.Minute),
+			Distance: l[2],
+		})
+	}
+	return r
+}
+
+var splitFareCases = []struct {
+	name  string
+	ride  unter.Ride
+	fares []int
+}{
+	{"alone", sharedRide(4, [3]float64{0, 10, 4}), []int{900}},
+	{"one after the other", sharedRide(4, [3]float64{0, 5, 2}, [3]float64{5, 10, 2}), []int{450, 450}},
+	{"same route", sharedRide(4, [3]float64{0, 10, 4}, [3]float64{0, 10, 4}), []int{500, 500}},
+	{"partial", sharedRide(4, [3]float64{0, 10, 4}, [3]float64{2, 4, 1}), []int{800, 200}},
+	{"rounding", sharedRide(4.006, [3]float64{0, 10, 4.006}, [3]float64{0, 10, 4.006}), []int{501, 500}},
+}
+
+func TestSplitFare(t *testing.T) {
+	for _, tc := range splitFareCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.NoError(t, tc.ride.Validate())
+			fares := unter.SplitFare(tc.ride)
+			require.Equal(t, tc.fares, fares)
+
+			// Never more than riding alone with the shared discount
+			for i, l := range tc.ride.Legs {
+				alone := unter.RideFee(l.Dropoff.Sub(l.Pickup), l.Distance, true)
+				require.LessOrEqual(t, fares[i], alone)
+			}
+		})
+	}
+}
+
+func TestByDriverShared(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	r := sharedRide(4, [3]float64{0, 10, 4}, [3]float64{2, 4, 1})
+	lr := ledger.Ride{
+		ID:         r.ID,
+		Driver:     r.Driver,
+		Time:       r.End,
+		Total:      1000,
+		Commission: unter.RideCommission,
+		Shares:     unter.SplitFare(r),
+	}
+	for _, leg := range r.Legs {
+		lr.Riders = append(lr.Riders, leg.Rider)
+	}
+	e, err := ledger.RideEntry(lr)
+	require.NoError(err)
+	l := ledger.New(ledger.NewMemStore())
+	_, err = l.Post(ctx, e)
+	require.NoError(err)
+
+	reports, err := unter.ByDriver(ctx, []unter.Ride{r}, l, r.End)
+	require.NoError(err)
+	require.Len(reports, 1)
+	require.Equal(1000-30, reports[0].Payment)
+
+	_, err = l.Payout(ctx, r.Driver, 0, r.End)
+	require.NoError(err)
+	reports, err = unter.ByDriver(ctx, []unter.Ride{r}, l, r.End)
+	require.NoError(err)
+	require.Equal(0, reports[0].Payment)
+}
+
+var badLegsCases = []struct {
+	name string
+	ride func() unter.Ride
+}{
+	{"private", func() unter.Ride {
+		r := sharedRide(4, [3]float64{0, 10, 4})
+		r.Kind = unter.Private
+		return r
+	}},
+	{"unknown rider", func() unter.Ride {
+		r := sharedRide(4, [3]float64{0, 10, 4})
+		r.Riders = []string{"m"}
+		return r
+	}},
+	{"rider without leg", func() unter.Ride {
+		r := sharedRide(4, [3]float64{0, 10, 4})
+		r.Riders = append(r.Riders, "m")
+		return r
+	}},
+	{"after end", func() unter.Ride { return sharedRide(4, [3]float64{0, 11, 4}) }},
+	{"dropoff before pickup", func() unter.Ride { return sharedRide(4, [3]float64{5, 4, 1}) }},
+}
+
+func TestBadLegs(t *testing.T) {
+	for _, tc := range badLegsCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Error(t, tc.ride().Validate())
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package trace
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+)
+
+// WriterExporter writes spans as JSON lines.
+type WriterExporter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	w   io.Writer
+}
+
+func NewWriterExporter(w io.Writer) *WriterExporter {
+	return &WriterExporter{enc: json.NewEncoder(w), w: w}
+}
+
+// NewStdoutExporter returns an exporter writing JSON lines to stdout.
+func NewStdoutExporter() *WriterExporter {
+	return NewWriterExporter(os.Stdout)
+}
+
+// NewFileExporter returns an exporter appending JSON lines to a file.
+// Call Close when done.
+func NewFileExporter(path string) (*WriterExporter, error) {
+	flags := os.O_APPEND | os.O_CREATE | os.O_WRONLY
+	file, err := os.OpenFile(path, flags, 0600) //#nosec G304
+	if err != nil {
+		return nil, err
+	}
+
+	return NewWriterExporter(file), nil
+}
+
+func (e *WriterExporter) Export(s *Span) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.enc.Encode(s)
+}
+
+// Close closes the underlying writer if it's an io.Closer (other than stdout).
+func (e *WriterExporter) Close() error {
+	if e.w == os.Stdout {
+		return nil
+	}
+
+	if c, ok := e.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
@@ -0,0 +1,286 @@
+// Package trace implements minimal distributed tracing with W3C trace context
+// (traceparent) propagation.
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Header is the W3C trace context header name.
+const Header = "traceparent"
+
+type TraceID [16]byte
+
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+func (t TraceID) IsValid() bool  { return t != TraceID{} }
+
+type SpanID [8]byte
+
+func (s SpanID) String() string { return hex.EncodeToString(s[:]) }
+func (s SpanID) IsValid() bool  { return s != SpanID{} }
+
+// SpanContext is the part of a span that is propagated across processes.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// Traceparent returns sc in traceparent header format.
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", sc.TraceID, sc.SpanID, flags)
+}
+
+var ErrBadTraceparent = errors.New("bad traceparent")
+
+// Parse parses a traceparent header value.
+// Format is "version-trace_id-parent_id-flags", e.g.
+// 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+func Parse(s string) (SpanContext, error) {
+	fields := strings.Split(strings.TrimSpace(s), "-")
+	if len(fields) < 4 {
+		return SpanContext{}, ErrBadTraceparent
+	}
+
+	version, tid, sid, flags := fields[0], fields[1], fields[2], fields[3]
+	// Version ff is invalid, version 00 must have exactly 4 fields.
+	if len(version) != 2 || version == "ff" || (version == "00" && len(fields) != 4) {
+		return SpanContext{}, ErrBadTraceparent
+	}
+	if len(tid) != 32 || len(sid) != 16 || len(flags) != 2 {
+		return SpanContext{}, ErrBadTraceparent
+	}
+	if !isLowerHex(version + tid + sid + flags) {
+		return SpanContext{}, ErrBadTraceparent
+	}
+
+	var sc SpanContext
+	hex.Decode(sc.TraceID[:], []byte(tid)) //#nosec G104
+	hex.Decode(sc.SpanID[:], []byte(sid))  //#nosec G104
+	var f [1]byte
+	hex.Decode(f[:], []byte(flags)) //#nosec G104
+	sc.Sampled = f[0]&1 == 1
+
+	if !sc.IsValid() {
+		return SpanContext{}, ErrBadTraceparent
+	}
+	return sc, nil
+}
+
+func isLowerHex(s string) bool {
+	for _, c := range s {
+		if !(c >= '0' && c <= '9') && !(c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+type Kind string
+
+const (
+	Server   Kind = "server"
+	Client   Kind = "client"
+	Internal Kind = "internal"
+)
+
+// Span is a timed operation in a trace.
+type Span struct {
+	TraceID  string            `json:"trace_id"`
+	SpanID   string            `json:"span_id"`
+	ParentID string            `json:"parent_id,omitempty"`
+	Name     string            `json:"name"`
+	Kind     Kind              `json:"kind"`
+	Start    time.Time         `json:"start"`
+	End      time.Time         `json:"end"`
+	Attrs    map[string]string `json:"attrs,omitempty"`
+	Error    string            `json:"error,omitempty"`
+
+	mu     sync.Mutex
+	sc     SpanContext
+	ended  bool
+	tracer *Tracer
+}
+
+// Context returns the span context to propagate.
+func (s *Span) Context() SpanContext {
+	return s.sc
+}
+
+func (s *Span) SetName(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Name = name
+}
+
+func (s *Span) SetAttr(key, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Attrs == nil {
+		s.Attrs = make(map[string]string)
+	}
+	s.Attrs[key] = value
+}
+
+// SetError marks the span as failed, nil err is ignored.
+func (s *Span) SetError(err error) {
+	if err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Error = err.Error()
+}
+
+// Finish ends the span and sends it to the exporter. Calling Finish more than
+// once has no effect.
+func (s *Span) Finish() {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.End = time.Now().UTC()
+	s.mu.Unlock()
+
+	s.tracer.export(s)
+}
+
+// Exporter receives finished spans.
+type Exporter interface {
+	Export(s *Span) error
+}
+
+// Tracer creates spans and sends them to an exporter.
+type Tracer struct {
+	mu       sync.RWMutex
+	exporter Exporter
+	// OnError is called when exporting fails, defaults to ignoring the error.
+	OnError func(error)
+}
+
+func NewTracer(e Exporter) *Tracer {
+	return &Tracer{exporter: e}
+}
+
+func (t *Tracer) SetExporter(e Exporter) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.exporter = e
+}
+
+func (t *Tracer) export(s *Span) {
+	t.mu.RLock()
+	e, onErr := t.exporter, t.OnError
+	t.mu.RUnlock()
+
+	if e == nil {
+		return
+	}
+
+	if err := e.Export(s); err != nil && onErr != nil {
+		onErr(err)
+	}
+}
+
+// Start starts a new span. The span is a child of the span in ctx or of the
+// remote span context set by ContextWithRemote.
+func (t *Tracer) Start(ctx context.Context, name string, kind Kind) (context.Context, *Span) {
+	s := Span{
+		Name:   name,
+		Kind:   kind,
+		Start:  time.Now().UTC(),
+		tracer: t,
+	}
+
+	parent, ok := spanContext(ctx)
+	if ok {
+		s.sc.TraceID = parent.TraceID
+		s.sc.Sampled = parent.Sampled
+		s.ParentID = parent.SpanID.String()
+	} else {
+		rand.Read(s.sc.TraceID[:]) //#nosec G104
+		s.sc.Sampled = true
+	}
+	rand.Read(s.sc.SpanID[:]) //#nosec G104
+
+	s.TraceID = s.sc.TraceID.String()
+	s.SpanID = s.sc.SpanID.String()
+
+	return context.WithValue(ctx, spanKey, &s), &s
+}
+
+type keyType int
+
+const (
+	spanKey keyType = iota + 1
+	remoteKey
+)
+
+// ContextWithRemote returns a context with a span context received from
+// another process.
+func ContextWithRemote(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteKey, sc)
+}
+
+// FromContext returns the current span in ctx, nil if there's none.
+func FromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey).(*Span)
+	return s
+}
+
+func spanContext(ctx context.Context) (SpanContext, bool) {
+	if s := FromContext(ctx); s != nil {
+		return s.sc, true
+	}
+
+	sc, ok := ctx.Value(remoteKey).(SpanContext)
+	return sc, ok && sc.IsValid()
+}
+
+// Extract returns ctx with the remote span context from h, if there's a valid
+// one.
+func Extract(ctx context.Context, h http.Header) context.Context {
+	sc, err := Parse(h.Get(Header))
+	if err != nil {
+		return ctx
+	}
+	return ContextWithRemote(ctx, sc)
+}
+
+// Inject sets the traceparent header from the span context in ctx.
+func Inject(ctx context.Context, h http.Header) {
+	if sc, ok := spanContext(ctx); ok {
+		h.Set(Header, sc.Traceparent())
+	}
+}
+
+// Default is the tracer used by the package level functions.
+var Default = NewTracer(nil)
+
+// SetExporter sets the exporter of the default tracer.
+func SetExporter(e Exporter) {
+	Default.SetExporter(e)
+}
+
+// Start starts a span using the default tracer.
+func Start(ctx context.Context, name string, kind Kind) (context.Context, *Span) {
+	return Default.Start(ctx, name, kind)
+}
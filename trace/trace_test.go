@@ -0,0 +1,78 @@
+package trace
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var parseCases = []struct {
+	header string
+	ok     bool
+}{
+	{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true},
+	{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", true},
+	{"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", true},
+	{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", false},
+	{"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false},
+	{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", false},
+	{"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", false},
+	{"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", false},
+	{"00-4bf92f35-00f067aa0ba902b7-01", false},
+	{"", false},
+}
+
+func TestParse(t *testing.T) {
+	for _, tc := range parseCases {
+		t.Run(tc.header, func(t *testing.T) {
+			sc, err := Parse(tc.header)
+			if !tc.ok {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID.String())
+			require.Equal(t, "00f067aa0ba902b7", sc.SpanID.String())
+		})
+	}
+}
+
+func TestPropagation(t *testing.T) {
+	require := require.New(t)
+
+	var buf bytes.Buffer
+	tr := NewTracer(NewWriterExporter(&buf))
+
+	in := http.Header{}
+	in.Set(Header, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx := Extract(context.Background(), in)
+
+	ctx, parent := tr.Start(ctx, "server", Server)
+	_, child := tr.Start(ctx, "sql.get", Client)
+	child.Finish()
+	parent.Finish()
+
+	require.Equal("4bf92f3577b34da6a3ce929d0e0e4736", parent.TraceID)
+	require.Equal("00f067aa0ba902b7", parent.ParentID)
+	require.Equal(parent.TraceID, child.TraceID)
+	require.Equal(parent.SpanID, child.ParentID)
+
+	out := http.Header{}
+	Inject(ctx, out)
+	sc, err := Parse(out.Get(Header))
+	require.NoError(err)
+	require.Equal(parent.SpanID, sc.SpanID.String())
+
+	dec := json.NewDecoder(&buf)
+	var names []string
+	for dec.More() {
+		var s Span
+		require.NoError(dec.Decode(&s))
+		names = append(names, s.Name)
+	}
+	require.Equal([]string{"sql.get", "server"}, names)
+}
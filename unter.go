@@ -30,10 +30,13 @@ func (k Kind) String() string {
 type Ride struct {
 	ID       string
 	Driver   string
+	CarID    string // vehicle ID
 	Kind     Kind
 	Start    time.Time
 	End      time.Time
 	Distance float64
+	Riders   []string // rider logins, Private rides have at most one
+	Legs     []Leg    // Shared rides only, one per rider
 }
 
 var zeroTime time.Time
@@ -63,6 +66,48 @@ func (r Ride) Validate() error {
 		return fmt.Errorf("negative distance: %f", r.Distance)
 	}
 
+	if r.Kind == Private && len(r.Riders) > 1 {
+		return fmt.Errorf("private ride with %d riders", len(r.Riders))
+	}
+
+	seen := make(map[string]bool)
+	for _, login := range r.Riders {
+		if login == "" || seen[login] {
+			return fmt.Errorf("bad rider: %q", login)
+		}
+		seen[login] = true
+	}
+
+	if r.Kind != Shared && len(r.Legs) > 0 {
+		return fmt.Errorf("%s ride with legs", r.Kind)
+	}
+
+	legs := make(map[string]bool)
+	for i, l := range r.Legs {
+		if err := l.Validate(); err != nil {
+			return fmt.Errorf("leg %d: %w", i, err)
+		}
+		if !seen[l.Rider] || legs[l.Rider] {
+			return fmt.Errorf("leg %d: bad rider: %q", i, l.Rider)
+		}
+		legs[l.Rider] = true
+		if l.Pickup.Before(r.Start) {
+			return fmt.Errorf("leg %d: pickup before start", i)
+		}
+		if !r.End.Equal(zeroTime) && l.Dropoff.After(r.End) {
+			return fmt.Errorf("leg %d: dropoff after end", i)
+		}
+	}
+
+	// Riders without a leg would ride for free
+	if len(r.Legs) > 0 {
+		for _, login := range r.Riders {
+			if !legs[login] {
+				return fmt.Errorf("rider %q without leg", login)
+			}
+		}
+	}
+
 	return nil
 }
 
@@ -0,0 +1,94 @@
+package unter
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+type Class uint8
+
+const (
+	Standard Class = iota + 1
+	XL
+	Premium
+	maxClass
+)
+
+func (c Class) String() string {
+	switch c {
+	case Standard:
+		return "standard"
+	case XL:
+		return "xl"
+	case Premium:
+		return "premium"
+	}
+
+	return fmt.Sprintf("<Class %d>", c)
+}
+
+// sharedMinCapacity is the passenger seats needed for a shared ride.
+const sharedMinCapacity = 3
+
+type Vehicle struct {
+	ID                string
+	Plate             string
+	Model             string // e.g. "Aston Martin DB5"
+	Capacity          int    // passenger seats
+	Class             Class
+	InspectionExpires time.Time
+}
+
+func (v Vehicle) Validate() error {
+	if v.ID == "" {
+		return fmt.Errorf("missing ID")
+	}
+
+	if v.Plate == "" {
+		return fmt.Errorf("missing plate")
+	}
+
+	if v.Capacity <= 0 {
+		return fmt.Errorf("bad capacity: %d", v.Capacity)
+	}
+
+	if v.Class <= 0 || v.Class >= maxClass {
+		return fmt.Errorf("bad class: %d", v.Class)
+	}
+
+	if v.InspectionExpires.Equal(zeroTime) {
+		return fmt.Errorf("missing inspection expiry")
+	}
+
+	return nil
+}
+
+var (
+	ErrInspectionExpired = errors.New("vehicle inspection expired")
+	ErrCapacity          = errors.New("vehicle capacity too small")
+	ErrClass             = errors.New("vehicle class doesn't fit ride kind")
+)
+
+// CanServe returns an error if v can't serve a ride of kind k with riders
+// passengers at now.
+func (v Vehicle) CanServe(k Kind, riders int, now time.Time) error {
+	if now.After(v.InspectionExpires) {
+		return ErrInspectionExpired
+	}
+
+	if k == Shared {
+		if v.Class == Premium {
+			return ErrClass
+		}
+		if v.Capacity < sharedMinCapacity {
+			return ErrCapacity
+		}
+	}
+
+	if riders > v.Capacity {
+		return ErrCapacity
+	}
+
+	return nil
+}
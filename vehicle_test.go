@@ -0,0 +1,51 @@
+package unter_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/353solutions/unter"
+)
+
+var db5 = unter.Vehicle{
+	ID:                "db5",
+	Plate:             "BMT 216A",
+	Model:             "Aston Martin DB5",
+	Capacity:          1,
+	Class:             unter.Premium,
+	InspectionExpires: now.Add(30 * 24 * time.Hour),
+}
+
+func withVehicle(fn func(v *unter.Vehicle)) unter.Vehicle {
+	v := db5
+	fn(&v)
+	return v
+}
+
+var canServeCases = []struct {
+	vehicle unter.Vehicle
+	kind    unter.Kind
+	riders  int
+	err     error
+}{
+	{db5, unter.Private, 1, nil},
+	{db5, unter.Private, 2, unter.ErrCapacity},
+	{db5, unter.Shared, 1, unter.ErrClass},
+	{withVehicle(func(v *unter.Vehicle) { v.Class = unter.Standard }), unter.Shared, 1, unter.ErrCapacity},
+	{withVehicle(func(v *unter.Vehicle) { v.Class, v.Capacity = unter.XL, 6 }), unter.Shared, 4, nil},
+	{withVehicle(func(v *unter.Vehicle) { v.InspectionExpires = now.Add(-time.Hour) }), unter.Private, 1, unter.ErrInspectionExpired},
+}
+
+func TestVehicleCanServe(t *testing.T) {
+	for _, tc := range canServeCases {
+		name := fmt.Sprintf("%s-%d-%s-%d", tc.vehicle.Class, tc.vehicle.Capacity, tc.kind, tc.riders)
+		t.Run(name, func(t *testing.T) {
+			require.NoError(t, tc.vehicle.Validate())
+			err := tc.vehicle.CanServe(tc.kind, tc.riders, now)
+			require.ErrorIs(t, err, tc.err)
+		})
+	}
+}
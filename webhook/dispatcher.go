@@ -0,0 +1,242 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/353solutions/unter/events"
+	"github.com/353solutions/unter/trace"
+)
+
+// Dispatcher creates deliveries for events and sends them.
+type Dispatcher struct {
+	store  Store
+	client *http.Client
+
+	MaxAttempts int
+	// Backoff returns the delay after attempt n (1 based) failed.
+	Backoff func(n int) time.Duration
+	// Lease is how long a claimed delivery is hidden from other dispatchers,
+	// must be longer than the client timeout.
+	Lease     time.Duration
+	BatchSize int
+	// OnError is called with store errors (can be nil).
+	OnError func(error)
+}
+
+func NewDispatcher(store Store, timeout time.Duration) *Dispatcher {
+	d := Dispatcher{
+		store:       store,
+		client:      &http.Client{Timeout: timeout},
+		MaxAttempts: 8,
+		Backoff:     ExponentialBackoff(time.Second, time.Hour),
+		Lease:       timeout + 30*time.Second,
+		BatchSize:   20,
+	}
+	return &d
+}
+
+func (d *Dispatcher) Store() Store {
+	return d.store
+}
+
+// ExponentialBackoff returns base*2^(n-1) up to max, with up to 10% jitter so
+// failing receivers aren't hit by all retries at once.
+func ExponentialBackoff(base, max time.Duration) func(int) time.Duration {
+	return func(n int) time.Duration {
+		d := max
+		if n < 32 {
+			if e := base << (n - 1); e > 0 && e < max {
+				d = e
+			}
+		}
+		jitter := time.Duration(rand.Int63n(int64(d)/10 + 1)) //#nosec G404 - not security
+		return d + jitter
+	}
+}
+
+// Enqueue creates a pending delivery for every subscription that wants e.
+// Delivery IDs derive from the event ID, enqueuing the same event again
+// doesn't create new deliveries.
+func (d *Dispatcher) Enqueue(ctx context.Context, e events.Event) error {
+	subs, err := d.store.Subscriptions(ctx)
+	if err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	for _, s := range subs {
+		if !s.Wants(string(e.Type)) {
+			continue
+		}
+
+		dl := Delivery{
+			ID:             fmt.Sprintf("dlv_%s_%d", s.ID, e.ID),
+			SubscriptionID: s.ID,
+			EventID:        e.ID,
+			EventType:      string(e.Type),
+			Payload:        payload,
+			Status:         Pending,
+			NextAttempt:    now,
+			Created:        now,
+			Updated:        now,
+		}
+		if err := d.store.AddDelivery(ctx, dl); err != nil {
+			return fmt.Errorf("%s: %w", s.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// Run sends due deliveries every interval until ctx is done.
+func (d *Dispatcher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := d.Process(ctx); err != nil {
+			d.onError(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (d *Dispatcher) onError(err error) {
+	if d.OnError != nil {
+		d.OnError(err)
+	}
+}
+
+// Process sends one batch of due deliveries and returns how many were sent.
+func (d *Dispatcher) Process(ctx context.Context) (int, error) {
+	due, err := d.store.ClaimDue(ctx, time.Now().UTC(), d.Lease, d.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, dl := range due {
+		if err := d.attempt(ctx, dl); err != nil {
+			d.onError(fmt.Errorf("delivery %s: %w", dl.ID, err))
+		}
+	}
+	return len(due), nil
+}
+
+// attempt sends dl once and records the result.
+func (d *Dispatcher) attempt(ctx context.Context, dl Delivery) error {
+	sub, err := d.store.Subscription(ctx, dl.SubscriptionID)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) { // subscription deleted
+			dl.Status, dl.LastError = Dead, "subscription deleted"
+			dl.Updated = time.Now().UTC()
+			return d.store.UpdateDelivery(ctx, dl)
+		}
+		return err
+	}
+
+	start := time.Now()
+	code, sendErr := d.send(ctx, sub, dl)
+	a := Attempt{
+		DeliveryID: dl.ID,
+		N:          dl.Attempts + 1,
+		Time:       start.UTC(),
+		StatusCode: code,
+		Duration:   time.Since(start),
+	}
+	if sendErr != nil {
+		a.Error = sendErr.Error()
+	}
+	if err := d.store.AddAttempt(ctx, a); err != nil {
+		return err
+	}
+
+	dl.Attempts++
+	dl.Updated = time.Now().UTC()
+	dl.LastError = a.Error
+	switch {
+	case sendErr == nil:
+		dl.Status = Delivered
+	case dl.Attempts >= d.MaxAttempts:
+		dl.Status = Dead
+	default:
+		dl.NextAttempt = dl.Updated.Add(d.Backoff(dl.Attempts))
+	}
+
+	return d.store.UpdateDelivery(ctx, dl)
+}
+
+// send posts the delivery payload, any non 2xx status is an error.
+func (d *Dispatcher) send(ctx context.Context, sub Subscription, dl Delivery) (int, error) {
+	ctx, span := trace.Start(ctx, "webhook.send", trace.Client)
+	defer span.Finish()
+	span.SetAttr("webhook.subscription", sub.ID)
+	span.SetAttr("webhook.delivery", dl.ID)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(dl.Payload))
+	if err != nil {
+		span.SetError(err)
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, dl.EventType)
+	req.Header.Set(DeliveryHeader, dl.ID)
+	req.Header.Set(SignatureHeader, Sign(sub.Secret, time.Now(), dl.Payload))
+	trace.Inject(ctx, req.Header)
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		span.SetError(err)
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16)) //#nosec G104 - reuse connection
+
+	span.SetAttr("http.status_code", strconv.Itoa(resp.StatusCode))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		err := fmt.Errorf("bad status: %d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+		span.SetError(err)
+		return resp.StatusCode, err
+	}
+	return resp.StatusCode, nil
+}
+
+var ErrNotDead = errors.New("delivery not dead")
+
+// Retry resets a dead delivery to pending with a fresh set of attempts.
+func (d *Dispatcher) Retry(ctx context.Context, id string) (Delivery, error) {
+	dl, err := d.store.Delivery(ctx, id)
+	if err != nil {
+		return Delivery{}, err
+	}
+	if dl.Status != Dead {
+		return Delivery{}, fmt.Errorf("%w (%s)", ErrNotDead, dl.Status)
+	}
+
+	dl.Status = Pending
+	dl.Attempts = 0
+	dl.NextAttempt = time.Now().UTC()
+	dl.Updated = dl.NextAttempt
+	if err := d.store.UpdateDelivery(ctx, dl); err != nil {
+		return Delivery{}, err
+	}
+	return dl, nil
+}
@@ -0,0 +1,140 @@
+package webhook
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemStore is an in memory Store, for tests and single instance setups.
+type MemStore struct {
+	mu         sync.Mutex
+	subs       map[string]Subscription
+	deliveries map[string]Delivery
+	attempts   map[string][]Attempt
+}
+
+func NewMemStore() *MemStore {
+	s := MemStore{
+		subs:       make(map[string]Subscription),
+		deliveries: make(map[string]Delivery),
+		attempts:   make(map[string][]Attempt),
+	}
+	return &s
+}
+
+func (m *MemStore) AddSubscription(_ context.Context, s Subscription) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.subs[s.ID] = s
+	return nil
+}
+
+func (m *MemStore) Subscription(_ context.Context, id string) (Subscription, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.subs[id]
+	if !ok {
+		return Subscription{}, ErrNotFound
+	}
+	return s, nil
+}
+
+func (m *MemStore) Subscriptions(context.Context) ([]Subscription, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	subs := make([]Subscription, 0, len(m.subs))
+	for _, s := range m.subs {
+		subs = append(subs, s)
+	}
+	sort.Slice(subs, func(i, j int) bool { return subs[i].Created.Before(subs[j].Created) })
+	return subs, nil
+}
+
+func (m *MemStore) DeleteSubscription(_ context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.subs[id]; !ok {
+		return ErrNotFound
+	}
+	delete(m.subs, id)
+	return nil
+}
+
+func (m *MemStore) AddDelivery(_ context.Context, d Delivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.deliveries[d.ID]; ok {
+		return nil
+	}
+	m.deliveries[d.ID] = d
+	return nil
+}
+
+func (m *MemStore) Delivery(_ context.Context, id string) (Delivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d, ok := m.deliveries[id]
+	if !ok {
+		return Delivery{}, ErrNotFound
+	}
+	return d, nil
+}
+
+func (m *MemStore) UpdateDelivery(_ context.Context, d Delivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.deliveries[d.ID]; !ok {
+		return ErrNotFound
+	}
+	m.deliveries[d.ID] = d
+	return nil
+}
+
+func (m *MemStore) Deliveries(_ context.Context, subID string, status Status, limit int) ([]Delivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var ds []Delivery
+	for _, d := range m.deliveries {
+		if d.SubscriptionID == subID && (status == "" || d.Status == status) {
+			ds = append(ds, d)
+		}
+	}
+	sort.Slice(ds, func(i, j int) bool { return ds[i].Created.After(ds[j].Created) })
+	if len(ds) > limit {
+		ds = ds[:limit]
+	}
+	return ds, nil
+}
+
+func (m *MemStore) ClaimDue(_ context.Context, now time.Time, lease time.Duration, limit int) ([]Delivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var due []Delivery
+	for id, d := range m.deliveries {
+		if len(due) == limit {
+			break
+		}
+		if d.Status != Pending || d.NextAttempt.After(now) {
+			continue
+		}
+		due = append(due, d)
+		d.NextAttempt = now.Add(lease)
+		m.deliveries[id] = d
+	}
+	return due, nil
+}
+
+func (m *MemStore) AddAttempt(_ context.Context, a Attempt) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.attempts[a.DeliveryID] = append(m.attempts[a.DeliveryID], a)
+	return nil
+}
+
+func (m *MemStore) Attempts(_ context.Context, deliveryID string) ([]Attempt, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Attempt(nil), m.attempts[deliveryID]...), nil
+}
@@ -0,0 +1,146 @@
+package webhook
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/353solutions/unter/events"
+)
+
+var verifyCases = []struct {
+	name   string
+	secret string
+	header string
+	ok     bool
+}{
+	{"valid", "s3cr3t", Sign("s3cr3t", time.Now(), []byte("body")), true},
+	{"wrong secret", "other", Sign("s3cr3t", time.Now(), []byte("body")), false},
+	{"old", "s3cr3t", Sign("s3cr3t", time.Now().Add(-time.Hour), []byte("body")), false},
+	{"malformed", "s3cr3t", "v1=abc", false},
+}
+
+func TestVerify(t *testing.T) {
+	for _, tc := range verifyCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := Verify(tc.secret, tc.header, []byte("body"), 5*time.Minute)
+			if tc.ok {
+				require.NoError(t, err)
+			} else {
+				require.ErrorIs(t, err, ErrBadSignature)
+			}
+		})
+	}
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	b := ExponentialBackoff(time.Second, time.Minute)
+	for n, base := range map[int]time.Duration{1: time.Second, 3: 4 * time.Second, 10: time.Minute, 100: time.Minute} {
+		d := b(n)
+		require.GreaterOrEqual(t, d, base, n)
+		require.LessOrEqual(t, d, base+base/10, n)
+	}
+}
+
+// receiver is a local webhook receiver that fails the first fails requests.
+func receiver(t *testing.T, secret string, fails int32) (*httptest.Server, *atomic.Int32) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		if err := Verify(secret, r.Header.Get(SignatureHeader), body, time.Minute); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		if n <= fails {
+			http.Error(w, "oops", http.StatusInternalServerError)
+			return
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func setupDispatcher(t *testing.T, url string, events ...string) (*Dispatcher, *MemStore) {
+	store := NewMemStore()
+	sub := Subscription{
+		ID:      NewID("wh"),
+		URL:     url,
+		Secret:  "s3cr3t",
+		Events:  events,
+		Created: time.Now(),
+	}
+	require.NoError(t, store.AddSubscription(context.Background(), sub))
+
+	d := NewDispatcher(store, time.Second)
+	d.MaxAttempts = 3
+	d.Backoff = func(int) time.Duration { return 0 }
+	d.OnError = func(err error) { t.Errorf("dispatcher: %s", err) }
+	return d, store
+}
+
+func TestDispatcher(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	srv, calls := receiver(t, "s3cr3t", 1)
+	d, store := setupDispatcher(t, srv.URL, string(events.RideEnded))
+
+	require.NoError(d.Enqueue(ctx, events.Event{ID: 1, Type: events.RideStarted}))
+	require.NoError(d.Enqueue(ctx, events.Event{ID: 2, Type: events.RideEnded}))
+	require.NoError(d.Enqueue(ctx, events.Event{ID: 2, Type: events.RideEnded}))
+	require.Len(store.deliveries, 1, "filtered by event & deduplicated")
+
+	n, err := d.Process(ctx)
+	require.NoError(err)
+	require.Equal(1, n)
+	n, err = d.Process(ctx)
+	require.NoError(err)
+	require.Equal(1, n)
+
+	require.Equal(int32(2), calls.Load())
+	for _, dl := range store.deliveries {
+		require.Equal(Delivered, dl.Status)
+		require.Equal(2, dl.Attempts)
+		attempts, err := store.Attempts(ctx, dl.ID)
+		require.NoError(err)
+		require.Len(attempts, 2)
+		require.Equal(http.StatusInternalServerError, attempts[0].StatusCode)
+		require.Equal(http.StatusOK, attempts[1].StatusCode)
+	}
+}
+
+func TestDispatcherDead(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	srv, _ := receiver(t, "s3cr3t", 100)
+	d, store := setupDispatcher(t, srv.URL)
+	require.NoError(d.Enqueue(ctx, events.Event{ID: 1, Type: events.RideStarted}))
+
+	for i := 0; i < 5; i++ {
+		_, err := d.Process(ctx)
+		require.NoError(err)
+	}
+
+	var id string
+	for _, dl := range store.deliveries {
+		require.Equal(Dead, dl.Status)
+		require.Equal(3, dl.Attempts)
+		require.Contains(dl.LastError, "500")
+		id = dl.ID
+	}
+
+	dl, err := d.Retry(ctx, id)
+	require.NoError(err)
+	require.Equal(Pending, dl.Status)
+	_, err = d.Retry(ctx, id)
+	require.ErrorIs(err, ErrNotDead)
+}